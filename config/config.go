@@ -2,12 +2,8 @@ package config
 
 import (
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"os"
-	"path/filepath"
 
 	"github.com/FISCO-BCOS/go-sdk/v3/client"
 	"gopkg.in/yaml.v2"
@@ -41,9 +37,154 @@ type Config struct {
 	} `yaml:"contract"`
 
 	Tee struct {
-		PrivateKey string `yaml:"private_key"`
-		PublicKey  string `yaml:"public_key"`
+		Client TeeClientConfig `yaml:"client"`
 	} `yaml:"tee"`
+
+	Keys KeysConfig `yaml:"keys"`
+
+	Auth struct {
+		JWTSecretEnv    string `yaml:"jwt_secret_env"`    // 保存 HS256 签名密钥的环境变量, 默认 HUFU_JWT_SECRET, 密钥至少32字节
+		Issuer          string `yaml:"issuer"`            // 令牌签发方
+		TokenTTLSeconds int    `yaml:"token_ttl_seconds"` // 令牌有效期
+		Bootstrap       struct {
+			Username string `yaml:"username"` // 首次启动时创建的运营账号, 已存在运营账号时忽略
+			Password string `yaml:"password"`
+		} `yaml:"bootstrap"`
+	} `yaml:"auth"`
+
+	Custody struct {
+		Mode string    `yaml:"mode"` // custodial: 服务端以 KMS 主密钥封装保存钱包私钥; non_custodial: 只保存公钥
+		KMS  KMSConfig `yaml:"kms"`
+	} `yaml:"custody"`
+
+	Balance struct {
+		RequireApproval   bool    `yaml:"require_approval"`   // 余额操作是否需要另一名运营人员审批
+		ApprovalThreshold float64 `yaml:"approval_threshold"` // 变动金额绝对值达到该值时需要审批, 0 表示全部需要
+	} `yaml:"balance"`
+
+	KYC struct {
+		DefaultTier     int          `yaml:"default_tier"`      // 未通过审核的用户适用的等级
+		DocumentMaxSize int64        `yaml:"document_max_size"` // 单个核验文档最大字节数
+		DocumentTypes   []string     `yaml:"document_types"`    // 允许的核验文档类型
+		Tiers           []TierPolicy `yaml:"tiers"`             // 各等级的监管策略, 为空时使用内置默认值
+	} `yaml:"kyc"`
+
+	WalletStatus struct {
+		ViolationFreezeThreshold int  `yaml:"violation_freeze_threshold"` // 统计窗口内异常交易达到该次数时自动冻结钱包, 0 表示不自动冻结
+		ViolationWindowHours     int  `yaml:"violation_window_hours"`     // 异常交易的统计窗口
+		ViolationFreezeHours     int  `yaml:"violation_freeze_hours"`     // 规则触发的冻结时长, 0 表示冻结到人工解冻
+		FreezeOnJuryApproval     bool `yaml:"freeze_on_jury_approval"`    // 陪审团批准监管申请后冻结对应钱包
+		ExpiryCheckSeconds       int  `yaml:"expiry_check_seconds"`       // 检查冻结到期的间隔
+	} `yaml:"wallet_status"`
+
+	Payments struct {
+		RequestTTLMinutes  int `yaml:"request_ttl_minutes"`   // 收款请求未指定有效期时的默认有效期
+		RequestMaxTTLHours int `yaml:"request_max_ttl_hours"` // 收款请求的最长有效期
+		EscrowTTLHours     int `yaml:"escrow_ttl_hours"`      // 担保未指定期限时的默认期限, 到期未释放自动退回
+		EscrowMaxTTLHours  int `yaml:"escrow_max_ttl_hours"`  // 担保的最长期限
+		ExpiryCheckSeconds int `yaml:"expiry_check_seconds"`  // 检查收款请求和担保到期的间隔
+	} `yaml:"payments"`
+
+	Schedules struct {
+		PollSeconds          int    `yaml:"poll_seconds"`           // 扫描到期计划转账的间隔
+		BatchSize            int    `yaml:"batch_size"`             // 每次扫描最多处理的计划数
+		MaxRetries           int    `yaml:"max_retries"`            // 余额不足时的重试次数, 用完后本次执行记为失败
+		RetryIntervalSeconds int    `yaml:"retry_interval_seconds"` // 余额不足时的重试间隔
+		NotifyWebhook        string `yaml:"notify_webhook"`         // 可选, 执行失败时以 POST JSON 通知该地址
+		NotifyTimeoutSeconds int    `yaml:"notify_timeout_seconds"`
+	} `yaml:"schedules"`
+
+	Replay struct {
+		MaxTTLSeconds          int `yaml:"max_ttl_seconds"`          // 转账信封允许的最长有效期
+		ClockSkewSeconds       int `yaml:"clock_skew_seconds"`       // 允许的客户端时钟偏差
+		CleanupIntervalSeconds int `yaml:"cleanup_interval_seconds"` // 清理过期随机数的间隔
+	} `yaml:"replay"`
+
+	Records struct {
+		RegulatorEscrowKey string `yaml:"regulator_escrow_key"` // 可选, 监管托管 RSA 公钥模数 (hex), 配置后每笔交易额外生成监管副本
+	} `yaml:"records"`
+
+	Evidence struct {
+		BlobDir      string   `yaml:"blob_dir"`      // 附件内容寻址存储目录
+		LegacyDir    string   `yaml:"legacy_dir"`    // 旧版证据文件目录, 迁移时导入
+		MaxSize      int64    `yaml:"max_size"`      // 单个附件最大字节数
+		AllowedTypes []string `yaml:"allowed_types"` // 允许的附件类型
+	} `yaml:"evidence"`
+}
+
+// TeeClientConfig TEE 服务的访问配置
+type TeeClientConfig struct {
+	APIURL          string `yaml:"api_url"`           // create_wallet, decrypt_transaction 等接口的地址
+	AddURL          string `yaml:"add_url"`           // add 接口的地址
+	FileURL         string `yaml:"file_url"`          // getfile 接口的地址
+	Proxy           string `yaml:"proxy"`             // 可选, socks5:// 或 http:// 代理
+	TimeoutSeconds  int    `yaml:"timeout_seconds"`   // 单次请求超时
+	Retries         int    `yaml:"retries"`           // 幂等请求连接失败或 502/503/504 时的重试次数
+	RetryBackoffMs  int    `yaml:"retry_backoff_ms"`  // 重试间隔, 每次翻倍
+	KeyPath         string `yaml:"key_path"`          // enclave 加密公钥接口路径, 基于 api_url
+	KeyCacheSeconds int    `yaml:"key_cache_seconds"` // 加密公钥缓存时间
+	TLS             struct {
+		CAFile             string `yaml:"ca_file"`
+		CertFile           string `yaml:"cert_file"` // 客户端证书, 与 key_file 一起用于 mTLS
+		KeyFile            string `yaml:"key_file"`
+		ServerName         string `yaml:"server_name"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	} `yaml:"tls"`
+	Attestation TeeAttestationConfig `yaml:"attestation"`
+}
+
+// TeeAttestationConfig TEE 远程证明配置
+type TeeAttestationConfig struct {
+	Enabled              bool     `yaml:"enabled"`
+	Path                 string   `yaml:"path"`                  // 证明报告接口路径, 基于 api_url
+	RootPublicKey        string   `yaml:"root_public_key"`       // 签发证明报告的根公钥
+	ExpectedMeasurements []string `yaml:"expected_measurements"` // 允许的 enclave 度量值
+	RefreshSeconds       int      `yaml:"refresh_seconds"`       // 重新证明的间隔
+	MaxAgeSeconds        int      `yaml:"max_age_seconds"`       // 报告时间与本地时间允许的最大偏差
+}
+
+// TierPolicy KYC 等级对应的监管策略
+type TierPolicy struct {
+	Tier                 int     `yaml:"tier" json:"tier"`
+	MaxTransactionAmount float64 `yaml:"max_transaction_amount" json:"max_transaction_amount"` // 单笔交易上限
+	MaxDailyAmount       float64 `yaml:"max_daily_amount" json:"max_daily_amount"`             // 日累计交易上限
+	HourlyFrequency      int     `yaml:"hourly_frequency" json:"hourly_frequency"`             // 每小时交易次数阈值
+	ProxyTransfer        bool    `yaml:"proxy_transfer" json:"proxy_transfer"`                 // 是否允许代理转账
+	AlertAmount          float64 `yaml:"alert_amount" json:"alert_amount"`                     // 达到该金额的交易向监管方告警, 0 表示不告警
+}
+
+// KMSConfig 钱包私钥主密钥的提供方配置
+type KMSConfig struct {
+	Provider string `yaml:"provider"` // file, pkcs11 或 emulator
+	KeyID    string `yaml:"key_id"`   // 主密钥ID, 为空时由提供方推导
+	KeyFile  string `yaml:"key_file"` // file: 保存 32 字节 hex 主密钥的文件
+	PKCS11   struct {
+		Module     string `yaml:"module"` // PKCS#11 动态库路径
+		TokenLabel string `yaml:"token_label"`
+		KeyLabel   string `yaml:"key_label"`
+		PIN        string `yaml:"pin"`
+	} `yaml:"pkcs11"`
+	Emulator struct {
+		URL            string `yaml:"url"` // 本地 KMS 模拟服务地址
+		TimeoutSeconds int    `yaml:"timeout_seconds"`
+	} `yaml:"emulator"`
+	Retired []KMSConfig `yaml:"retired"` // 轮换前的主密钥, 只用于解封旧数据密钥, 启动后数据密钥会逐步改由当前主密钥封装
+}
+
+// KeysConfig TEE 签名, 监管方和陪审团密钥的来源配置
+type KeysConfig struct {
+	Source   string `yaml:"source"` // keystore, env 或 emulator
+	Keystore struct {
+		Dir           string `yaml:"dir"`            // 加密密钥库目录, 每个密钥名称一个文件
+		PassphraseEnv string `yaml:"passphrase_env"` // 保存密钥库口令的环境变量
+	} `yaml:"keystore"`
+	Env struct {
+		Prefix string `yaml:"prefix"` // 密钥环境变量前缀
+	} `yaml:"env"`
+	Emulator struct {
+		URL            string `yaml:"url"` // 本地 HSM 模拟服务地址
+		TimeoutSeconds int    `yaml:"timeout_seconds"`
+	} `yaml:"emulator"`
 }
 
 var GlobalConfig Config
@@ -82,60 +223,3 @@ func ReadConfig(pk string) *client.Config {
 
 	return config
 }
-
-type KeyData struct {
-	PublicKey  string `json:"publicKey"`
-	PrivateKey string `json:"privateKey"`
-}
-
-func ReadJuryKeys() ([]string, []string) {
-	juryPrivateKeys := []string{}
-	juryPublicKeys := []string{}
-
-	// Define the directory containing the key files
-	dir := "config/keys"
-
-	// Read all files in the directory
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		log.Fatalf("Failed to read directory: %v", err)
-	}
-
-	// Iterate over each file
-	for _, file := range files {
-		// Construct the full file path
-		filePath := filepath.Join(dir, file.Name())
-
-		// Open the file
-		jsonFile, err := os.Open(filePath)
-		if err != nil {
-			log.Printf("Failed to open file %s: %v", filePath, err)
-			continue
-		}
-
-		// Read the file contents
-		byteValue, err := io.ReadAll(jsonFile)
-		if err != nil {
-			log.Printf("Failed to read file %s: %v", filePath, err)
-			jsonFile.Close()
-			continue
-		}
-
-		// Close the file
-		jsonFile.Close()
-
-		// Parse the JSON
-		var keyData KeyData
-		err = json.Unmarshal(byteValue, &keyData)
-		if err != nil {
-			log.Printf("Failed to parse JSON from file %s: %v", filePath, err)
-			continue
-		}
-
-		// Append the keys to the respective slices
-		juryPrivateKeys = append(juryPrivateKeys, keyData.PrivateKey)
-		juryPublicKeys = append(juryPublicKeys, keyData.PublicKey)
-	}
-
-	return juryPrivateKeys, juryPublicKeys
-}
@@ -4,7 +4,7 @@ pragma solidity >=0.6.10 <0.8.20;
 contract DecisionStorage {
     // 决策记录结构
     struct Decision {
-        string evidence;      // 证据
+        string evidence;      // 证据承诺(加盐哈希), 证据原文保存在链下
         string nodeID;        // 节点ID
         uint256 timestamp;    // 时间戳
         bool approved;        // 是否批准
@@ -0,0 +1,328 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hufu/keyprovider"
+	"hufu/model"
+	"hufu/utils"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// 异常交易证据的签名格式版本
+const (
+	AbnormalEvidenceV1      = 1 // 按字段顺序序列化的 JSON
+	AbnormalEvidenceVersion = 2 // JCS 规范化的证据文档, 带服务端时间戳
+)
+
+// AbnormalEvidenceDocument TEE 签名的异常交易证据文档
+// 签名内容为文档的 JCS 规范化编码, 服务端时间戳覆盖不含 Timestamp 字段的文档摘要
+type AbnormalEvidenceDocument struct {
+	Version         int               `json:"version"`
+	KeyID           string            `json:"key_id"`
+	TransactionID   uint              `json:"transaction_id"`
+	WalletID        uint              `json:"wallet_id"`
+	TransactionHash string            `json:"transaction_hash"` // 交易记录的 sha256, 见 TransactionHash
+	Rule            string            `json:"rule"`             // 命中的监管规则
+	Reason          string            `json:"reason"`
+	Inputs          map[string]string `json:"inputs"` // 规则触发时的输入值
+	Timestamp       *ServerTimestamp  `json:"timestamp,omitempty"`
+}
+
+// transactionDigest 交易记录中参与哈希的字段
+type transactionDigest struct {
+	ID           uint   `json:"id"`
+	FromWalletID uint   `json:"from_wallet_id"`
+	ToWalletID   uint   `json:"to_wallet_id"`
+	Amount       string `json:"amount"`
+	Type         string `json:"type"`
+}
+
+// AbnormalEvidence v1 版本的异常交易证据字段
+// 签名内容为该结构按字段顺序序列化得到的 JSON, 金额固定保留8位小数
+type AbnormalEvidence struct {
+	Version       int    `json:"version"`
+	KeyID         string `json:"key_id"`
+	TransactionID uint   `json:"transaction_id"`
+	WalletID      uint   `json:"wallet_id"`
+	FromWalletID  uint   `json:"from_wallet_id"`
+	ToWalletID    uint   `json:"to_wallet_id"`
+	Amount        string `json:"amount"`
+	Reason        string `json:"reason"`
+	Time          string `json:"time"`
+}
+
+// AbnormalVerification 异常交易签名的验证结果
+type AbnormalVerification struct {
+	ID            uint                      `json:"id"`
+	TransactionID uint                      `json:"transaction_id"`
+	KeyID         string                    `json:"key_id"`
+	Version       int                       `json:"version"`
+	Legacy        bool                      `json:"legacy"` // 旧版 fmt.Sprintf 文本证据
+	Valid         bool                      `json:"valid"`
+	Error         string                    `json:"error,omitempty"`
+	Evidence      *AbnormalEvidence         `json:"evidence,omitempty"`
+	Document      *AbnormalEvidenceDocument `json:"document,omitempty"`
+	SignedAt      string                    `json:"signed_at,omitempty"` // 服务端时间戳中的数据库时间
+}
+
+// FormatEvidenceAmount 按签名格式输出金额
+func FormatEvidenceAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 8, 64)
+}
+
+// teeSigningKey 当前 TEE 签名密钥
+func teeSigningKey() (*keyprovider.Key, error) {
+	return keyprovider.Current(keyprovider.NameTeeSigning)
+}
+
+// teeVerifyKeys 所有可用于验签的 TEE 公钥, 包括轮换下来的旧公钥, 键为密钥ID
+func teeVerifyKeys() map[string]string {
+	return keyprovider.VerifyKeys(keyprovider.NameTeeSigning)
+}
+
+// TransactionHash 计算交易记录的哈希, 状态和时间不参与计算
+func TransactionHash(t *model.Transaction) (string, error) {
+	data, err := utils.CanonicalJSON(transactionDigest{
+		ID:           t.ID,
+		FromWalletID: t.FromWalletID,
+		ToWalletID:   t.ToWalletID,
+		Amount:       FormatEvidenceAmount(t.Amount),
+		Type:         string(t.Type),
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// documentDigest 不含服务端时间戳的证据文档摘要
+func documentDigest(doc AbnormalEvidenceDocument) ([]byte, error) {
+	doc.Timestamp = nil
+	data, err := utils.CanonicalJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// NewAbnormalTransaction 为已保存的交易生成经 TEE 密钥签名的异常交易记录, 由调用方在同一事务 tx 中保存
+func NewAbnormalTransaction(tx *gorm.DB, t *model.Transaction, walletID uint, violation *RuleViolation) (*model.AbnormalTransaction, error) {
+	signingKey, err := teeSigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tee public key: %v", err)
+	}
+	txHash, err := TransactionHash(t)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := violation.Inputs
+	if inputs == nil {
+		inputs = map[string]string{}
+	}
+	doc := AbnormalEvidenceDocument{
+		Version:         AbnormalEvidenceVersion,
+		KeyID:           signingKey.ID,
+		TransactionID:   t.ID,
+		WalletID:        walletID,
+		TransactionHash: txHash,
+		Rule:            violation.Rule,
+		Reason:          violation.Message,
+		Inputs:          inputs,
+	}
+
+	digest, err := documentDigest(doc)
+	if err != nil {
+		return nil, err
+	}
+	doc.Timestamp, err = IssueServerTimestamp(tx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := utils.CanonicalJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用 TEE 的私钥对规范化编码进行签名
+	signature, err := utils.SignData(signingKey.PrivateKey, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AbnormalTransaction{
+		WalletID:      walletID,
+		TransactionID: t.ID,
+		Evidence:      string(data),
+		Signature:     signature,
+		KeyID:         signingKey.ID,
+	}, nil
+}
+
+// RecordRuleViolation 在事务中保存失败的交易记录和对应的异常交易证据
+func RecordRuleViolation(from, to *model.Wallet, amount float64, violation *RuleViolation) (*model.AbnormalTransaction, error) {
+	var abnormal *model.AbnormalTransaction
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		failedTx := &model.Transaction{
+			FromWalletID: from.ID,
+			ToWalletID:   to.ID,
+			Amount:       amount,
+			Type:         model.DirectTransaction,
+			Status:       TransactionStatusFailed,
+		}
+		if err := tx.Create(failedTx).Error; err != nil {
+			return err
+		}
+
+		var err error
+		abnormal, err = NewAbnormalTransaction(tx, failedTx, from.ID, violation)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(abnormal).Error; err != nil {
+			return err
+		}
+		return freezeOnRuleViolations(tx, from.ID)
+	})
+	return abnormal, err
+}
+
+// VerifyAbnormalRecord 验证异常交易记录的 TEE 签名, 并检查签名内容与记录一致
+func VerifyAbnormalRecord(abnormal *model.AbnormalTransaction) *AbnormalVerification {
+	result := &AbnormalVerification{
+		ID:            abnormal.ID,
+		TransactionID: abnormal.TransactionID,
+		KeyID:         abnormal.KeyID,
+		Legacy:        abnormal.KeyID == "",
+	}
+	keys := teeVerifyKeys()
+
+	// 旧版记录没有密钥ID, 依次尝试所有已知公钥
+	if result.Legacy {
+		for id, key := range keys {
+			if valid, err := utils.VerifySignature(key, abnormal.Evidence, abnormal.Signature); err == nil && valid {
+				result.KeyID = id
+				result.Valid = true
+				return result
+			}
+		}
+		result.Error = "signature does not match any known tee key"
+		return result
+	}
+
+	key, ok := keys[abnormal.KeyID]
+	if !ok {
+		result.Error = fmt.Sprintf("unknown tee key id %q", abnormal.KeyID)
+		return result
+	}
+
+	valid, err := utils.VerifySignature(key, abnormal.Evidence, abnormal.Signature)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if !valid {
+		result.Error = "invalid signature"
+		return result
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(abnormal.Evidence), &header); err != nil {
+		result.Error = fmt.Sprintf("invalid evidence encoding: %v", err)
+		return result
+	}
+	result.Version = header.Version
+	if header.Version == AbnormalEvidenceV1 {
+		verifyAbnormalEvidenceV1(abnormal, result)
+	} else {
+		verifyAbnormalEvidenceDocument(abnormal, result)
+	}
+	return result
+}
+
+// verifyAbnormalEvidenceDocument 检查 v2 证据文档的规范化编码, 时间戳和交易哈希
+func verifyAbnormalEvidenceDocument(abnormal *model.AbnormalTransaction, result *AbnormalVerification) {
+	var doc AbnormalEvidenceDocument
+	if err := json.Unmarshal([]byte(abnormal.Evidence), &doc); err != nil {
+		result.Error = fmt.Sprintf("invalid evidence encoding: %v", err)
+		return
+	}
+	result.Document = &doc
+
+	canonical, err := utils.CanonicalJSON(doc)
+	if err != nil || string(canonical) != abnormal.Evidence {
+		result.Error = "evidence is not canonically encoded"
+		return
+	}
+	if doc.Version != AbnormalEvidenceVersion || doc.KeyID != abnormal.KeyID ||
+		doc.TransactionID != abnormal.TransactionID || doc.WalletID != abnormal.WalletID {
+		result.Error = "signed evidence does not match record"
+		return
+	}
+
+	digest, err := documentDigest(doc)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	if err := VerifyServerTimestamp(doc.Timestamp, digest); err != nil {
+		result.Error = err.Error()
+		return
+	}
+	result.SignedAt = doc.Timestamp.Time
+
+	// 证据必须能对应到真实的交易记录
+	var t model.Transaction
+	if err := model.DB.Where("id = ?", doc.TransactionID).First(&t).Error; err != nil {
+		result.Error = fmt.Sprintf("transaction %d not found", doc.TransactionID)
+		return
+	}
+	txHash, err := TransactionHash(&t)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	if txHash != doc.TransactionHash {
+		result.Error = "transaction hash mismatch"
+		return
+	}
+
+	result.Valid = true
+}
+
+// verifyAbnormalEvidenceV1 检查 v1 证据字段与记录一致
+func verifyAbnormalEvidenceV1(abnormal *model.AbnormalTransaction, result *AbnormalVerification) {
+	var evidence AbnormalEvidence
+	if err := json.Unmarshal([]byte(abnormal.Evidence), &evidence); err != nil {
+		result.Error = fmt.Sprintf("invalid evidence encoding: %v", err)
+		return
+	}
+	result.Evidence = &evidence
+
+	// 签名内容必须与记录本身绑定, 防止把其他交易的证据挪用过来
+	if evidence.KeyID != abnormal.KeyID || evidence.TransactionID != abnormal.TransactionID || evidence.WalletID != abnormal.WalletID {
+		result.Error = "signed evidence does not match record"
+		return
+	}
+
+	result.Valid = true
+}
+
+// VerifyAbnormalTransaction 根据ID验证异常交易记录
+func VerifyAbnormalTransaction(id uint) (*AbnormalVerification, error) {
+	var abnormal model.AbnormalTransaction
+	if err := model.DB.Where("id = ?", id).First(&abnormal).Error; err != nil {
+		return nil, err
+	}
+	return VerifyAbnormalRecord(&abnormal), nil
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"hufu/utils"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTokenTTL   = 2 * time.Hour
+	minJWTSecretSize  = 32
+	minPasswordLength = 8
+
+	// DefaultJWTSecretEnv 保存令牌签名密钥的环境变量
+	DefaultJWTSecretEnv = "HUFU_JWT_SECRET"
+	// 旧版 config.yaml 中提交的示例密钥, 任何人都可以用它签发令牌
+	exampleJWTSecret = "change-me-to-a-random-secret-of-32-bytes"
+)
+
+// ValidAccountRole 检查角色是否有效
+func ValidAccountRole(role model.AccountRole) bool {
+	switch role {
+	case model.RoleWalletOwner, model.RoleOperator, model.RoleRegulator, model.RoleJuryAdmin:
+		return true
+	}
+	return false
+}
+
+func tokenTTL() time.Duration {
+	if s := config.GlobalConfig.Auth.TokenTTLSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultTokenTTL
+}
+
+// jwtSecret 从环境变量读取令牌签名密钥, 启动时由 EnsureBootstrapAccount 检查
+func jwtSecret() ([]byte, error) {
+	env := config.GlobalConfig.Auth.JWTSecretEnv
+	if env == "" {
+		env = DefaultJWTSecretEnv
+	}
+	secret := os.Getenv(env)
+	switch {
+	case secret == "":
+		return nil, fmt.Errorf("jwt secret is not set, export %s", env)
+	case secret == exampleJWTSecret:
+		return nil, fmt.Errorf("%s must not be the example secret, generate one with openssl rand -hex 32", env)
+	case len(secret) < minJWTSecretSize:
+		return nil, fmt.Errorf("%s must be at least %d bytes", env, minJWTSecretSize)
+	}
+	return []byte(secret), nil
+}
+
+// CreateAccount 创建账号, 密码以 bcrypt 保存
+func CreateAccount(username, password string, role model.AccountRole) (*model.Account, error) {
+	if username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if !ValidAccountRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+
+	var count int64
+	if err := model.DB.Model(&model.Account{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.ErrAccountExists
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	account := &model.Account{
+		Username:     username,
+		PasswordHash: string(hash),
+		Role:         role,
+	}
+	if err := model.DB.Create(account).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetAccountByID 根据ID获取账号
+func GetAccountByID(id uint) (*model.Account, error) {
+	var account model.Account
+	if err := model.DB.First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Login 校验用户名和密码, 签发令牌
+func Login(username, password string) (*model.Account, string, time.Time, error) {
+	var account model.Account
+	if err := model.DB.Where("username = ?", username).First(&account).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "", time.Time{}, errors.ErrInvalidCredentials
+		}
+		return nil, "", time.Time{}, err
+	}
+	if account.Disabled {
+		return nil, "", time.Time{}, errors.ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return nil, "", time.Time{}, errors.ErrInvalidCredentials
+	}
+
+	token, expiresAt, err := IssueToken(&account)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return &account, token, expiresAt, nil
+}
+
+// IssueToken 为账号签发令牌
+func IssueToken(account *model.Account) (string, time.Time, error) {
+	secret, err := jwtSecret()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(tokenTTL())
+	token, err := utils.SignJWT(&utils.JWTClaims{
+		Subject:   strconv.FormatUint(uint64(account.ID), 10),
+		Role:      string(account.Role),
+		Version:   account.TokenVersion,
+		Issuer:    config.GlobalConfig.Auth.Issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}, secret)
+	return token, expiresAt, err
+}
+
+// AuthenticateToken 校验令牌并返回对应的账号, 账号被禁用或令牌已注销时返回 ErrUnauthorized
+func AuthenticateToken(token string) (*model.Account, error) {
+	secret, err := jwtSecret()
+	if err != nil {
+		return nil, err
+	}
+	claims, err := utils.ParseJWT(token, secret, config.GlobalConfig.Auth.Issuer)
+	if err != nil {
+		return nil, errors.ErrUnauthorized
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return nil, errors.ErrUnauthorized
+	}
+	account, err := GetAccountByID(uint(id))
+	if err != nil {
+		return nil, errors.ErrUnauthorized
+	}
+	if account.Disabled || account.TokenVersion != claims.Version || string(account.Role) != claims.Role {
+		return nil, errors.ErrUnauthorized
+	}
+	return account, nil
+}
+
+// Logout 使账号已签发的令牌全部失效
+func Logout(account *model.Account) error {
+	return model.DB.Model(account).Update("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+// EnsureBootstrapAccount 没有任何运营账号时按配置创建一个
+func EnsureBootstrapAccount() error {
+	if _, err := jwtSecret(); err != nil {
+		return err
+	}
+
+	bootstrap := config.GlobalConfig.Auth.Bootstrap
+	var count int64
+	if err := model.DB.Model(&model.Account{}).Where("role = ?", model.RoleOperator).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if bootstrap.Username == "" || bootstrap.Password == "" {
+		log.Printf("no operator account exists, set auth.bootstrap to create one")
+		return nil
+	}
+	if _, err := CreateAccount(bootstrap.Username, bootstrap.Password, model.RoleOperator); err != nil {
+		return fmt.Errorf("failed to create bootstrap operator: %v", err)
+	}
+	log.Printf("created bootstrap operator account %s", bootstrap.Username)
+	return nil
+}
+
+// CanAccessWallet 运营人员可以操作所有钱包, 钱包持有人只能操作自己的钱包
+func CanAccessWallet(account *model.Account, walletID uint) error {
+	if account.Role == model.RoleOperator {
+		return nil
+	}
+	if account.Role != model.RoleWalletOwner {
+		return errors.ErrForbidden
+	}
+	wallet, err := GetWalletByID(walletID)
+	if err != nil {
+		return errors.ErrForbidden
+	}
+	if wallet.AccountID != account.ID {
+		return errors.ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"hufu/config"
+	"strings"
+	"testing"
+)
+
+func TestJWTSecretFromEnvironment(t *testing.T) {
+	previousConfig := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = previousConfig })
+	config.GlobalConfig.Auth.JWTSecretEnv = ""
+
+	tests := []struct {
+		name   string
+		secret string
+		want   string
+	}{
+		{name: "unset", secret: "", want: "not set"},
+		{name: "example", secret: exampleJWTSecret, want: "example secret"},
+		{name: "short", secret: "too-short", want: "at least"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(DefaultJWTSecretEnv, tt.secret)
+			if _, err := jwtSecret(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("jwtSecret() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	config.GlobalConfig.Auth.JWTSecretEnv = "HUFU_TEST_JWT_SECRET"
+	secret := strings.Repeat("k", minJWTSecretSize)
+	t.Setenv("HUFU_TEST_JWT_SECRET", secret)
+	got, err := jwtSecret()
+	if err != nil || string(got) != secret {
+		t.Fatalf("jwtSecret() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"hufu/model"
+	"hufu/utils"
+	"log"
+	"time"
+
+	"github.com/SSSaaS/sssa-golang"
+)
+
+// ApplicationFilter 申请记录查询条件
+type ApplicationFilter struct {
+	WalletID  uint   `json:"wallet_id"`
+	Status    string `json:"status"`
+	Requester string `json:"requester"`
+}
+
+// CreateApplication 保存证据附件并创建待处理的申请
+func CreateApplication(walletID uint, requester, fileName string, content []byte) (*model.RegulatorApplication, error) {
+	blob, err := StoreBlob(content)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &model.RegulatorApplication{
+		WalletID:    walletID,
+		Requester:   requester,
+		Status:      model.ApplicationPending,
+		SubmittedAt: time.Now(),
+		Attachments: []model.ApplicationAttachment{
+			{
+				BlobHash:    blob.Hash,
+				FileName:    fileName,
+				ContentType: blob.ContentType,
+				Size:        blob.Size,
+			},
+		},
+	}
+	if err := model.DB.Create(app).Error; err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// ProcessApplication 将已校验的证据文档交由陪审团决策, 批准节点足够时恢复私钥
+func ProcessApplication(app *model.RegulatorApplication, doc *model.EvidenceDocument) (string, []string, error) {
+	evidence, err := json.Marshal(doc)
+	if err != nil {
+		abortApplication(app, model.ApplicationFailed, err.Error())
+		return "", nil, err
+	}
+
+	record, err := SaveEvidence(app.WalletID, string(evidence))
+	if err != nil {
+		abortApplication(app, model.ApplicationFailed, err.Error())
+		return "", nil, err
+	}
+
+	if app.Requester == "" {
+		app.Requester = doc.Requester.Name
+	}
+	app.EvidenceRef = record.Ref
+	app.DecisionPayload = EvidencePayload(record)
+	if err := model.DB.Save(app).Error; err != nil {
+		return "", nil, err
+	}
+
+	shares, err := ProcessPrivateKey(app.WalletID, record)
+	if err != nil {
+		abortApplication(app, model.ApplicationFailed, err.Error())
+		return "", nil, err
+	}
+
+	app.ApprovedNodes = len(shares)
+	if len(shares) < utils.MINIMUM {
+		abortApplication(app, model.ApplicationRejected, fmt.Sprintf("批准节点不足: %d/%d", len(shares), utils.MINIMUM))
+		return "", shares, fmt.Errorf("insufficient jury approvals: %d/%d", len(shares), utils.MINIMUM)
+	}
+
+	pk, err := sssa.Combine(shares)
+	if err != nil {
+		abortApplication(app, model.ApplicationFailed, err.Error())
+		return "", nil, err
+	}
+
+	if err := finishApplication(app, model.ApplicationApproved, ""); err != nil {
+		return "", nil, err
+	}
+	// 私钥已恢复, 冻结失败不影响本次申请的结果, 记录日志由运营人员补冻
+	if err := freezeOnJuryApproval(app); err != nil {
+		log.Printf("failed to freeze wallet %d after approved application %d: %v", app.WalletID, app.ID, err)
+	}
+	return pk, shares, nil
+}
+
+// FailApplication 将申请标记为处理失败
+func FailApplication(app *model.RegulatorApplication, reason string) error {
+	return finishApplication(app, model.ApplicationFailed, reason)
+}
+
+// abortApplication 结束处理中断的申请, 调用方返回的是中断原因, 状态保存失败只能记录日志
+func abortApplication(app *model.RegulatorApplication, status model.ApplicationStatus, reason string) {
+	if err := finishApplication(app, status, reason); err != nil {
+		log.Printf("failed to mark application %d as %s: %v", app.ID, status, err)
+	}
+}
+
+func finishApplication(app *model.RegulatorApplication, status model.ApplicationStatus, reason string) error {
+	now := time.Now()
+	app.Status = status
+	app.DecidedAt = &now
+	app.FailureReason = reason
+	return model.DB.Save(app).Error
+}
+
+// ListApplications 分页查询申请记录
+func ListApplications(filter ApplicationFilter, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.RegulatorApplication{})
+	if filter.WalletID != 0 {
+		query = query.Where("wallet_id = ?", filter.WalletID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Requester != "" {
+		query = query.Where("requester = ?", filter.Requester)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var applications []model.RegulatorApplication
+	if err := query.Preload("Attachments").
+		Order("submitted_at DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&applications).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     applications,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
@@ -0,0 +1,383 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReasonInitialFunding 系统为代理钱包注资的原因代码
+const ReasonInitialFunding = "initial_funding"
+
+// balanceReasonCodes 每种余额操作允许的原因代码
+var balanceReasonCodes = map[model.BalanceOperationType][]string{
+	model.BalanceDeposit:    {"cash_deposit", "bank_transfer", ReasonInitialFunding},
+	model.BalanceWithdrawal: {"cash_withdrawal", "bank_transfer"},
+	model.BalanceAdjustment: {"correction", "fee", "interest", "compensation"},
+	model.BalanceReversal:   {"duplicate", "operator_error", "fraud", "customer_request"},
+}
+
+// BalanceOperationRequest 余额操作请求
+// 入金和出金的 Amount 为正数; 调账的 Amount 为对余额的变动, 可正可负; 冲正以 OperationID 指定原操作, 不需要 Amount
+type BalanceOperationRequest struct {
+	WalletID    uint    `json:"wallet_id"`
+	Amount      float64 `json:"amount"`
+	OperationID uint    `json:"operation_id"`
+	ReasonCode  string  `json:"reason_code" binding:"required"`
+	Memo        string  `json:"memo"`
+}
+
+// BalanceOperationFilter 余额操作查询条件
+type BalanceOperationFilter struct {
+	WalletID uint   `json:"wallet_id"`
+	Status   string `json:"status"`
+	Type     string `json:"type"`
+}
+
+// BalanceReasonCodes 返回每种操作允许的原因代码
+func BalanceReasonCodes() map[model.BalanceOperationType][]string {
+	return balanceReasonCodes
+}
+
+func validReasonCode(opType model.BalanceOperationType, code string) bool {
+	for _, allowed := range balanceReasonCodes[opType] {
+		if allowed == code {
+			return true
+		}
+	}
+	return false
+}
+
+// requiresApproval 按配置判断操作是否需要另一名运营人员审批
+func requiresApproval(amount float64) bool {
+	cfg := config.GlobalConfig.Balance
+	return cfg.RequireApproval && math.Abs(amount) >= cfg.ApprovalThreshold
+}
+
+// RequestBalanceOperation 发起余额操作, 不需要审批时直接执行, 否则等待审批
+func RequestBalanceOperation(opType model.BalanceOperationType, req *BalanceOperationRequest, requester *model.Account) (*model.BalanceOperation, error) {
+	if !validReasonCode(opType, req.ReasonCode) {
+		return nil, errors.ErrReasonCodeInvalid
+	}
+
+	op := &model.BalanceOperation{
+		WalletID:    req.WalletID,
+		Type:        opType,
+		ReasonCode:  req.ReasonCode,
+		Memo:        req.Memo,
+		Status:      model.BalancePending,
+		RequestedBy: requester.ID,
+	}
+	switch opType {
+	case model.BalanceDeposit:
+		if req.Amount <= 0 {
+			return nil, fmt.Errorf("amount must be positive")
+		}
+		op.Amount = req.Amount
+	case model.BalanceWithdrawal:
+		if req.Amount <= 0 {
+			return nil, fmt.Errorf("amount must be positive")
+		}
+		op.Amount = -req.Amount
+	case model.BalanceAdjustment:
+		if req.Amount == 0 {
+			return nil, fmt.Errorf("amount must not be zero")
+		}
+		op.Amount = req.Amount
+	case model.BalanceReversal:
+		original, err := reversibleOperation(model.DB, req.OperationID)
+		if err != nil {
+			return nil, err
+		}
+		op.WalletID = original.WalletID
+		op.Amount = -original.Amount
+		op.ReversalOf = &original.ID
+	default:
+		return nil, fmt.Errorf("unknown balance operation %q", opType)
+	}
+
+	if _, err := GetWalletByID(op.WalletID); err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+
+	if requiresApproval(op.Amount) {
+		if err := model.DB.Create(op).Error; err != nil {
+			return nil, err
+		}
+		return op, nil
+	}
+
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(op).Error; err != nil {
+			return err
+		}
+		return applyBalanceOperation(tx, op, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// SystemDeposit 系统发起的入金, 不经过审批, 用于初始化代理钱包
+func SystemDeposit(walletID uint, amount float64, reasonCode string) (*model.BalanceOperation, error) {
+	op := &model.BalanceOperation{
+		WalletID:   walletID,
+		Type:       model.BalanceDeposit,
+		Amount:     amount,
+		ReasonCode: reasonCode,
+		Status:     model.BalancePending,
+	}
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(op).Error; err != nil {
+			return err
+		}
+		return applyBalanceOperation(tx, op, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// ApproveBalanceOperation 审批并执行待处理的操作, 审批人不能是发起人
+// 执行失败(如余额不足)时操作标记为 failed
+func ApproveBalanceOperation(id uint, approver *model.Account) (*model.BalanceOperation, error) {
+	op, err := pendingBalanceOperation(id, approver)
+	if err != nil {
+		return nil, err
+	}
+
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if op.ReversalOf != nil {
+			if _, err := reversibleOperation(tx, *op.ReversalOf); err != nil {
+				return err
+			}
+		}
+		return applyBalanceOperation(tx, op, approver.ID)
+	})
+	if err != nil {
+		// 并发审批已执行时条件更新不生效, 其余业务错误将操作标记为失败
+		if hufuErr, ok := err.(*errors.HufuError); ok {
+			if failErr := finishBalanceOperation(op, model.BalanceFailed, approver.ID, hufuErr.Message); failErr != nil && failErr != errors.ErrBalanceOperationState {
+				return nil, failErr
+			}
+		}
+		return nil, err
+	}
+	return op, nil
+}
+
+// RejectBalanceOperation 拒绝待处理的操作
+func RejectBalanceOperation(id uint, approver *model.Account, reason string) (*model.BalanceOperation, error) {
+	op, err := pendingBalanceOperation(id, approver)
+	if err != nil {
+		return nil, err
+	}
+	if err := finishBalanceOperation(op, model.BalanceRejected, approver.ID, reason); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// pendingBalanceOperation 获取待审批的操作并检查审批人
+func pendingBalanceOperation(id uint, approver *model.Account) (*model.BalanceOperation, error) {
+	var op model.BalanceOperation
+	if err := model.DB.First(&op, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrBalanceOperationNotFound
+		}
+		return nil, err
+	}
+	if op.Status != model.BalancePending {
+		return nil, errors.ErrBalanceOperationState
+	}
+	if op.RequestedBy == approver.ID {
+		return nil, errors.ErrSelfApproval
+	}
+	return &op, nil
+}
+
+// reversibleOperation 检查操作可以冲正: 已执行, 本身不是冲正, 且没有进行中或已执行的冲正
+// 在事务中调用时锁定原操作, 同一操作的多个冲正只能依次审批, 后审批的能看到先执行的冲正
+func reversibleOperation(db *gorm.DB, id uint) (*model.BalanceOperation, error) {
+	var original model.BalanceOperation
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&original, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrBalanceOperationNotFound
+		}
+		return nil, err
+	}
+	if original.Status != model.BalanceApplied || original.Type == model.BalanceReversal {
+		return nil, errors.ErrBalanceOperationState
+	}
+
+	// 加锁读取最新提交的数据, 不使用事务开始时的快照
+	var count int64
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&model.BalanceOperation{}).
+		Where("reversal_of = ? AND status = ?", id, model.BalanceApplied).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.ErrBalanceOperationState
+	}
+	return &original, nil
+}
+
+// applyBalanceOperation 锁定钱包, 修改余额并记账, 操作必须处于 pending 状态
+func applyBalanceOperation(tx *gorm.DB, op *model.BalanceOperation, approverID uint) error {
+	now := time.Now()
+	// 条件更新保证同一操作只会执行一次
+	result := tx.Model(&model.BalanceOperation{}).
+		Where("id = ? AND status = ?", op.ID, model.BalancePending).
+		Updates(map[string]interface{}{"status": model.BalanceApplied, "approved_by": approverID, "decided_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrBalanceOperationState
+	}
+
+	var wallet model.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&wallet, op.WalletID).Error; err != nil {
+		return errors.ErrWalletNotFound
+	}
+	// 转出类操作受冻结限制, 注销中和已注销的钱包不能有任何余额变动
+	// 冲正是运营人员的更正, 冻结的钱包也可以冲正入金
+	if op.Amount < 0 && op.Type != model.BalanceReversal {
+		if err := CheckWalletCanSend(&wallet); err != nil {
+			return err
+		}
+	} else if err := CheckWalletCanReceive(&wallet); err != nil {
+		return err
+	}
+	balance := wallet.Balance + op.Amount
+	if balance < 0 || (op.Amount < 0 && balance < wallet.HeldBalance) {
+		return errors.ErrInsufficientBalance
+	}
+	if err := tx.Model(&wallet).Update("balance", balance).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Create(&model.LedgerEntry{
+		WalletID:     op.WalletID,
+		OperationID:  &op.ID,
+		Type:         op.Type,
+		Amount:       op.Amount,
+		BalanceAfter: balance,
+		ReasonCode:   op.ReasonCode,
+	}).Error; err != nil {
+		return err
+	}
+
+	op.Status = model.BalanceApplied
+	op.ApprovedBy = approverID
+	op.DecidedAt = &now
+	return nil
+}
+
+// recordTransferLedger 为转账双方各写一条流水, fromBalance 和 toBalance 为更新后的余额
+func recordTransferLedger(tx *gorm.DB, t *model.Transaction, fromBalance, toBalance float64) error {
+	return tx.Create([]*model.LedgerEntry{
+		{
+			WalletID:      t.FromWalletID,
+			TransactionID: &t.ID,
+			Type:          model.LedgerTransferOut,
+			Amount:        -t.Amount,
+			BalanceAfter:  fromBalance,
+			ReasonCode:    string(t.Type),
+		},
+		{
+			WalletID:      t.ToWalletID,
+			TransactionID: &t.ID,
+			Type:          model.LedgerTransferIn,
+			Amount:        t.Amount,
+			BalanceAfter:  toBalance,
+			ReasonCode:    string(t.Type),
+		},
+	}).Error
+}
+
+func finishBalanceOperation(op *model.BalanceOperation, status model.BalanceOperationStatus, approverID uint, reason string) error {
+	now := time.Now()
+	result := model.DB.Model(&model.BalanceOperation{}).
+		Where("id = ? AND status = ?", op.ID, model.BalancePending).
+		Updates(map[string]interface{}{"status": status, "approved_by": approverID, "decided_at": now, "failure_reason": reason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrBalanceOperationState
+	}
+	op.Status = status
+	op.ApprovedBy = approverID
+	op.DecidedAt = &now
+	op.FailureReason = reason
+	return nil
+}
+
+// ListBalanceOperations 分页查询余额操作
+func ListBalanceOperations(filter BalanceOperationFilter, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.BalanceOperation{})
+	if filter.WalletID != 0 {
+		query = query.Where("wallet_id = ?", filter.WalletID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var operations []model.BalanceOperation
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&operations).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     operations,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// ListLedgerEntries 分页查询钱包的余额流水
+func ListLedgerEntries(walletID uint, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.LedgerEntry{}).Where("wallet_id = ?", walletID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var entries []model.LedgerEntry
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     entries,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
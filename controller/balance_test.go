@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"hufu/model"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func setupBalanceDB(t *testing.T) (*model.Wallet, *model.Wallet) {
+	t.Helper()
+	setupTestDB(t, &model.Wallet{}, &model.Transaction{}, &model.BalanceOperation{}, &model.LedgerEntry{})
+	a := &model.Wallet{UserID: 1, Username: "alice"}
+	b := &model.Wallet{UserID: 2, Username: "bob"}
+	if err := model.DB.Create([]*model.Wallet{a, b}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+// assertLedgerReconciles 最新一条流水的 balance_after 与钱包余额一致
+func assertLedgerReconciles(t *testing.T, walletID uint) {
+	t.Helper()
+	var wallet model.Wallet
+	if err := model.DB.First(&wallet, walletID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var entry model.LedgerEntry
+	if err := model.DB.Where("wallet_id = ?", walletID).Order("id DESC").First(&entry).Error; err != nil {
+		t.Fatalf("no ledger entry for wallet %d: %v", walletID, err)
+	}
+	if entry.BalanceAfter != wallet.Balance {
+		t.Fatalf("wallet %d balance_after = %v, balance = %v", walletID, entry.BalanceAfter, wallet.Balance)
+	}
+}
+
+func TestLedgerReconcilesAfterTransfer(t *testing.T) {
+	a, b := setupBalanceDB(t)
+	if _, err := SystemDeposit(a.ID, 100, "cash_deposit"); err != nil {
+		t.Fatalf("SystemDeposit() error = %v", err)
+	}
+	if _, err := NormalTransfer(a, b, 40); err != nil {
+		t.Fatalf("NormalTransfer() error = %v", err)
+	}
+	assertLedgerReconciles(t, a.ID)
+	assertLedgerReconciles(t, b.ID)
+
+	var entries []model.LedgerEntry
+	if err := model.DB.Where("wallet_id = ?", a.ID).Order("id").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Type != model.LedgerTransferOut || entries[1].Amount != -40 {
+		t.Fatalf("entries = %+v, want deposit then transfer_out of -40", entries)
+	}
+}
+
+func TestReverseDepositOnFrozenWallet(t *testing.T) {
+	a, _ := setupBalanceDB(t)
+	deposit, err := SystemDeposit(a.ID, 100, "cash_deposit")
+	if err != nil {
+		t.Fatalf("SystemDeposit() error = %v", err)
+	}
+	if err := model.DB.Model(a).Update("status", model.WalletFrozen).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	operator := &model.Account{Model: gorm.Model{ID: 1}}
+	if _, err := RequestBalanceOperation(model.BalanceWithdrawal, &BalanceOperationRequest{WalletID: a.ID, Amount: 10, ReasonCode: "cash_withdrawal"}, operator); err == nil {
+		t.Fatal("withdrawal from a frozen wallet succeeded")
+	}
+	reversal, err := RequestBalanceOperation(model.BalanceReversal, &BalanceOperationRequest{OperationID: deposit.ID, ReasonCode: "operator_error"}, operator)
+	if err != nil {
+		t.Fatalf("reversal error = %v", err)
+	}
+	if reversal.Status != model.BalanceApplied {
+		t.Fatalf("reversal status = %s, want applied", reversal.Status)
+	}
+	assertLedgerReconciles(t, a.ID)
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultBlobDir     = "./evidence/blobs"
+	defaultBlobMaxSize = 1 << 20
+)
+
+var defaultBlobTypes = []string{"text/plain", "application/json", "application/pdf"}
+
+// BlobMaxSize 获取附件大小上限
+func BlobMaxSize() int64 {
+	if config.GlobalConfig.Evidence.MaxSize > 0 {
+		return config.GlobalConfig.Evidence.MaxSize
+	}
+	return defaultBlobMaxSize
+}
+
+func blobDir() string {
+	if config.GlobalConfig.Evidence.BlobDir != "" {
+		return config.GlobalConfig.Evidence.BlobDir
+	}
+	return defaultBlobDir
+}
+
+func evidenceTypes() []string {
+	if len(config.GlobalConfig.Evidence.AllowedTypes) > 0 {
+		return config.GlobalConfig.Evidence.AllowedTypes
+	}
+	return defaultBlobTypes
+}
+
+func blobTypeAllowed(contentType string, allowed []string) bool {
+	for _, t := range allowed {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// detectContentType 根据内容识别附件类型, 去掉 charset 等参数
+func detectContentType(content []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(content))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	// 文本类 JSON 会被识别为 text/plain, 按首字符区分
+	if mediaType == "text/plain" {
+		for _, b := range content {
+			if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+				continue
+			}
+			if b == '{' || b == '[' {
+				return "application/json"
+			}
+			break
+		}
+	}
+	return mediaType
+}
+
+// StoreBlob 以内容哈希为地址保存证据附件, 相同内容只保存一份
+func StoreBlob(content []byte) (*model.EvidenceBlob, error) {
+	return storeBlob(content, BlobMaxSize(), evidenceTypes())
+}
+
+// storeBlob 检查大小和类型后保存附件
+func storeBlob(content []byte, maxSize int64, allowedTypes []string) (*model.EvidenceBlob, error) {
+	if int64(len(content)) > maxSize {
+		return nil, errors.ErrEvidenceTooLarge
+	}
+
+	contentType := detectContentType(content)
+	if !blobTypeAllowed(contentType, allowedTypes) {
+		return nil, errors.ErrEvidenceTypeNotAllowed
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	var existing model.EvidenceBlob
+	if err := model.DB.Where("hash = ?", hash).Limit(1).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing.ID != 0 {
+		return &existing, nil
+	}
+
+	dir := filepath.Join(blobDir(), hash[:2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob dir: %v", err)
+	}
+
+	// 先写临时文件再重命名, 避免留下不完整的附件
+	path := filepath.Join(dir, hash)
+	tmp, err := os.CreateTemp(dir, hash+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob file: %v", err)
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to write blob file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to write blob file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to save blob file: %v", err)
+	}
+
+	blob := &model.EvidenceBlob{
+		Hash:        hash,
+		Size:        int64(len(content)),
+		ContentType: contentType,
+		Path:        path,
+	}
+	if err := model.DB.Create(blob).Error; err != nil {
+		// 相同内容被并发上传时唯一索引冲突, 文件内容相同, 使用先写入的记录
+		if findErr := model.DB.Where("hash = ?", hash).Limit(1).Find(&existing).Error; findErr == nil && existing.ID != 0 {
+			return &existing, nil
+		}
+		return nil, err
+	}
+	return blob, nil
+}
+
+// ReadBlob 读取附件并校验内容哈希
+func ReadBlob(hash string) ([]byte, *model.EvidenceBlob, error) {
+	var blob model.EvidenceBlob
+	if err := model.DB.Where("hash = ?", hash).First(&blob).Error; err != nil {
+		return nil, nil, err
+	}
+
+	content, err := os.ReadFile(blob.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read blob file: %v", err)
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != blob.Hash || int64(len(content)) != blob.Size {
+		return nil, nil, errors.ErrEvidenceIntegrity
+	}
+	return content, &blob, nil
+}
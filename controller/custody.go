@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/kms"
+	"hufu/model"
+	"log"
+	"math/big"
+	"strings"
+)
+
+const (
+	walletDataKeySize   = 32
+	walletKeyAADFormat  = "hufu-wallet-key:v1:%d"
+	minWalletKeyBits    = 2048
+	sealWalletKeysBatch = 100
+)
+
+// CustodyMode 新建钱包的私钥保管方式, 系统钱包(如代理钱包)始终由服务端托管
+func CustodyMode() string {
+	if config.GlobalConfig.Custody.Mode == model.CustodyNonCustodial {
+		return model.CustodyNonCustodial
+	}
+	return model.CustodyCustodial
+}
+
+// walletKeyAAD 私钥密文和数据密钥的附加数据, 密文无法被挪到其他钱包
+func walletKeyAAD(walletID uint) []byte {
+	return []byte(fmt.Sprintf(walletKeyAADFormat, walletID))
+}
+
+// ValidateWalletPublicKey 检查客户端提交的 hex 模数
+func ValidateWalletPublicKey(hexPublicKey string) error {
+	modulus, err := hex.DecodeString(strings.TrimPrefix(hexPublicKey, "0x"))
+	if err != nil {
+		return fmt.Errorf("public_key must be a hex encoded rsa modulus")
+	}
+	n := new(big.Int).SetBytes(modulus)
+	if n.BitLen() < minWalletKeyBits || n.Bit(0) == 0 {
+		return fmt.Errorf("public_key must be an rsa modulus of at least %d bits", minWalletKeyBits)
+	}
+	return nil
+}
+
+// SealWalletPrivateKey 使用一次性数据密钥加密私钥, 数据密钥由 KMS 主密钥封装, 并清空明文字段
+func SealWalletPrivateKey(walletKey *model.WalletKey, privateKey string) error {
+	if kms.Default == nil {
+		return fmt.Errorf("kms is not initialized")
+	}
+	dataKey := make([]byte, walletDataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	aad := walletKeyAAD(walletKey.WalletID)
+
+	sealed, err := kms.Seal(dataKey, []byte(privateKey), aad)
+	if err != nil {
+		return err
+	}
+	wrapped, err := kms.Default.Encrypt(context.Background(), dataKey, aad)
+	if err != nil {
+		return fmt.Errorf("failed to wrap wallet data key: %v", err)
+	}
+
+	walletKey.Custody = model.CustodyCustodial
+	walletKey.PrivateKey = ""
+	walletKey.SealedPrivateKey = hex.EncodeToString(sealed)
+	walletKey.WrappedDataKey = hex.EncodeToString(wrapped)
+	walletKey.KMSKeyID = kms.Default.KeyID()
+	return nil
+}
+
+// UnsealWalletPrivateKey 解封托管的钱包私钥, 非托管钱包返回 ErrKeyNotCustodial
+func UnsealWalletPrivateKey(walletKey *model.WalletKey) (string, error) {
+	if walletKey.Custody == model.CustodyNonCustodial {
+		return "", errors.ErrKeyNotCustodial
+	}
+	if walletKey.SealedPrivateKey == "" {
+		// 尚未迁移的旧记录
+		if walletKey.PrivateKey != "" {
+			return walletKey.PrivateKey, nil
+		}
+		return "", errors.ErrPrivateKeyNotFound
+	}
+	if kms.Default == nil {
+		return "", fmt.Errorf("kms is not initialized")
+	}
+	provider, ok := kms.ForKeyID(walletKey.KMSKeyID)
+	if !ok {
+		return "", errors.NewHufuError(errors.ErrKeyUnsealFailed.Code, errors.ErrKeyUnsealFailed.Message+": 主密钥 "+walletKey.KMSKeyID+" 不可用")
+	}
+
+	wrapped, err := hex.DecodeString(walletKey.WrappedDataKey)
+	if err != nil {
+		return "", errors.ErrKeyUnsealFailed
+	}
+	sealed, err := hex.DecodeString(walletKey.SealedPrivateKey)
+	if err != nil {
+		return "", errors.ErrKeyUnsealFailed
+	}
+	aad := walletKeyAAD(walletKey.WalletID)
+	dataKey, err := provider.Decrypt(context.Background(), wrapped, aad)
+	if err != nil {
+		return "", errors.ErrKeyUnsealFailed
+	}
+	privateKey, err := kms.Open(dataKey, sealed, aad)
+	if err != nil {
+		return "", errors.ErrKeyUnsealFailed
+	}
+	return string(privateKey), nil
+}
+
+// sealLegacyWalletKeys 将明文保存的旧私钥改为 KMS 封装保存
+func sealLegacyWalletKeys() error {
+	for {
+		var batch []model.WalletKey
+		if err := model.DB.Where("private_key <> ''").Limit(sealWalletKeysBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for i := range batch {
+			walletKey := &batch[i]
+			if err := SealWalletPrivateKey(walletKey, walletKey.PrivateKey); err != nil {
+				return fmt.Errorf("wallet key %d: %v", walletKey.WalletID, err)
+			}
+			if err := model.DB.Select("custody", "private_key", "sealed_private_key", "wrapped_data_key", "kms_key_id").
+				Save(walletKey).Error; err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rewrapWalletKey 以当前主密钥重新封装数据密钥, 私钥密文不变
+func rewrapWalletKey(walletKey *model.WalletKey) error {
+	provider, ok := kms.ForKeyID(walletKey.KMSKeyID)
+	if !ok {
+		return fmt.Errorf("kms key %s is not configured", walletKey.KMSKeyID)
+	}
+	wrapped, err := hex.DecodeString(walletKey.WrappedDataKey)
+	if err != nil {
+		return err
+	}
+	aad := walletKeyAAD(walletKey.WalletID)
+	dataKey, err := provider.Decrypt(context.Background(), wrapped, aad)
+	if err != nil {
+		return fmt.Errorf("failed to unwrap with kms key %s: %v", walletKey.KMSKeyID, err)
+	}
+	rewrapped, err := kms.Default.Encrypt(context.Background(), dataKey, aad)
+	if err != nil {
+		return fmt.Errorf("failed to wrap wallet data key: %v", err)
+	}
+
+	// 只更新仍由原主密钥封装的记录, 并发执行时以先完成的为准
+	return model.DB.Model(&model.WalletKey{}).
+		Where("id = ? AND kms_key_id = ?", walletKey.ID, walletKey.KMSKeyID).
+		Updates(map[string]interface{}{
+			"wrapped_data_key": hex.EncodeToString(rewrapped),
+			"kms_key_id":       kms.Default.KeyID(),
+		}).Error
+}
+
+// RewrapWalletKeys 将已轮换主密钥封装的数据密钥改由当前主密钥封装, 返回成功和跳过的数量
+// 主密钥未配置在 retired 中的记录保留原样并记录日志
+func RewrapWalletKeys() (int, int, error) {
+	if kms.Default == nil {
+		return 0, 0, fmt.Errorf("kms is not initialized")
+	}
+	var lastID uint
+	rewrapped, skipped := 0, 0
+	for {
+		var batch []model.WalletKey
+		if err := model.DB.Where("sealed_private_key <> '' AND kms_key_id <> ? AND id > ?", kms.Default.KeyID(), lastID).
+			Order("id").Limit(sealWalletKeysBatch).Find(&batch).Error; err != nil {
+			return rewrapped, skipped, err
+		}
+		if len(batch) == 0 {
+			return rewrapped, skipped, nil
+		}
+		for i := range batch {
+			lastID = batch[i].ID
+			if err := rewrapWalletKey(&batch[i]); err != nil {
+				log.Printf("skip rewrapping wallet key %d: %v", batch[i].WalletID, err)
+				skipped++
+				continue
+			}
+			rewrapped++
+		}
+	}
+}
+
+// StartWalletKeyRewrap 在后台完成主密钥轮换后的重新封装
+func StartWalletKeyRewrap() {
+	go func() {
+		rewrapped, skipped, err := RewrapWalletKeys()
+		if rewrapped > 0 || skipped > 0 {
+			log.Printf("rewrapped %d wallet keys with kms key %s, skipped %d", rewrapped, kms.Default.KeyID(), skipped)
+		}
+		if err != nil {
+			log.Printf("failed to rewrap wallet keys: %v", err)
+		}
+	}()
+}
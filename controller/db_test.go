@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"hufu/config"
+	"hufu/keyprovider"
+	"hufu/model"
+	"hufu/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 使用内存 SQLite 替换 model.DB 并迁移指定的表, 测试结束后恢复 model.DB 和 config.GlobalConfig
+// 调用方在返回后修改的配置同样会被恢复
+func setupTestDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	useTestClock(t, db)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousDB, previousConfig := model.DB, config.GlobalConfig
+	model.DB = db
+	t.Cleanup(func() {
+		sqlDB.Close()
+		model.DB, config.GlobalConfig = previousDB, previousConfig
+	})
+}
+
+// useTestClock SQLite 没有 MySQL 的 UTC_TIMESTAMP, 把 databaseNow 的查询改为读取 DATETIME 列, 以便扫描为 time.Time
+func useTestClock(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	if err := db.Exec("CREATE TABLE test_clocks (now DATETIME NOT NULL)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO test_clocks (now) VALUES (?)", time.Now().UTC()).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := db.Callback().Row().Before("gorm:row").Register("test:utc_timestamp", func(tx *gorm.DB) {
+		if strings.Contains(tx.Statement.SQL.String(), "UTC_TIMESTAMP(") {
+			tx.Statement.SQL.Reset()
+			tx.Statement.SQL.WriteString("SELECT now FROM test_clocks")
+			tx.Statement.Vars = nil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupTestSigningKey 使用随机生成的 TEE 签名密钥, 违规记录需要签名
+func setupTestSigningKey(t *testing.T) {
+	t.Helper()
+	privateKey, _, _ := utils.GenerateKeys()
+	t.Setenv("HUFU_TEST_KEY_"+strings.ToUpper(keyprovider.NameTeeSigning), privateKey)
+	provider, err := keyprovider.New(keyprovider.NewEnvSource("HUFU_TEST_KEY"), []string{keyprovider.NameTeeSigning}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := keyprovider.Default
+	keyprovider.Default = provider
+	t.Cleanup(func() { keyprovider.Default = previous })
+}
@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultEscrowTTL = 7 * 24 * time.Hour
+
+// CreateEscrowHold 冻结付款钱包的部分余额作为担保, from, to 和 amount 来自付款方签名的转账请求
+func CreateEscrowHold(from, to *model.Wallet, amount float64, memo string, expiresAt *time.Time, creator *model.Account) (*model.EscrowHold, error) {
+	if err := validatePaymentAmount(amount, memo); err != nil {
+		return nil, err
+	}
+	if from.ID == to.ID {
+		return nil, fmt.Errorf("payer and payee wallets must differ")
+	}
+
+	cfg := config.GlobalConfig.Payments
+	ttl := defaultEscrowTTL
+	if cfg.EscrowTTLHours > 0 {
+		ttl = time.Duration(cfg.EscrowTTLHours) * time.Hour
+	}
+	expiry, err := paymentExpiry(expiresAt, ttl, cfg.EscrowMaxTTLHours)
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &model.EscrowHold{
+		PayerWalletID: from.ID,
+		PayeeWalletID: to.ID,
+		Amount:        amount,
+		Memo:          memo,
+		Status:        model.EscrowHeld,
+		ExpiresAt:     expiry,
+		CreatedBy:     creator.ID,
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockWallets(tx, from.ID, to.ID)
+		if err != nil {
+			return err
+		}
+		payer := locked[from.ID]
+		if err := CheckTransferAllowed(payer, locked[to.ID]); err != nil {
+			return err
+		}
+		if payer.AvailableBalance() < amount {
+			return errors.ErrInsufficientBalance
+		}
+		// 担保在创建时按付款方的 KYC 等级限额检查, 未结束的担保计入日累计金额
+		if err := checkTierLimits(tx, payer, locked[to.ID], amount); err != nil {
+			return err
+		}
+		if err := tx.Model(payer).Update("held_balance", payer.HeldBalance+amount).Error; err != nil {
+			return err
+		}
+		return tx.Create(hold).Error
+	})
+	if err != nil {
+		return nil, tierLimitError(from, to, amount, err)
+	}
+	return hold, nil
+}
+
+// GetEscrowHold 获取担保
+func GetEscrowHold(id uint) (*model.EscrowHold, error) {
+	var hold model.EscrowHold
+	if err := model.DB.First(&hold, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrEscrowNotFound
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// decideEscrowHold 条件更新担保状态, 保证同一担保只会结束一次
+func decideEscrowHold(tx *gorm.DB, hold *model.EscrowHold, status model.EscrowStatus, actorID uint) error {
+	now := time.Now()
+	result := tx.Model(&model.EscrowHold{}).
+		Where("id = ? AND status = ?", hold.ID, model.EscrowHeld).
+		Updates(map[string]interface{}{"status": status, "decided_by": actorID, "decided_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrEscrowState
+	}
+	hold.Status = status
+	hold.DecidedBy = actorID
+	hold.DecidedAt = &now
+	return nil
+}
+
+// ReleaseEscrowHold 把担保资金转给收款方, 付款钱包被冻结或收款钱包已注销时不能释放
+func ReleaseEscrowHold(id uint, actor *model.Account) (*model.EscrowHold, error) {
+	hold, err := GetEscrowHold(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := decideEscrowHold(tx, hold, model.EscrowReleased, actor.ID); err != nil {
+			return err
+		}
+
+		locked, err := lockWallets(tx, hold.PayerWalletID, hold.PayeeWalletID)
+		if err != nil {
+			return err
+		}
+		payer, payee := locked[hold.PayerWalletID], locked[hold.PayeeWalletID]
+		if err := CheckTransferAllowed(payer, payee); err != nil {
+			return err
+		}
+
+		transfer := &model.Transaction{
+			FromWalletID: payer.ID,
+			ToWalletID:   payee.ID,
+			Amount:       hold.Amount,
+			Type:         model.EscrowTransaction,
+			Status:       TransactionStatusSuccess,
+		}
+		if err := tx.Create(transfer).Error; err != nil {
+			return err
+		}
+		payerBalance, payeeBalance := payer.Balance-hold.Amount, payee.Balance+hold.Amount
+		if err := tx.Model(payer).Updates(map[string]interface{}{
+			"balance":      payerBalance,
+			"held_balance": payer.HeldBalance - hold.Amount,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(payee).Update("balance", payeeBalance).Error; err != nil {
+			return err
+		}
+		if err := recordTransferLedger(tx, transfer, payerBalance, payeeBalance); err != nil {
+			return err
+		}
+
+		hold.TransactionID = transfer.ID
+		return tx.Model(hold).Update("transaction_id", transfer.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// refundEscrowHold 解除担保冻结, 资金留在付款钱包
+func refundEscrowHold(hold *model.EscrowHold, status model.EscrowStatus, actorID uint) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := decideEscrowHold(tx, hold, status, actorID); err != nil {
+			return err
+		}
+		locked, err := lockWallets(tx, hold.PayerWalletID)
+		if err != nil {
+			return err
+		}
+		payer := locked[hold.PayerWalletID]
+		return tx.Model(payer).Update("held_balance", payer.HeldBalance-hold.Amount).Error
+	})
+}
+
+// RefundEscrowHold 把担保资金退回付款方
+func RefundEscrowHold(id uint, actor *model.Account) (*model.EscrowHold, error) {
+	hold, err := GetEscrowHold(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := refundEscrowHold(hold, model.EscrowRefunded, actor.ID); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ExpireEscrowHolds 退回到期未释放的担保, 返回退回的数量
+func ExpireEscrowHolds() (int, error) {
+	var holds []model.EscrowHold
+	if err := model.DB.Where("status = ? AND expires_at <= ?", model.EscrowHeld, time.Now()).
+		Find(&holds).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range holds {
+		err := refundEscrowHold(&holds[i], model.EscrowExpired, 0)
+		if err == errors.ErrEscrowState {
+			// 已被释放或退回
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// checkNoOpenEscrow 钱包作为付款方或收款方有未结束的担保时返回错误
+func checkNoOpenEscrow(tx *gorm.DB, walletID uint) error {
+	var count int64
+	if err := tx.Model(&model.EscrowHold{}).
+		Where("status = ? AND (payer_wallet_id = ? OR payee_wallet_id = ?)", model.EscrowHeld, walletID, walletID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.ErrWalletHasHolds
+	}
+	return nil
+}
+
+// ListEscrowHolds 分页查询担保
+func ListEscrowHolds(filter PaymentFilter, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.EscrowHold{})
+	if filter.WalletID != 0 {
+		query = query.Where("(payer_wallet_id = ? OR payee_wallet_id = ?)", filter.WalletID, filter.WalletID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var holds []model.EscrowHold
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&holds).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     holds,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
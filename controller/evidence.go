@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/errors"
+	"hufu/model"
+	"hufu/supervisor"
+	"hufu/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	evidencePayloadPrefix = "hufu-evidence"
+	evidencePayloadV1     = "v1"
+	evidenceRefSize       = 16
+	evidenceSaltSize      = 32
+)
+
+// EvidenceVerification 证据与链上承诺的校验结果
+type EvidenceVerification struct {
+	Ref             string                      `json:"ref"`
+	WalletID        uint                        `json:"wallet_id"`
+	Commitment      string                      `json:"commitment"`
+	OnChainPayload  string                      `json:"on_chain_payload"`
+	StoredMatch     bool                        `json:"stored_match"`                // 链下存储的证据与承诺一致
+	ProvidedMatch   *bool                       `json:"provided_match,omitempty"`    // 调用方提供的证据与承诺一致
+	OnChain         bool                        `json:"on_chain"`                    // 承诺已记录在链上
+	OnChainDecision []supervisor.DecisionRecord `json:"on_chain_decision,omitempty"` // 链上匹配的决策记录
+}
+
+// SaveEvidence 将证据原文保存到链下证据库, 并生成加盐哈希承诺
+func SaveEvidence(walletID uint, content string) (*model.EvidenceRecord, error) {
+	ref, err := utils.GenerateSalt(evidenceRefSize)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := utils.GenerateSalt(evidenceSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	commitment, err := utils.CommitEvidence(salt, content)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &model.EvidenceRecord{
+		Ref:        ref,
+		WalletID:   walletID,
+		Content:    content,
+		Salt:       salt,
+		Commitment: commitment,
+	}
+	if err := model.DB.Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to save evidence: %v", err)
+	}
+	return record, nil
+}
+
+// GetEvidenceByRef 根据引用编号获取证据记录
+func GetEvidenceByRef(ref string) (*model.EvidenceRecord, error) {
+	var record model.EvidenceRecord
+	if err := model.DB.Where("ref = ?", ref).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrEvidenceNotFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// EvidencePayload 生成写入链上的证据载荷, 只包含引用编号和承诺
+func EvidencePayload(record *model.EvidenceRecord) string {
+	return strings.Join([]string{evidencePayloadPrefix, evidencePayloadV1, record.Ref, record.Commitment}, ":")
+}
+
+// VerifyEvidence 校验链下证据与链上承诺是否一致, content 为空时只校验已存储的证据
+func VerifyEvidence(ref string, content string) (*EvidenceVerification, error) {
+	record, err := GetEvidenceByRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EvidenceVerification{
+		Ref:            record.Ref,
+		WalletID:       record.WalletID,
+		Commitment:     record.Commitment,
+		OnChainPayload: EvidencePayload(record),
+	}
+
+	stored, err := utils.CommitEvidence(record.Salt, record.Content)
+	if err != nil {
+		return nil, err
+	}
+	result.StoredMatch = stored == record.Commitment
+
+	if content != "" {
+		provided, err := utils.CommitEvidence(record.Salt, content)
+		if err != nil {
+			return nil, err
+		}
+		match := provided == record.Commitment
+		result.ProvidedMatch = &match
+	}
+
+	decisions, err := supervisor.FindDecisionsByEvidence(result.OnChainPayload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read on-chain decisions: %v", err)
+	}
+	result.OnChain = len(decisions) > 0
+	result.OnChainDecision = decisions
+
+	return result, nil
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hufu/errors"
+	"hufu/model"
+	"strconv"
+	"strings"
+)
+
+// legacyLegalBasis 旧版文本证据没有法律依据字段时使用的占位说明
+const legacyLegalBasis = "旧版文本证据未注明"
+
+func evidenceInvalid(format string, args ...interface{}) error {
+	return errors.NewHufuError(errors.ErrEvidenceInvalid.Code, errors.ErrEvidenceInvalid.Message+": "+fmt.Sprintf(format, args...))
+}
+
+// ParseEvidenceDocument 解析上传的证据, 支持 JSON 证据文档和旧版文本格式
+func ParseEvidenceDocument(content []byte, walletID uint, requester, legalBasis string) (*model.EvidenceDocument, error) {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var doc model.EvidenceDocument
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, evidenceInvalid("%v", err)
+		}
+		// legacy 只由旧版文本转换时设置, 上传的 JSON 文档不能借此跳过机构和签名检查
+		doc.Legacy = false
+		return &doc, nil
+	}
+	return parseLegacyEvidence(string(content), walletID, requester, legalBasis)
+}
+
+// parseLegacyEvidence 将旧版 "异常证据:" 文本转换为证据文档
+func parseLegacyEvidence(content string, walletID uint, requester, legalBasis string) (*model.EvidenceDocument, error) {
+	ref := model.EvidenceAbnormalRef{}
+	fileWalletID := walletID
+
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := splitLegacyLine(strings.TrimSpace(line))
+		if !ok {
+			continue
+		}
+		switch key {
+		case "钱包序号":
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, evidenceInvalid("无效的钱包序号")
+			}
+			fileWalletID = uint(id)
+		case "交易序号":
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, evidenceInvalid("无效的交易序号")
+			}
+			ref.TransactionID = uint(id)
+		case "异常证据":
+			if ref.Evidence == "" {
+				ref.Evidence = value
+			}
+		case "监管签名":
+			ref.Signature = value
+		}
+	}
+
+	if ref.Evidence == "" {
+		return nil, evidenceInvalid("未找到异常证据")
+	}
+	if legalBasis == "" {
+		legalBasis = legacyLegalBasis
+	}
+
+	return &model.EvidenceDocument{
+		Schema:               model.EvidenceSchemaV1,
+		WalletID:             fileWalletID,
+		AbnormalTransactions: []model.EvidenceAbnormalRef{ref},
+		Requester:            model.EvidenceRequester{Name: requester},
+		LegalBasis:           legalBasis,
+		Legacy:               true,
+	}, nil
+}
+
+// splitLegacyLine 拆分 "键: 值" 格式的行, 兼容全角冒号
+func splitLegacyLine(line string) (string, string, bool) {
+	idx := strings.IndexAny(line, ":：")
+	if idx < 0 {
+		return "", "", false
+	}
+	value := line[idx:]
+	value = strings.TrimPrefix(strings.TrimPrefix(value, ":"), "：")
+	return strings.TrimSpace(line[:idx]), strings.TrimSpace(value), true
+}
+
+// ValidateEvidenceDocument 校验证据文档, 并用 TEE 公钥验证每条异常交易的签名
+func ValidateEvidenceDocument(doc *model.EvidenceDocument, walletID uint) error {
+	if doc.Schema != model.EvidenceSchemaV1 {
+		return evidenceInvalid("不支持的版本 %q", doc.Schema)
+	}
+	if doc.WalletID != walletID {
+		return evidenceInvalid("证据钱包 %d 与申请钱包 %d 不一致", doc.WalletID, walletID)
+	}
+	if len(doc.AbnormalTransactions) == 0 {
+		return evidenceInvalid("缺少异常交易")
+	}
+	if strings.TrimSpace(doc.Requester.Name) == "" {
+		return evidenceInvalid("缺少申请人")
+	}
+	if !doc.Legacy && strings.TrimSpace(doc.Requester.Organization) == "" {
+		return evidenceInvalid("缺少申请机构")
+	}
+	if strings.TrimSpace(doc.LegalBasis) == "" {
+		return evidenceInvalid("缺少法律依据")
+	}
+
+	for i := range doc.AbnormalTransactions {
+		ref := &doc.AbnormalTransactions[i]
+		abnormal, err := findAbnormalTransaction(ref)
+		if err != nil {
+			return evidenceInvalid("异常交易 %d 不存在", ref.TransactionID)
+		}
+		if abnormal.WalletID != walletID {
+			return evidenceInvalid("异常交易 %d 不属于钱包 %d", abnormal.ID, walletID)
+		}
+
+		// 旧版文本可能不带签名, 以数据库记录为准
+		if ref.Signature == "" && doc.Legacy {
+			ref.Signature = abnormal.Signature
+		}
+		ref.AbnormalID = abnormal.ID
+		ref.TransactionID = abnormal.TransactionID
+
+		if ref.Evidence != abnormal.Evidence || ref.Signature != abnormal.Signature {
+			return evidenceInvalid("异常交易 %d 的证据与记录不一致", abnormal.ID)
+		}
+
+		if !VerifyAbnormalRecord(abnormal).Valid {
+			return errors.ErrEvidenceSignatureInvalid
+		}
+	}
+	return nil
+}
+
+func findAbnormalTransaction(ref *model.EvidenceAbnormalRef) (*model.AbnormalTransaction, error) {
+	var abnormal model.AbnormalTransaction
+	query := model.DB
+	if ref.AbnormalID != 0 {
+		query = query.Where("id = ?", ref.AbnormalID)
+	} else {
+		query = query.Where("transaction_id = ? AND evidence = ?", ref.TransactionID, ref.Evidence)
+	}
+	if err := query.First(&abnormal).Error; err != nil {
+		return nil, err
+	}
+	return &abnormal, nil
+}
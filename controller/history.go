@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"hufu/errors"
+	"hufu/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EncryptedHistoryFilter 加密交易记录查询条件, 时间为 Unix 秒, 0 表示不限
+// Role 为 sender 或 receiver 时只返回转出或转入的记录, 为空时合并返回
+type EncryptedHistoryFilter struct {
+	StartTime int64                `json:"start_time"`
+	EndTime   int64                `json:"end_time"`
+	Role      model.RecordViewRole `json:"role"`
+}
+
+// DecryptedRecord 解密后的交易记录, 解密失败时只返回 Error
+type DecryptedRecord struct {
+	ID            uint                 `json:"id"`
+	TransactionID uint                 `json:"transaction_id"`
+	Role          model.RecordViewRole `json:"role"`
+	From          uint                 `json:"from,omitempty"`
+	To            uint                 `json:"to,omitempty"`
+	Amount        float64              `json:"amount,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	Error         string               `json:"error,omitempty"`
+}
+
+// encryptedHistoryQuery 只查询属于该钱包的副本, 包括转出和转入的记录
+// 尚未完成重新加密的版本 1 记录没有所属钱包, 以发起方密钥加密, 作为发起方的转出记录返回
+func encryptedHistoryQuery(walletID uint, filter EncryptedHistoryFilter) *gorm.DB {
+	owned := model.DB.Where("owner_wallet_id = ?", walletID)
+	if filter.Role != "" {
+		owned = owned.Where("role = ?", filter.Role)
+	}
+	if filter.Role == "" || filter.Role == model.RecordViewSender {
+		sent := model.DB.Model(&model.Transaction{}).Select("id").Where("from_wallet_id = ?", walletID)
+		owned = owned.Or("owner_wallet_id = 0 AND version = ? AND transaction_id IN (?)", model.EncryptedRecordLegacy, sent)
+	}
+
+	query := model.DB.Model(&model.EncryptedTransaction{}).Where(owned)
+	if filter.StartTime > 0 {
+		query = query.Where("created_at >= ?", time.Unix(filter.StartTime, 0))
+	}
+	if filter.EndTime > 0 {
+		query = query.Where("created_at < ?", time.Unix(filter.EndTime, 0))
+	}
+	return query
+}
+
+func listEncryptedHistory(walletID uint, filter EncryptedHistoryFilter, page, pageSize int) ([]model.EncryptedTransaction, int64, error) {
+	query := encryptedHistoryQuery(walletID, filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []model.EncryptedTransaction
+	if err := query.
+		Order("created_at DESC, id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// ListEncryptedHistory 分页查询钱包的加密交易记录, 按时间倒序
+func ListEncryptedHistory(walletID uint, filter EncryptedHistoryFilter, page, pageSize int) (*model.PageResult, error) {
+	records, total, err := listEncryptedHistory(walletID, filter, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &model.PageResult{
+		List:     records,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// ListDecryptedHistory 分页查询并解密钱包的交易记录, 解密失败的记录单独标注错误
+// 非托管钱包的私钥不在服务端, 返回 ErrKeyNotCustodial, 客户端应查询加密记录后自行解密
+func ListDecryptedHistory(walletKey *model.WalletKey, filter EncryptedHistoryFilter, page, pageSize int) (*model.PageResult, error) {
+	if walletKey.Custody == model.CustodyNonCustodial {
+		return nil, errors.ErrKeyNotCustodial
+	}
+	records, total, err := listEncryptedHistory(walletKey.WalletID, filter, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]DecryptedRecord, 0, len(records))
+	for i := range records {
+		item := &records[i]
+		decrypted := DecryptedRecord{
+			ID:            item.ID,
+			TransactionID: item.TransactionID,
+			Role:          item.Role,
+			CreatedAt:     item.CreatedAt,
+		}
+		if decrypted.Role == "" {
+			// 未重新加密的旧记录只有发起方副本
+			decrypted.Role = model.RecordViewSender
+		}
+		record, err := OpenTransactionRecord(walletKey, item)
+		if err != nil {
+			decrypted.Error = err.Error()
+		} else {
+			decrypted.From = record.From
+			decrypted.To = record.To
+			decrypted.Amount = record.Amount
+		}
+		list = append(list, decrypted)
+	}
+
+	return &model.PageResult{
+		List:     list,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
@@ -0,0 +1,501 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultKYCDocumentMaxSize = 5 << 20
+
+var defaultKYCDocumentTypes = []string{"image/jpeg", "image/png", "application/pdf"}
+
+// defaultTierPolicies 未配置 kyc.tiers 时使用的策略, 等级 1 与原有的统一限额一致
+var defaultTierPolicies = []config.TierPolicy{
+	{Tier: 0, MaxTransactionAmount: 1000, MaxDailyAmount: 2000, HourlyFrequency: 10, ProxyTransfer: false, AlertAmount: 500},
+	{Tier: 1, MaxTransactionAmount: 10000, MaxDailyAmount: 50000, HourlyFrequency: 100, ProxyTransfer: true, AlertAmount: 5000},
+	{Tier: 2, MaxTransactionAmount: 50000, MaxDailyAmount: 200000, HourlyFrequency: 200, ProxyTransfer: true, AlertAmount: 20000},
+	{Tier: 3, MaxTransactionAmount: 200000, MaxDailyAmount: 1000000, HourlyFrequency: 500, ProxyTransfer: true},
+}
+
+var kycDocumentTypes = map[string]bool{
+	model.KYCDocIDCard:          true,
+	model.KYCDocPassport:        true,
+	model.KYCDocProofOfAddress:  true,
+	model.KYCDocBusinessLicense: true,
+	model.KYCDocOther:           true,
+}
+
+// KYC 等级的来源
+const (
+	KYCSourceWallet  = "wallet"  // 钱包级别的覆盖
+	KYCSourceUser    = "user"    // 所属用户审核通过的等级
+	KYCSourceDefault = "default" // 未通过审核, 使用 kyc.default_tier
+)
+
+// KYCProfile 钱包当前适用的 KYC 等级和监管策略
+type KYCProfile struct {
+	WalletID uint               `json:"wallet_id"`
+	UserID   uint               `json:"user_id"`
+	Status   model.KYCStatus    `json:"status"`
+	Tier     int                `json:"tier"`
+	Source   string             `json:"source"`
+	Policy   *config.TierPolicy `json:"policy"`
+}
+
+// KYCDocumentUpload 提交核验时上传的文档
+type KYCDocumentUpload struct {
+	DocType  string
+	FileName string
+	Content  []byte
+}
+
+// KYCSubmissionFilter KYC 申请查询条件
+type KYCSubmissionFilter struct {
+	UserID uint   `json:"user_id"`
+	Status string `json:"status"`
+}
+
+// KYCDocumentMaxSize 获取核验文档大小上限
+func KYCDocumentMaxSize() int64 {
+	if config.GlobalConfig.KYC.DocumentMaxSize > 0 {
+		return config.GlobalConfig.KYC.DocumentMaxSize
+	}
+	return defaultKYCDocumentMaxSize
+}
+
+func kycDocumentContentTypes() []string {
+	if len(config.GlobalConfig.KYC.DocumentTypes) > 0 {
+		return config.GlobalConfig.KYC.DocumentTypes
+	}
+	return defaultKYCDocumentTypes
+}
+
+// TierPolicies 按等级排序的监管策略
+func TierPolicies() []config.TierPolicy {
+	policies := config.GlobalConfig.KYC.Tiers
+	if len(policies) == 0 {
+		policies = defaultTierPolicies
+	}
+	sorted := append([]config.TierPolicy{}, policies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Tier < sorted[j].Tier })
+	return sorted
+}
+
+// TierPolicyFor 获取等级对应的监管策略
+func TierPolicyFor(tier int) (*config.TierPolicy, error) {
+	for _, policy := range TierPolicies() {
+		if policy.Tier == tier {
+			return &policy, nil
+		}
+	}
+	return nil, errors.ErrKYCTierInvalid
+}
+
+// WalletKYCProfile 计算钱包适用的 KYC 等级: 钱包覆盖优先, 其次为所属用户审核通过的等级, 否则为默认等级
+func WalletKYCProfile(w *model.Wallet) (*KYCProfile, error) {
+	profile := &KYCProfile{
+		WalletID: w.ID,
+		UserID:   w.UserID,
+		Status:   model.KYCUnverified,
+		Tier:     config.GlobalConfig.KYC.DefaultTier,
+		Source:   KYCSourceDefault,
+	}
+	if w.UserID != 0 {
+		user, err := GetUserByID(w.UserID)
+		if err != nil {
+			return nil, err
+		}
+		profile.Status = user.KYCStatus
+		if user.KYCStatus == model.KYCVerified {
+			profile.Tier, profile.Source = user.KYCTier, KYCSourceUser
+		}
+	}
+	if w.KYCTier != nil {
+		profile.Tier, profile.Source = *w.KYCTier, KYCSourceWallet
+	}
+
+	policy, err := TierPolicyFor(profile.Tier)
+	if err != nil {
+		return nil, fmt.Errorf("wallet %d has kyc tier %d without a policy", w.ID, profile.Tier)
+	}
+	profile.Policy = policy
+	return profile, nil
+}
+
+// GetWalletKYCProfile 根据钱包ID获取适用的 KYC 等级和监管策略
+func GetWalletKYCProfile(walletID uint) (*KYCProfile, error) {
+	wallet, err := GetWalletByID(walletID)
+	if err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+	return WalletKYCProfile(wallet)
+}
+
+// CheckProxyTransferAllowed 检查钱包的 KYC 等级是否允许代理转账
+func CheckProxyTransferAllowed(w *model.Wallet) error {
+	profile, err := WalletKYCProfile(w)
+	if err != nil {
+		return err
+	}
+	if !profile.Policy.ProxyTransfer {
+		return errors.ErrProxyTransferNotAllowed
+	}
+	return nil
+}
+
+// SubmitKYC 上传核验文档并创建待审核的申请, 同一用户同时只能有一个待审核的申请
+func SubmitKYC(userID uint, requestedTier int, documents []KYCDocumentUpload, submitter *model.Account) (*model.KYCSubmission, error) {
+	if _, err := TierPolicyFor(requestedTier); err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("at least one document is required")
+	}
+	for _, doc := range documents {
+		if !kycDocumentTypes[doc.DocType] {
+			return nil, fmt.Errorf("invalid document type %q", doc.DocType)
+		}
+	}
+	if _, err := GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	if err := checkNoPendingKYCSubmission(model.DB, userID); err != nil {
+		return nil, err
+	}
+
+	submission := &model.KYCSubmission{
+		UserID:        userID,
+		RequestedTier: requestedTier,
+		Status:        model.KYCPending,
+		SubmittedBy:   submitter.ID,
+	}
+	for _, doc := range documents {
+		blob, err := storeBlob(doc.Content, KYCDocumentMaxSize(), kycDocumentContentTypes())
+		if err != nil {
+			return nil, err
+		}
+		submission.Documents = append(submission.Documents, model.KYCDocument{
+			DocType:     doc.DocType,
+			BlobHash:    blob.Hash,
+			FileName:    doc.FileName,
+			ContentType: blob.ContentType,
+			Size:        blob.Size,
+		})
+	}
+
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定用户行保证并发提交时只有一个成功
+		user, err := lockKYCUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := checkNoPendingKYCSubmission(tx, userID); err != nil {
+			return err
+		}
+		// 已通过审核的用户申请升级期间保持 verified, 继续适用当前等级
+		toStatus := model.KYCPending
+		if user.KYCStatus == model.KYCVerified {
+			toStatus = model.KYCVerified
+		} else if err := tx.Model(user).Update("kyc_status", model.KYCPending).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(submission).Error; err != nil {
+			return err
+		}
+		currentTier := user.KYCTier
+		return tx.Create(&model.KYCTierChange{
+			UserID:       userID,
+			SubmissionID: submission.ID,
+			FromTier:     &currentTier,
+			ToTier:       &currentTier,
+			FromStatus:   user.KYCStatus,
+			ToStatus:     toStatus,
+			ActorID:      submitter.ID,
+			Reason:       fmt.Sprintf("submitted for tier %d", requestedTier),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// ApproveKYC 审核通过, 授予申请的等级或审核人指定的等级, 审核人不能是提交人
+func ApproveKYC(id uint, reviewer *model.Account, grantedTier *int, note string) (*model.KYCSubmission, error) {
+	submission, err := pendingKYCSubmission(id, reviewer)
+	if err != nil {
+		return nil, err
+	}
+	tier := submission.RequestedTier
+	if grantedTier != nil {
+		tier = *grantedTier
+	}
+	if _, err := TierPolicyFor(tier); err != nil {
+		return nil, err
+	}
+	return submission, reviewKYC(submission, reviewer, model.KYCVerified, &tier, note)
+}
+
+// RejectKYC 审核拒绝, 用户的等级保持不变
+func RejectKYC(id uint, reviewer *model.Account, note string) (*model.KYCSubmission, error) {
+	submission, err := pendingKYCSubmission(id, reviewer)
+	if err != nil {
+		return nil, err
+	}
+	return submission, reviewKYC(submission, reviewer, model.KYCRejected, nil, note)
+}
+
+func pendingKYCSubmission(id uint, reviewer *model.Account) (*model.KYCSubmission, error) {
+	submission, err := GetKYCSubmission(id)
+	if err != nil {
+		return nil, err
+	}
+	if submission.Status != model.KYCPending {
+		return nil, errors.ErrKYCSubmissionState
+	}
+	if submission.SubmittedBy == reviewer.ID {
+		return nil, errors.ErrSelfApproval
+	}
+	return submission, nil
+}
+
+// reviewKYC 更新申请和用户状态并写入审计日志, 已通过审核的用户升级被拒绝时保持原有的状态和等级
+func reviewKYC(submission *model.KYCSubmission, reviewer *model.Account, status model.KYCStatus, tier *int, note string) error {
+	now := time.Now()
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := lockKYCUser(tx, submission.UserID)
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&model.KYCSubmission{}).
+			Where("id = ? AND status = ?", submission.ID, model.KYCPending).
+			Updates(map[string]interface{}{
+				"status":       status,
+				"reviewed_by":  reviewer.ID,
+				"reviewed_at":  now,
+				"granted_tier": tier,
+				"review_note":  note,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.ErrKYCSubmissionState
+		}
+
+		fromTier, toTier := user.KYCTier, user.KYCTier
+		if tier != nil {
+			toTier = *tier
+		}
+		toStatus := status
+		if status == model.KYCRejected && user.KYCStatus == model.KYCVerified {
+			toStatus = model.KYCVerified
+		}
+		if err := tx.Model(user).Updates(map[string]interface{}{"kyc_status": toStatus, "kyc_tier": toTier}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.KYCTierChange{
+			UserID:       user.ID,
+			SubmissionID: submission.ID,
+			FromTier:     &fromTier,
+			ToTier:       &toTier,
+			FromStatus:   user.KYCStatus,
+			ToStatus:     toStatus,
+			ActorID:      reviewer.ID,
+			Reason:       note,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	submission.Status = status
+	submission.ReviewedBy = reviewer.ID
+	submission.ReviewedAt = &now
+	submission.GrantedTier = tier
+	submission.ReviewNote = note
+	return nil
+}
+
+// lockKYCUser 在事务中锁定用户行, 串行化同一用户的提交和审核
+func lockKYCUser(tx *gorm.DB, userID uint) (*model.User, error) {
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// checkNoPendingKYCSubmission 用户已有待审核的申请时返回错误
+func checkNoPendingKYCSubmission(db *gorm.DB, userID uint) error {
+	var count int64
+	if err := db.Model(&model.KYCSubmission{}).
+		Where("user_id = ? AND status = ?", userID, model.KYCPending).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.ErrKYCSubmissionState
+	}
+	return nil
+}
+
+// SetUserKYCTier 运营人员直接调整用户的等级, 如降级或撤销, 调整后状态为 verified
+func SetUserKYCTier(userID uint, tier int, actor *model.Account, reason string) (*model.User, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	if _, err := TierPolicyFor(tier); err != nil {
+		return nil, err
+	}
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNoPendingKYCSubmission(model.DB, userID); err != nil {
+		return nil, err
+	}
+
+	fromTier := user.KYCTier
+	change := &model.KYCTierChange{
+		UserID:     userID,
+		FromTier:   &fromTier,
+		ToTier:     &tier,
+		FromStatus: user.KYCStatus,
+		ToStatus:   model.KYCVerified,
+		ActorID:    actor.ID,
+		Reason:     reason,
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{"kyc_status": model.KYCVerified, "kyc_tier": tier}).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.KYCStatus, user.KYCTier = model.KYCVerified, tier
+	return user, nil
+}
+
+// SetWalletKYCTier 设置或清除钱包级别的等级覆盖, tier 为空时清除
+func SetWalletKYCTier(walletID uint, tier *int, actor *model.Account, reason string) (*model.Wallet, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	if tier != nil {
+		if _, err := TierPolicyFor(*tier); err != nil {
+			return nil, err
+		}
+	}
+	wallet, err := GetWalletByID(walletID)
+	if err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+
+	change := &model.KYCTierChange{
+		UserID:   wallet.UserID,
+		WalletID: walletID,
+		FromTier: wallet.KYCTier,
+		ToTier:   tier,
+		ActorID:  actor.ID,
+		Reason:   reason,
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(wallet).Update("kyc_tier", tier).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	wallet.KYCTier = tier
+	return wallet, nil
+}
+
+// GetKYCSubmission 获取 KYC 申请及其文档
+func GetKYCSubmission(id uint) (*model.KYCSubmission, error) {
+	var submission model.KYCSubmission
+	if err := model.DB.Preload("Documents").First(&submission, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrKYCSubmissionNotFound
+		}
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// ListKYCSubmissions 分页查询 KYC 申请
+func ListKYCSubmissions(filter KYCSubmissionFilter, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.KYCSubmission{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var submissions []model.KYCSubmission
+	if err := query.Preload("Documents").
+		Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&submissions).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     submissions,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// ListKYCTierChanges 分页查询 KYC 等级变更审计日志
+func ListKYCTierChanges(userID, walletID uint, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.KYCTierChange{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if walletID != 0 {
+		query = query.Where("wallet_id = ?", walletID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var changes []model.KYCTierChange
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     changes,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+var kycTestDocument = []KYCDocumentUpload{{DocType: model.KYCDocPassport, FileName: "passport.pdf", Content: []byte("%PDF-1.4\n")}}
+
+// setupKYCDB 附件写入临时目录
+func setupKYCDB(t *testing.T) {
+	t.Helper()
+	setupTestDB(t, &model.User{}, &model.Wallet{}, &model.KYCSubmission{}, &model.KYCDocument{},
+		&model.KYCTierChange{}, &model.EvidenceBlob{})
+	config.GlobalConfig.Evidence.BlobDir = t.TempDir()
+	config.GlobalConfig.KYC.DefaultTier = 0
+}
+
+func createKYCUser(t *testing.T, status model.KYCStatus, tier int) (*model.User, *model.Wallet) {
+	t.Helper()
+	user := &model.User{UID: "u-" + t.Name(), Username: t.Name(), KYCStatus: status, KYCTier: tier}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	wallet := &model.Wallet{UserID: user.ID, Username: user.Username}
+	if err := model.DB.Create(wallet).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user, wallet
+}
+
+func assertWalletTier(t *testing.T, wallet *model.Wallet, status model.KYCStatus, tier int) {
+	t.Helper()
+	profile, err := WalletKYCProfile(wallet)
+	if err != nil {
+		t.Fatalf("WalletKYCProfile() error = %v", err)
+	}
+	if profile.Status != status || profile.Tier != tier {
+		t.Fatalf("profile = %s tier %d, want %s tier %d", profile.Status, profile.Tier, status, tier)
+	}
+}
+
+func TestVerifiedUserKeepsTierDuringUpgrade(t *testing.T) {
+	setupKYCDB(t)
+	user, wallet := createKYCUser(t, model.KYCVerified, 2)
+	submitter, reviewer := &model.Account{Model: gorm.Model{ID: 1}}, &model.Account{Model: gorm.Model{ID: 2}}
+
+	submission, err := SubmitKYC(user.ID, 3, kycTestDocument, submitter)
+	if err != nil {
+		t.Fatalf("SubmitKYC() error = %v", err)
+	}
+	assertWalletTier(t, wallet, model.KYCVerified, 2)
+
+	if _, err := SubmitKYC(user.ID, 3, kycTestDocument, submitter); err != errors.ErrKYCSubmissionState {
+		t.Fatalf("second SubmitKYC() error = %v, want %v", err, errors.ErrKYCSubmissionState)
+	}
+
+	if _, err := RejectKYC(submission.ID, reviewer, "blurry"); err != nil {
+		t.Fatalf("RejectKYC() error = %v", err)
+	}
+	assertWalletTier(t, wallet, model.KYCVerified, 2)
+
+	submission, err = SubmitKYC(user.ID, 3, kycTestDocument, submitter)
+	if err != nil {
+		t.Fatalf("resubmit error = %v", err)
+	}
+	if _, err := ApproveKYC(submission.ID, reviewer, nil, "ok"); err != nil {
+		t.Fatalf("ApproveKYC() error = %v", err)
+	}
+	assertWalletTier(t, wallet, model.KYCVerified, 3)
+}
+
+func TestUnverifiedUserRejected(t *testing.T) {
+	setupKYCDB(t)
+	user, wallet := createKYCUser(t, model.KYCUnverified, 0)
+	submitter, reviewer := &model.Account{Model: gorm.Model{ID: 1}}, &model.Account{Model: gorm.Model{ID: 2}}
+
+	submission, err := SubmitKYC(user.ID, 1, kycTestDocument, submitter)
+	if err != nil {
+		t.Fatalf("SubmitKYC() error = %v", err)
+	}
+	assertWalletTier(t, wallet, model.KYCPending, 0)
+
+	if _, err := RejectKYC(submission.ID, reviewer, "mismatch"); err != nil {
+		t.Fatalf("RejectKYC() error = %v", err)
+	}
+	assertWalletTier(t, wallet, model.KYCRejected, 0)
+
+	// 被拒绝后可以重新提交
+	if _, err := SubmitKYC(user.ID, 1, kycTestDocument, submitter); err != nil {
+		t.Fatalf("resubmit error = %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dataMigration 一次性数据迁移, 执行成功后记录在 data_migrations 表中
+type dataMigration struct {
+	Name string
+	Run  func() error
+}
+
+// 按顺序执行, 新的迁移追加在末尾
+var dataMigrations = []dataMigration{
+	{Name: "0001_import_legacy_evidence_files", Run: importLegacyEvidenceFiles},
+	{Name: "0002_assign_encrypted_record_owners", Run: assignEncryptedRecordOwners},
+	{Name: "0003_assign_encrypted_record_roles", Run: assignEncryptedRecordRoles},
+	{Name: "0004_seal_wallet_private_keys", Run: sealLegacyWalletKeys},
+	{Name: "0005_create_users_from_wallet_usernames", Run: createUsersFromWalletUsernames},
+}
+
+// migrationIncomplete 迁移有需要人工处理的数据, 其余数据已经迁移
+type migrationIncomplete struct {
+	Pending int
+	Detail  string
+}
+
+func (e *migrationIncomplete) Error() string {
+	return fmt.Sprintf("%d items need attention, %s", e.Pending, e.Detail)
+}
+
+// RunMigrations 执行尚未执行的数据迁移, 未完成的迁移在下次启动时重新执行
+func RunMigrations() error {
+	for _, m := range dataMigrations {
+		var count int64
+		if err := model.DB.Model(&model.DataMigration{}).Where("name = ?", m.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		log.Printf("running data migration %s", m.Name)
+		if err := m.Run(); err != nil {
+			if incomplete, ok := err.(*migrationIncomplete); ok {
+				// 不阻塞启动, 也不标记为完成, 下次启动重新执行
+				log.Printf("data migration %s is incomplete: %v", m.Name, incomplete)
+				continue
+			}
+			return fmt.Errorf("data migration %s failed: %v", m.Name, err)
+		}
+		if err := model.DB.Create(&model.DataMigration{Name: m.Name}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importLegacyEvidenceFiles 将 ./evidence/wallet-<id>-<时间>-<状态>.txt 导入申请记录和附件存储
+// 无法导入的文件记录在 legacy_evidence_skips 表中, 有记录时迁移保持未完成
+func importLegacyEvidenceFiles() error {
+	dir := config.GlobalConfig.Evidence.LegacyDir
+	if dir == "" {
+		dir = "./evidence"
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "wallet-*.txt"))
+	if err != nil {
+		return err
+	}
+
+	// 每次执行重新统计, 已修正或移走的文件不再保留记录
+	if err := model.DB.Where("1 = 1").Delete(&model.LegacyEvidenceSkip{}).Error; err != nil {
+		return err
+	}
+	var skipped int
+	skip := func(fileName, reason string) error {
+		log.Printf("skip legacy evidence file %s: %s", fileName, reason)
+		skipped++
+		return model.DB.Create(&model.LegacyEvidenceSkip{FileName: fileName, Reason: reason}).Error
+	}
+
+	for _, file := range files {
+		fileName := filepath.Base(file)
+		parts := strings.Split(strings.TrimSuffix(fileName, ".txt"), "-")
+		if len(parts) < 4 {
+			if err := skip(fileName, "unexpected name"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		walletID, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			if err := skip(fileName, "invalid wallet id"); err != nil {
+				return err
+			}
+			continue
+		}
+		submittedAt, err := time.ParseInLocation("20060102150405", parts[2], time.Local)
+		if err != nil {
+			if err := skip(fileName, "invalid timestamp"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var count int64
+		if err := model.DB.Model(&model.RegulatorApplication{}).Where("legacy_file = ?", fileName).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		blob, err := StoreBlob(content)
+		if err == errors.ErrEvidenceTooLarge || err == errors.ErrEvidenceTypeNotAllowed {
+			// 不符合当前附件限制的旧文件保留在原目录, 不阻塞启动
+			if err := skip(fileName, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %v", fileName, err)
+		}
+
+		status := model.ApplicationFailed
+		if parts[3] == "success" {
+			status = model.ApplicationApproved
+		}
+
+		app := &model.RegulatorApplication{
+			WalletID:    uint(walletID),
+			Requester:   "legacy",
+			Status:      status,
+			SubmittedAt: submittedAt,
+			DecidedAt:   &submittedAt,
+			LegacyFile:  fileName,
+			Attachments: []model.ApplicationAttachment{
+				{
+					BlobHash:    blob.Hash,
+					FileName:    fileName,
+					ContentType: blob.ContentType,
+					Size:        blob.Size,
+				},
+			},
+		}
+		if err := model.DB.Create(app).Error; err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		return &migrationIncomplete{Pending: skipped, Detail: "see legacy_evidence_skips for the files that were not imported"}
+	}
+	return nil
+}
+
+// assignEncryptedRecordOwners 旧的加密交易记录都以发起方密钥加密, 归属到交易的发起方钱包
+// 版本 1 的记录在后台重新加密时会补上接收方的副本
+func assignEncryptedRecordOwners() error {
+	return model.DB.Exec(`UPDATE encrypted_transactions et
+		JOIN transactions t ON t.id = et.transaction_id
+		SET et.owner_wallet_id = t.from_wallet_id
+		WHERE et.owner_wallet_id = 0`).Error
+}
+
+// assignEncryptedRecordRoles 根据副本所属钱包是交易的发起方还是接收方标记副本角色
+func assignEncryptedRecordRoles() error {
+	if err := model.DB.Exec(`UPDATE encrypted_transactions et
+		JOIN transactions t ON t.id = et.transaction_id
+		SET et.role = ?
+		WHERE et.role = '' AND et.owner_wallet_id = t.from_wallet_id`, model.RecordViewSender).Error; err != nil {
+		return err
+	}
+	return model.DB.Exec(`UPDATE encrypted_transactions et
+		JOIN transactions t ON t.id = et.transaction_id
+		SET et.role = ?
+		WHERE et.role = '' AND et.owner_wallet_id = t.to_wallet_id`, model.RecordViewReceiver).Error
+}
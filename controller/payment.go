@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	paymentRequestRefPrefix   = "pr_"
+	paymentMemoMaxBytes       = 255
+	defaultPaymentRequestTTL  = 24 * time.Hour
+	defaultPaymentExpiryCheck = time.Minute
+)
+
+// PaymentRequestInput 创建收款请求的参数
+type PaymentRequestInput struct {
+	PayeeWalletID uint       `json:"payee_wallet_id" binding:"required"`
+	PayerWalletID uint       `json:"payer_wallet_id"` // 可选, 只允许该钱包付款
+	Amount        float64    `json:"amount" binding:"required"`
+	Memo          string     `json:"memo"`
+	ExpiresAt     *time.Time `json:"expires_at"` // 可选, 默认 payments.request_ttl_minutes
+}
+
+// PaymentFilter 收款请求和担保的查询条件, WalletID 匹配付款方或收款方
+type PaymentFilter struct {
+	WalletID uint   `json:"wallet_id"`
+	Status   string `json:"status"`
+}
+
+func newPaymentRequestRef() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return paymentRequestRefPrefix + hex.EncodeToString(b), nil
+}
+
+// paymentExpiry 计算到期时间, 未指定时使用默认期限, 不能超过最长期限
+func paymentExpiry(expiresAt *time.Time, defaultTTL time.Duration, maxHours int) (time.Time, error) {
+	now := time.Now()
+	if expiresAt == nil {
+		return now.Add(defaultTTL), nil
+	}
+	if !expiresAt.After(now) {
+		return time.Time{}, fmt.Errorf("expires_at must be in the future")
+	}
+	if maxHours > 0 && expiresAt.After(now.Add(time.Duration(maxHours)*time.Hour)) {
+		return time.Time{}, fmt.Errorf("expires_at must be within %d hours", maxHours)
+	}
+	return *expiresAt, nil
+}
+
+func validatePaymentAmount(amount float64, memo string) error {
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if len(memo) > paymentMemoMaxBytes {
+		return fmt.Errorf("memo must not exceed %d bytes", paymentMemoMaxBytes)
+	}
+	return nil
+}
+
+// CreatePaymentRequest 收款方创建收款请求
+func CreatePaymentRequest(input *PaymentRequestInput, creator *model.Account) (*model.PaymentRequest, error) {
+	if err := validatePaymentAmount(input.Amount, input.Memo); err != nil {
+		return nil, err
+	}
+	if input.PayerWalletID == input.PayeeWalletID {
+		return nil, fmt.Errorf("payer and payee wallets must differ")
+	}
+
+	cfg := config.GlobalConfig.Payments
+	ttl := defaultPaymentRequestTTL
+	if cfg.RequestTTLMinutes > 0 {
+		ttl = time.Duration(cfg.RequestTTLMinutes) * time.Minute
+	}
+	expiresAt, err := paymentExpiry(input.ExpiresAt, ttl, cfg.RequestMaxTTLHours)
+	if err != nil {
+		return nil, err
+	}
+
+	payee, err := GetWalletByID(input.PayeeWalletID)
+	if err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+	if err := CheckWalletCanReceive(payee); err != nil {
+		return nil, err
+	}
+	if input.PayerWalletID != 0 {
+		if _, err := GetWalletByID(input.PayerWalletID); err != nil {
+			return nil, errors.ErrWalletNotFound
+		}
+	}
+
+	ref, err := newPaymentRequestRef()
+	if err != nil {
+		return nil, err
+	}
+	request := &model.PaymentRequest{
+		Ref:           ref,
+		PayeeWalletID: input.PayeeWalletID,
+		PayerWalletID: input.PayerWalletID,
+		Amount:        input.Amount,
+		Memo:          input.Memo,
+		Status:        model.PaymentRequestPending,
+		ExpiresAt:     expiresAt,
+		CreatedBy:     creator.ID,
+	}
+	if err := model.DB.Create(request).Error; err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetPaymentRequest 按公开编号获取收款请求
+func GetPaymentRequest(ref string) (*model.PaymentRequest, error) {
+	var request model.PaymentRequest
+	if err := model.DB.Where("ref = ?", ref).First(&request).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrPaymentRequestNotFound
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// PayPaymentRequest 付款方以普通转账支付收款请求, 转账和请求状态在同一事务中提交, 与普通转账一样受 KYC 等级限额约束
+// from, to 和 amount 来自付款方签名的转账请求, 必须与收款请求一致
+func PayPaymentRequest(ref string, from, to *model.Wallet, amount float64) (*model.PaymentRequest, error) {
+	if err := CheckTransferAllowed(from, to); err != nil {
+		return nil, err
+	}
+
+	var request model.PaymentRequest
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ref = ?", ref).First(&request).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.ErrPaymentRequestNotFound
+			}
+			return err
+		}
+		if request.Status != model.PaymentRequestPending {
+			return errors.ErrPaymentRequestState
+		}
+		if !time.Now().Before(request.ExpiresAt) {
+			return errors.ErrPaymentRequestExpired
+		}
+		if to.ID != request.PayeeWalletID || amount != request.Amount ||
+			(request.PayerWalletID != 0 && from.ID != request.PayerWalletID) {
+			return errors.ErrPaymentMismatch
+		}
+		if err := checkTierLimits(tx, from, to, amount); err != nil {
+			return err
+		}
+
+		transfer, err := normalTransfer(tx, from, to, amount)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		request.Status = model.PaymentRequestPaid
+		request.PayerWalletID = from.ID
+		request.TransactionID = transfer.ID
+		request.PaidAt = &now
+		return tx.Model(&request).Updates(map[string]interface{}{
+			"status":          request.Status,
+			"payer_wallet_id": request.PayerWalletID,
+			"transaction_id":  request.TransactionID,
+			"paid_at":         now,
+		}).Error
+	})
+	if err != nil {
+		return nil, tierLimitError(from, to, amount, err)
+	}
+	return &request, nil
+}
+
+// CancelPaymentRequest 收款方取消未付款的收款请求
+func CancelPaymentRequest(ref string) (*model.PaymentRequest, error) {
+	request, err := GetPaymentRequest(ref)
+	if err != nil {
+		return nil, err
+	}
+	result := model.DB.Model(&model.PaymentRequest{}).
+		Where("id = ? AND status = ?", request.ID, model.PaymentRequestPending).
+		Update("status", model.PaymentRequestCancelled)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.ErrPaymentRequestState
+	}
+	request.Status = model.PaymentRequestCancelled
+	return request, nil
+}
+
+// ListPaymentRequests 分页查询收款请求
+func ListPaymentRequests(filter PaymentFilter, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.PaymentRequest{})
+	if filter.WalletID != 0 {
+		query = query.Where("(payee_wallet_id = ? OR payer_wallet_id = ?)", filter.WalletID, filter.WalletID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var requests []model.PaymentRequest
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     requests,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// ExpirePaymentRequests 把到期未付款的收款请求标记为过期
+func ExpirePaymentRequests() (int64, error) {
+	result := model.DB.Model(&model.PaymentRequest{}).
+		Where("status = ? AND expires_at <= ?", model.PaymentRequestPending, time.Now()).
+		Update("status", model.PaymentRequestExpired)
+	return result.RowsAffected, result.Error
+}
+
+// StartPaymentExpiry 启动定时处理到期收款请求和担保的任务
+func StartPaymentExpiry() {
+	interval := defaultPaymentExpiryCheck
+	if s := config.GlobalConfig.Payments.ExpiryCheckSeconds; s > 0 {
+		interval = time.Duration(s) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expired, err := ExpirePaymentRequests()
+			if err != nil {
+				log.Printf("failed to expire payment requests: %v", err)
+			} else if expired > 0 {
+				log.Printf("expired %d payment requests", expired)
+			}
+
+			refunded, err := ExpireEscrowHolds()
+			if err != nil {
+				log.Printf("failed to expire escrow holds: %v", err)
+			}
+			if refunded > 0 {
+				log.Printf("refunded %d expired escrow holds", refunded)
+			}
+		}
+	}()
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"hufu/model"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func createPaymentWallets(t *testing.T) (*model.Wallet, *model.Wallet) {
+	t.Helper()
+	setupTierDB(t, &model.PaymentRequest{})
+	_, payer := createKYCUser(t, model.KYCUnverified, 0)
+	payee := &model.Wallet{UserID: payer.UserID, Username: payer.Username}
+	if err := model.DB.Create(payee).Error; err != nil {
+		t.Fatal(err)
+	}
+	fundWallet(t, payer, 5000)
+	return payer, payee
+}
+
+func TestPayPaymentRequestAppliesTierLimits(t *testing.T) {
+	payer, payee := createPaymentWallets(t)
+	request := &model.PaymentRequest{
+		Ref:           "pr-over-tier",
+		PayeeWalletID: payee.ID,
+		Amount:        1500,
+		Status:        model.PaymentRequestPending,
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}
+	if err := model.DB.Create(request).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := PayPaymentRequest(request.Ref, payer, payee, request.Amount)
+	assertTierLimitError(t, err)
+
+	stored, err := GetPaymentRequest(request.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.PaymentRequestPending {
+		t.Fatalf("request status = %s, want pending", stored.Status)
+	}
+	var wallet model.Wallet
+	model.DB.First(&wallet, payer.ID)
+	if wallet.Balance != 5000 {
+		t.Fatalf("payer balance = %v, want 5000", wallet.Balance)
+	}
+	var abnormal int64
+	model.DB.Model(&model.AbnormalTransaction{}).Where("wallet_id = ?", payer.ID).Count(&abnormal)
+	if abnormal != 1 {
+		t.Fatalf("abnormal transactions = %d, want 1", abnormal)
+	}
+}
+
+func TestCreateEscrowHoldAppliesTierLimits(t *testing.T) {
+	payer, payee := createPaymentWallets(t)
+	creator := &model.Account{Model: gorm.Model{ID: 1}}
+
+	_, err := CreateEscrowHold(payer, payee, 1500, "", nil, creator)
+	assertTierLimitError(t, err)
+
+	// 未结束的担保计入日累计金额: 两笔 800 之后第三笔超过 2000
+	for i := 0; i < 2; i++ {
+		if _, err := CreateEscrowHold(payer, payee, 800, "", nil, creator); err != nil {
+			t.Fatalf("CreateEscrowHold() error = %v", err)
+		}
+	}
+	_, err = CreateEscrowHold(payer, payee, 800, "", nil, creator)
+	assertTierLimitError(t, err)
+
+	var wallet model.Wallet
+	model.DB.First(&wallet, payer.ID)
+	if wallet.HeldBalance != 1600 {
+		t.Fatalf("held balance = %v, want 1600", wallet.HeldBalance)
+	}
+}
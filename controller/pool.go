@@ -39,10 +39,14 @@ func InitWalletPool() {
 	if len(existingWallets) == 0 {
 		// 如果池中没有钱包，则创建新的钱包
 		for i := 0; i < initCount; i++ {
-			wallet, err := NewWallet(fmt.Sprintf("%s%d", initPrefix, i), fmt.Sprintf("proxy-user%d", i), initBalance)
+			wallet, err := NewWallet(nil, fmt.Sprintf("%s%d", initPrefix, i), fmt.Sprintf("proxy-user%d", i), "")
 			if err != nil {
 				log.Fatal(err)
 			}
+			if _, err := SystemDeposit(wallet.ID, initBalance, ReasonInitialFunding); err != nil {
+				log.Fatal(err)
+			}
+			wallet.Balance = initBalance
 			GlobalWalletPool.AddWallet(wallet)
 		}
 	} else {
@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"hufu/tee"
+	"hufu/utils"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	recordKeySize          = 32
+	recordAADFormat        = "hufu-transaction-record:v%d:%d"
+	reencryptBatch         = 100
+	reencryptBackoff       = time.Minute
+	reencryptRetryInterval = time.Hour
+)
+
+// TransactionRecord 加密交易记录的明文内容
+type TransactionRecord struct {
+	TransactionID uint    `json:"transaction_id"`
+	From          uint    `json:"from"`
+	To            uint    `json:"to"`
+	Amount        float64 `json:"amount"`
+}
+
+// recordAAD 记录的附加数据, 绑定版本和交易ID, 密文无法被挪到其他交易上
+func recordAAD(version int, transactionID uint) []byte {
+	return []byte(fmt.Sprintf(recordAADFormat, version, transactionID))
+}
+
+func recordDecryptFailed(format string, args ...interface{}) error {
+	return errors.NewHufuError(errors.ErrRecordDecryptFailed.Code, errors.ErrRecordDecryptFailed.Message+": "+fmt.Sprintf(format, args...))
+}
+
+// recordKeyID 由 hex 模数推导密钥ID, 与 enclave 加密公钥ID的算法一致
+func recordKeyID(hexPublicKey string) string {
+	modulus, err := hex.DecodeString(strings.ReplaceAll(hexPublicKey, " ", ""))
+	if err != nil {
+		return ""
+	}
+	return tee.EncryptionKeyID(new(big.Int).SetBytes(modulus))
+}
+
+// WalletKeyRef 钱包密钥的引用, 记录在副本上以便密钥轮换后识别
+func WalletKeyRef(walletKey *model.WalletKey) string {
+	return fmt.Sprintf("wallet:%d:%s", walletKey.WalletID, recordKeyID(walletKey.PublicKey))
+}
+
+// regulatorKeyRef 监管托管密钥的引用
+func regulatorKeyRef(hexPublicKey string) string {
+	return "regulator:" + recordKeyID(hexPublicKey)
+}
+
+// walletView 钱包持有的副本
+type walletView struct {
+	walletID uint
+	role     model.RecordViewRole
+}
+
+// SealTransactionCopies 为发起方, 接收方以及配置的监管托管密钥各生成一份加密副本
+func SealTransactionCopies(record *TransactionRecord) ([]*model.EncryptedTransaction, error) {
+	views := []walletView{{record.From, model.RecordViewSender}}
+	if record.To != record.From {
+		views = append(views, walletView{record.To, model.RecordViewReceiver})
+	}
+
+	copies := make([]*model.EncryptedTransaction, 0, len(views)+1)
+	for _, view := range views {
+		walletKey, err := GetWalletKeyByWalletID(view.walletID)
+		if err != nil {
+			return nil, fmt.Errorf("wallet key %d: %v", view.walletID, err)
+		}
+		sealed, err := SealTransactionRecord(walletKey, view.role, record)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, sealed)
+	}
+
+	if escrowKey := config.GlobalConfig.Records.RegulatorEscrowKey; escrowKey != "" {
+		sealed, err := sealRecord(escrowKey, record)
+		if err != nil {
+			return nil, fmt.Errorf("regulator escrow key: %v", err)
+		}
+		sealed.Role = model.RecordViewRegulator
+		sealed.KeyRef = regulatorKeyRef(escrowKey)
+		copies = append(copies, sealed)
+	}
+	return copies, nil
+}
+
+// SealTransactionRecord 以钱包密钥加密记录, 生成该钱包持有的副本
+func SealTransactionRecord(walletKey *model.WalletKey, role model.RecordViewRole, record *TransactionRecord) (*model.EncryptedTransaction, error) {
+	sealed, err := sealRecord(walletKey.PublicKey, record)
+	if err != nil {
+		return nil, err
+	}
+	sealed.OwnerWalletID = walletKey.WalletID
+	sealed.Role = role
+	sealed.KeyRef = WalletKeyRef(walletKey)
+	return sealed, nil
+}
+
+// sealRecord 为记录生成一次性数据密钥, 以 RSA 公钥封装后用 AES-GCM 加密记录
+func sealRecord(hexPublicKey string, record *TransactionRecord) (*model.EncryptedTransaction, error) {
+	plaintext, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, recordKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	aad := recordAAD(model.EncryptedRecordV2, record.TransactionID)
+	wrappedKey, err := utils.RSAWrapKeyWithHexKey(dataKey, hexPublicKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := utils.AESGCMSeal(dataKey, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.EncryptedTransaction{
+		TransactionID: record.TransactionID,
+		Version:       model.EncryptedRecordV2,
+		WrappedKey:    wrappedKey,
+		Nonce:         nonce,
+		Ciphertext:    ciphertext,
+	}, nil
+}
+
+// OpenTransactionRecord 使用钱包私钥解密记录, 兼容版本 1 的旧记录
+func OpenTransactionRecord(walletKey *model.WalletKey, et *model.EncryptedTransaction) (*TransactionRecord, error) {
+	if et.KeyRef != "" && et.KeyRef != WalletKeyRef(walletKey) {
+		return nil, recordDecryptFailed("记录使用的密钥 %s 与当前钱包密钥不一致", et.KeyRef)
+	}
+	privateKey, err := UnsealWalletPrivateKey(walletKey)
+	if err != nil {
+		return nil, err
+	}
+	switch et.Version {
+	case model.EncryptedRecordV2:
+		return openRecordV2(walletKey.PublicKey, privateKey, et)
+	case model.EncryptedRecordLegacy, 0:
+		return openRecordLegacy(walletKey.PublicKey, privateKey, et)
+	default:
+		return nil, recordDecryptFailed("不支持的记录版本 %d", et.Version)
+	}
+}
+
+func openRecordV2(publicKey, privateKey string, et *model.EncryptedTransaction) (*TransactionRecord, error) {
+	aad := recordAAD(et.Version, et.TransactionID)
+	dataKey, err := utils.RSAUnwrapKeyWithHexKey(et.WrappedKey, privateKey, publicKey, aad)
+	if err != nil {
+		return nil, recordDecryptFailed("无法解封数据密钥")
+	}
+	plaintext, err := utils.AESGCMOpen(dataKey, et.Nonce, et.Ciphertext, aad)
+	if err != nil {
+		return nil, recordDecryptFailed("记录认证失败")
+	}
+
+	var record TransactionRecord
+	decoder := json.NewDecoder(bytes.NewReader(plaintext))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&record); err != nil {
+		return nil, recordDecryptFailed("记录格式错误: %v", err)
+	}
+	if record.TransactionID != et.TransactionID {
+		return nil, recordDecryptFailed("记录交易ID %d 与 %d 不一致", record.TransactionID, et.TransactionID)
+	}
+	return &record, nil
+}
+
+func openRecordLegacy(publicKey, privateKey string, et *model.EncryptedTransaction) (*TransactionRecord, error) {
+	from, err := utils.RSADecryptWithHexKey(et.EncryptedFromWalletID, privateKey, publicKey)
+	if err != nil {
+		return nil, recordDecryptFailed("from: %v", err)
+	}
+	to, err := utils.RSADecryptWithHexKey(et.EncryptedToWalletID, privateKey, publicKey)
+	if err != nil {
+		return nil, recordDecryptFailed("to: %v", err)
+	}
+	amount, err := utils.RSADecryptWithHexKey(et.EncryptedAmount, privateKey, publicKey)
+	if err != nil {
+		return nil, recordDecryptFailed("amount: %v", err)
+	}
+
+	fromID, err := strconv.ParseUint(from, 10, 32)
+	if err != nil {
+		return nil, recordDecryptFailed("from 格式错误")
+	}
+	toID, err := strconv.ParseUint(to, 10, 32)
+	if err != nil {
+		return nil, recordDecryptFailed("to 格式错误")
+	}
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return nil, recordDecryptFailed("amount 格式错误")
+	}
+	return &TransactionRecord{
+		TransactionID: et.TransactionID,
+		From:          uint(fromID),
+		To:            uint(toID),
+		Amount:        value,
+	}, nil
+}
+
+// reencryptLegacyRecord 使用交易发起方的密钥解密旧记录并以版本 2 重新加密, 同时补上接收方和监管方的副本
+func reencryptLegacyRecord(et *model.EncryptedTransaction) error {
+	var tx model.Transaction
+	if err := model.DB.First(&tx, et.TransactionID).Error; err != nil {
+		return fmt.Errorf("transaction %d: %v", et.TransactionID, err)
+	}
+	walletKey, err := GetWalletKeyByWalletID(tx.FromWalletID)
+	if err != nil {
+		return fmt.Errorf("wallet key %d: %v", tx.FromWalletID, err)
+	}
+	privateKey, err := UnsealWalletPrivateKey(walletKey)
+	if err != nil {
+		return err
+	}
+	record, err := openRecordLegacy(walletKey.PublicKey, privateKey, et)
+	if err != nil {
+		return err
+	}
+	copies, err := SealTransactionCopies(record)
+	if err != nil {
+		return err
+	}
+
+	return model.DB.Transaction(func(db *gorm.DB) error {
+		sealed := copies[0]
+		result := db.Model(et).Where("version = ?", model.EncryptedRecordLegacy).Updates(map[string]interface{}{
+			"owner_wallet_id":          sealed.OwnerWalletID,
+			"role":                     sealed.Role,
+			"key_ref":                  sealed.KeyRef,
+			"version":                  sealed.Version,
+			"wrapped_key":              sealed.WrappedKey,
+			"nonce":                    sealed.Nonce,
+			"ciphertext":               sealed.Ciphertext,
+			"encrypted_from_wallet_id": "",
+			"encrypted_to_wallet_id":   "",
+			"encrypted_amount":         "",
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		for _, view := range copies[1:] {
+			var count int64
+			if err := db.Model(&model.EncryptedTransaction{}).
+				Where("transaction_id = ? AND role = ?", view.TransactionID, view.Role).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			view.CreatedAt = et.CreatedAt
+			if err := db.Create(view).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReencryptLegacyRecords 分批重新加密版本 1 的记录, 返回成功和跳过的数量
+// 无法解密的记录保留原样并记录日志, 由 StartRecordReencryption 定期重试, 在此之前仍出现在发起方的历史记录中
+func ReencryptLegacyRecords() (int, int, error) {
+	var lastID uint
+	converted, skipped := 0, 0
+	for {
+		var batch []model.EncryptedTransaction
+		if err := model.DB.Where("version = ? AND id > ?", model.EncryptedRecordLegacy, lastID).
+			Order("id").Limit(reencryptBatch).Find(&batch).Error; err != nil {
+			return converted, skipped, err
+		}
+		if len(batch) == 0 {
+			return converted, skipped, nil
+		}
+		for i := range batch {
+			lastID = batch[i].ID
+			if err := reencryptLegacyRecord(&batch[i]); err != nil {
+				log.Printf("skip re-encrypting transaction record %d: %v", batch[i].ID, err)
+				skipped++
+				continue
+			}
+			converted++
+		}
+	}
+}
+
+// StartRecordReencryption 在后台将旧记录迁移到版本 2, 数据库出错时稍后重试, 有跳过的记录时定期重试直到全部完成
+func StartRecordReencryption() {
+	go func() {
+		for {
+			converted, skipped, err := ReencryptLegacyRecords()
+			if converted > 0 || skipped > 0 {
+				log.Printf("re-encrypted %d transaction records, skipped %d", converted, skipped)
+			}
+			if err != nil {
+				log.Printf("failed to re-encrypt transaction records: %v", err)
+				time.Sleep(reencryptBackoff)
+				continue
+			}
+			if skipped == 0 {
+				return
+			}
+			// 跳过的记录通常是钱包密钥暂时无法解封或 KMS 不可用, 稍后重试
+			time.Sleep(reencryptRetryInterval)
+		}
+	}()
+}
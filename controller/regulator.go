@@ -2,95 +2,206 @@ package controller
 
 import (
 	"fmt"
+	"log"
+	"strconv"
 	"time"
 
+	"hufu/config"
 	"hufu/model"
 	"hufu/supervisor"
 	"hufu/utils"
+
+	"gorm.io/gorm"
 )
 
 type Regulator struct {
+	tier                 int
 	maxTransactionAmount float64
 	maxDailyAmount       float64
-	suspiciousFrequency  int // 每小时可疑交易频率阈值
+	suspiciousFrequency  int     // 每小时可疑交易频率阈值
+	alertAmount          float64 // 达到该金额的交易向监管方告警, 0 表示不告警
 }
 
-func NewRegulator() *Regulator {
+// NewRegulator 按 KYC 等级的监管策略创建监管规则
+func NewRegulator(tier int, policy *config.TierPolicy) *Regulator {
 	return &Regulator{
-		maxTransactionAmount: 10000,
-		maxDailyAmount:       50000,
-		suspiciousFrequency:  100,
+		tier:                 tier,
+		maxTransactionAmount: policy.MaxTransactionAmount,
+		maxDailyAmount:       policy.MaxDailyAmount,
+		suspiciousFrequency:  policy.HourlyFrequency,
+		alertAmount:          policy.AlertAmount,
+	}
+}
+
+// RegulatorForWallet 按钱包适用的 KYC 等级创建监管规则
+func RegulatorForWallet(w *model.Wallet) (*Regulator, error) {
+	profile, err := WalletKYCProfile(w)
+	if err != nil {
+		return nil, err
 	}
+	return NewRegulator(profile.Tier, profile.Policy), nil
 }
 
+// SendAlert 记录需要监管方关注但未违反限额的交易
 func (r *Regulator) SendAlert(tx *model.Transaction, evidence string) error {
+	log.Printf("regulator alert: transaction %d from wallet %d (kyc tier %d): %s", tx.ID, tx.FromWalletID, r.tier, evidence)
 	return nil
 }
 
-func (r *Regulator) CheckTransaction(tx *model.Transaction, w *model.Wallet) error {
+// 监管规则标识, 记录在异常交易证据中
+const (
+	RuleMaxTransactionAmount = "max_transaction_amount"
+	RuleMaxDailyAmount       = "max_daily_amount"
+	RuleHourlyFrequency      = "hourly_frequency"
+	RuleCheckFailed          = "check_failed"
+	RuleTeeWarning           = "tee_transaction_warning"
+)
+
+// RuleViolation 命中的监管规则及触发时的输入值
+type RuleViolation struct {
+	Rule    string
+	Message string
+	Inputs  map[string]string
+}
+
+func (v *RuleViolation) Error() string {
+	return v.Message
+}
+
+// CheckTransaction 按 KYC 等级的限额检查交易, 违规时返回 RuleViolation, 输入值中记录适用的等级
+// 统计在 db 上执行, 在事务中调用时能看到事务内已写入的转账; 已保存的交易本身不计入统计
+func (r *Regulator) CheckTransaction(db *gorm.DB, tx *model.Transaction, w *model.Wallet) error {
+	amount := FormatEvidenceAmount(tx.Amount)
+	tier := strconv.Itoa(r.tier)
+
 	// 检查最大交易金额
 	if tx.Amount > r.maxTransactionAmount {
-		return fmt.Errorf("交易金额超过允许的最大值: %f", r.maxTransactionAmount)
+		return &RuleViolation{
+			Rule:    RuleMaxTransactionAmount,
+			Message: fmt.Sprintf("交易金额超过允许的最大值: %f", r.maxTransactionAmount),
+			Inputs: map[string]string{
+				"amount":   amount,
+				"limit":    FormatEvidenceAmount(r.maxTransactionAmount),
+				"kyc_tier": tier,
+			},
+		}
 	}
 
 	// 检查日累计交易金额
-	dailyAmount, _ := r.getDailyTransactionAmount(w.ID)
+	dailyAmount, err := r.getDailyTransactionAmount(db, w.ID, tx.ID)
+	if err != nil {
+		return &RuleViolation{
+			Rule:    RuleCheckFailed,
+			Message: fmt.Sprintf("获取日交易总额失败: %v", err),
+			Inputs:  map[string]string{"amount": amount},
+		}
+	}
 	if dailyAmount+tx.Amount > r.maxDailyAmount {
-		return fmt.Errorf("日交易总额超过限制: %f", r.maxDailyAmount)
+		return &RuleViolation{
+			Rule:    RuleMaxDailyAmount,
+			Message: fmt.Sprintf("日交易总额超过限制: %f", r.maxDailyAmount),
+			Inputs: map[string]string{
+				"amount":       amount,
+				"daily_amount": FormatEvidenceAmount(dailyAmount),
+				"limit":        FormatEvidenceAmount(r.maxDailyAmount),
+				"kyc_tier":     tier,
+			},
+		}
 	}
 
 	// 检查交易频率
-	frequency, err := r.getHourlyTransactionFrequency(w.ID)
+	frequency, err := r.getHourlyTransactionFrequency(db, w.ID, tx.ID)
 	if err != nil {
-		return fmt.Errorf("获取交易频率失败: %v", err)
+		return &RuleViolation{
+			Rule:    RuleCheckFailed,
+			Message: fmt.Sprintf("获取交易频率失败: %v", err),
+			Inputs:  map[string]string{"amount": amount},
+		}
 	}
 	if frequency >= r.suspiciousFrequency {
 		// 记录可疑交易
-		return fmt.Errorf("交易频率过高")
+		return &RuleViolation{
+			Rule:    RuleHourlyFrequency,
+			Message: "交易频率过高",
+			Inputs: map[string]string{
+				"amount":    amount,
+				"frequency": strconv.Itoa(frequency),
+				"limit":     strconv.Itoa(r.suspiciousFrequency),
+				"kyc_tier":  tier,
+			},
+		}
+	}
+
+	if r.alertAmount > 0 && tx.Amount >= r.alertAmount {
+		r.SendAlert(tx, fmt.Sprintf("amount %s reaches alert threshold %s", amount, FormatEvidenceAmount(r.alertAmount)))
 	}
 
 	return nil
 }
 
-// 获取钱包当日交易总额
-func (r *Regulator) getDailyTransactionAmount(walletID uint) (float64, error) {
-	var totalAmount float64
+// limitedTransactionTypes 计入日累计金额的转出交易, 包括担保释放
+var limitedTransactionTypes = []model.TransactionType{model.DirectTransaction, model.EscrowTransaction}
+
+// countedTransactionStatuses 计入限额的交易状态, 被拒绝的交易不计入, 否则一次超限尝试会占满当日额度
+var countedTransactionStatuses = []string{TransactionStatusSuccess, TransactionStatusPending}
+
+// 获取钱包当日已完成和进行中的转出总额, 包括当日创建且尚未结束的担保, excludeID 为正在检查的交易
+func (r *Regulator) getDailyTransactionAmount(db *gorm.DB, walletID, excludeID uint) (float64, error) {
+	var totalAmount, heldAmount float64
 	today := time.Now().Format("2006-01-02")
 
-	err := model.DB.Model(&model.Transaction{}).
-		Where("wallet_id = ? AND DATE(created_at) = ?", walletID, today).
+	err := db.Model(&model.Transaction{}).
+		Where("from_wallet_id = ? AND type IN ? AND status IN ? AND id <> ? AND DATE(created_at) = ?",
+			walletID, limitedTransactionTypes, countedTransactionStatuses, excludeID, today).
 		Select("COALESCE(SUM(amount), 0)").
 		Row().
 		Scan(&totalAmount)
+	if err != nil {
+		return 0, err
+	}
+
+	// 担保释放时生成 escrow 交易, 此后担保不再是 held 状态, 不会重复计算
+	err = db.Model(&model.EscrowHold{}).
+		Where("payer_wallet_id = ? AND status = ? AND DATE(created_at) = ?", walletID, model.EscrowHeld, today).
+		Select("COALESCE(SUM(amount), 0)").
+		Row().
+		Scan(&heldAmount)
 
-	return totalAmount, err
+	return totalAmount + heldAmount, err
 }
 
-// 获取每小时交易频率
-func (r *Regulator) getHourlyTransactionFrequency(walletID uint) (int, error) {
+// 获取每小时交易频率, 被拒绝的交易不计入, excludeID 为正在检查的交易
+func (r *Regulator) getHourlyTransactionFrequency(db *gorm.DB, walletID, excludeID uint) (int, error) {
 	var count int64
 	oneHourAgo := time.Now().Add(-time.Hour)
 
-	err := model.DB.Model(&model.Transaction{}).
-		Where("from_wallet_id = ? AND created_at >= ?", walletID, oneHourAgo).
+	err := db.Model(&model.Transaction{}).
+		Where("from_wallet_id = ? AND status IN ? AND id <> ? AND created_at >= ?", walletID, countedTransactionStatuses, excludeID, oneHourAgo).
 		Count(&count).Error
 
 	return int(count), err
 }
 
-func ProcessPrivateKey(walletID uint, evidence string) ([]string, error) {
+// ProcessPrivateKey 拆分钱包私钥, 由陪审团根据证据承诺决定是否提供密钥碎片
+func ProcessPrivateKey(walletID uint, record *model.EvidenceRecord) ([]string, error) {
 	// 获取私钥
 	walletKey, err := GetWalletKeyByWalletID(walletID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get wallet key: %v", err)
 	}
 
-	parts, err := utils.SharePrivateKey(walletKey.PrivateKey)
+	privateKey, err := UnsealWalletPrivateKey(walletKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal wallet key: %v", err)
+	}
+
+	parts, err := utils.SharePrivateKey(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to share private key: %v", err)
 	}
 
-	approved, err := supervisor.JuryInstance.HandleRegulatoryRequest(fmt.Sprintf("wallet-%d-%s", walletID, evidence))
+	// 证据原文保存在链下, 陪审团和区块链只接触证据承诺
+	approved, err := supervisor.JuryInstance.HandleRegulatoryRequest(EvidencePayload(record))
 	if err != nil {
 		return nil, fmt.Errorf("failed to handle regulatory request: %v", err)
 	}
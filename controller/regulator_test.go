@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"testing"
+)
+
+// setupTierDB 钱包使用默认等级 0: 单笔 1000, 日累计 2000
+func setupTierDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	setupTestDB(t, append([]interface{}{&model.User{}, &model.Wallet{}, &model.Transaction{}, &model.AbnormalTransaction{},
+		&model.WalletStatusChange{}, &model.LedgerEntry{}, &model.EscrowHold{}}, models...)...)
+	setupTestSigningKey(t)
+	config.GlobalConfig.KYC.DefaultTier = 0
+	config.GlobalConfig.KYC.Tiers = nil
+	config.GlobalConfig.WalletStatus.ViolationFreezeThreshold = 0
+}
+
+func fundWallet(t *testing.T, w *model.Wallet, amount float64) {
+	t.Helper()
+	if err := model.DB.Model(w).Update("balance", amount).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertTierLimitError(t *testing.T, err error) {
+	t.Helper()
+	hufuErr, ok := err.(*errors.HufuError)
+	if !ok || hufuErr.Code != errors.ErrTransactionAmountTooLarge.Code {
+		t.Fatalf("error = %v, want tier limit error", err)
+	}
+}
+
+func TestRejectedTransferDoesNotCountTowardDailyLimit(t *testing.T) {
+	setupTierDB(t)
+	_, from := createKYCUser(t, model.KYCUnverified, 0)
+	to := &model.Wallet{UserID: from.UserID, Username: from.Username}
+	if err := model.DB.Create(to).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	assertTierLimitError(t, CheckTierLimits(from, to, 1500))
+	var failed int64
+	model.DB.Model(&model.Transaction{}).Where("status = ?", TransactionStatusFailed).Count(&failed)
+	if failed != 1 {
+		t.Fatalf("failed transactions = %d, want 1", failed)
+	}
+
+	if err := CheckTierLimits(from, to, 900); err != nil {
+		t.Fatalf("CheckTierLimits() after a rejected attempt error = %v", err)
+	}
+}
+
+func TestEscrowReleaseCountsTowardDailyLimit(t *testing.T) {
+	setupTierDB(t)
+	_, from := createKYCUser(t, model.KYCUnverified, 0)
+	to := &model.Wallet{UserID: from.UserID, Username: from.Username}
+	if err := model.DB.Create(to).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Create(&model.Transaction{
+		FromWalletID: from.ID,
+		ToWalletID:   to.ID,
+		Amount:       1500,
+		Type:         model.EscrowTransaction,
+		Status:       TransactionStatusSuccess,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	assertTierLimitError(t, CheckTierLimits(from, to, 900))
+}
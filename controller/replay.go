@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"log"
+	"time"
+)
+
+const (
+	defaultReplayMaxTTL          = 10 * time.Minute
+	defaultReplayClockSkew       = 30 * time.Second
+	defaultReplayCleanupInterval = 5 * time.Minute
+)
+
+func replayMaxTTL() time.Duration {
+	if s := config.GlobalConfig.Replay.MaxTTLSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultReplayMaxTTL
+}
+
+func replayClockSkew() time.Duration {
+	if s := config.GlobalConfig.Replay.ClockSkewSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultReplayClockSkew
+}
+
+func transferExpired(format string, args ...interface{}) error {
+	return errors.NewHufuError(errors.ErrTransferExpired.Code, errors.ErrTransferExpired.Message+": "+fmt.Sprintf(format, args...))
+}
+
+// ClaimTransferNonce 登记转账信封的随机数, 在任何资金变动之前调用
+// 已过期, 签发时间在未来或有效期超过上限的请求返回 ErrTransferExpired, 同一发起方重复使用的随机数返回 ErrTransferReplayed
+func ClaimTransferNonce(sender uint64, nonce string, issuedAt, expiresAt int64) error {
+	now := time.Now()
+	skew := replayClockSkew()
+	issued := time.Unix(issuedAt, 0)
+	expires := time.Unix(expiresAt, 0)
+
+	if issued.After(now.Add(skew)) {
+		return transferExpired("签发时间 %s 晚于当前时间", issued.Format(time.DateTime))
+	}
+	if !expires.After(now.Add(-skew)) {
+		return transferExpired("已于 %s 过期", expires.Format(time.DateTime))
+	}
+	if expires.Sub(issued) > replayMaxTTL() {
+		return transferExpired("有效期超过 %s", replayMaxTTL())
+	}
+
+	// 保留到过期时间加上时钟偏差, 在此之前重放都会命中唯一索引
+	record := &model.ReplayNonce{
+		Sender:    sender,
+		Nonce:     nonce,
+		ExpiresAt: expires.Add(skew),
+	}
+	if err := model.DB.Create(record).Error; err != nil {
+		var count int64
+		if countErr := model.DB.Model(&model.ReplayNonce{}).Where("sender = ? AND nonce = ?", sender, nonce).Count(&count).Error; countErr == nil && count > 0 {
+			return errors.ErrTransferReplayed
+		}
+		return err
+	}
+	return nil
+}
+
+// CleanupReplayNonces 删除已过期的随机数
+func CleanupReplayNonces() (int64, error) {
+	result := model.DB.Where("expires_at < ?", time.Now()).Delete(&model.ReplayNonce{})
+	return result.RowsAffected, result.Error
+}
+
+// StartReplayCleanup 定期清理过期的随机数和钱包认证挑战
+func StartReplayCleanup() {
+	interval := defaultReplayCleanupInterval
+	if s := config.GlobalConfig.Replay.CleanupIntervalSeconds; s > 0 {
+		interval = time.Duration(s) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := CleanupReplayNonces()
+			if err != nil {
+				log.Printf("failed to clean up replay nonces: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("removed %d expired replay nonces", removed)
+			}
+
+			removed, err = CleanupWalletChallenges()
+			if err != nil {
+				log.Printf("failed to clean up wallet challenges: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("removed %d expired wallet challenges", removed)
+			}
+		}
+	}()
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupReplayDB 唯一索引与 MySQL 上的行为一致
+func setupReplayDB(t *testing.T) {
+	t.Helper()
+	setupTestDB(t, &model.ReplayNonce{})
+	config.GlobalConfig.Replay.MaxTTLSeconds = 600
+	config.GlobalConfig.Replay.ClockSkewSeconds = 30
+}
+
+func assertReplayError(t *testing.T, err error, want *errors.HufuError) {
+	t.Helper()
+	hufuErr, ok := err.(*errors.HufuError)
+	if !ok || hufuErr.Code != want.Code {
+		t.Fatalf("error = %v, want %s", err, want.Message)
+	}
+}
+
+func TestClaimTransferNonceRejectsReplay(t *testing.T) {
+	setupReplayDB(t)
+	now := time.Now().Unix()
+
+	if err := ClaimTransferNonce(11, "nonce-a", now, now+60); err != nil {
+		t.Fatalf("first claim error = %v", err)
+	}
+	err := ClaimTransferNonce(11, "nonce-a", now, now+60)
+	if err != errors.ErrTransferReplayed {
+		t.Fatalf("replayed claim error = %v, want %v", err, errors.ErrTransferReplayed)
+	}
+
+	// 随机数按发起方区分
+	if err := ClaimTransferNonce(12, "nonce-a", now, now+60); err != nil {
+		t.Fatalf("claim by another sender error = %v", err)
+	}
+}
+
+func TestClaimTransferNonceRejectsExpired(t *testing.T) {
+	setupReplayDB(t)
+	now := time.Now().Unix()
+
+	err := ClaimTransferNonce(11, "nonce-expired", now-300, now-60)
+	assertReplayError(t, err, errors.ErrTransferExpired)
+	if !strings.Contains(err.Error(), "过期") {
+		t.Errorf("error = %v, want expiry detail", err)
+	}
+
+	// 在允许的时钟偏差内仍然接受
+	if err := ClaimTransferNonce(11, "nonce-skew", now-300, now-10); err != nil {
+		t.Fatalf("claim within clock skew error = %v", err)
+	}
+}
+
+func TestClaimTransferNonceRejectsFutureTimestamp(t *testing.T) {
+	setupReplayDB(t)
+	now := time.Now().Unix()
+
+	err := ClaimTransferNonce(11, "nonce-future", now+120, now+180)
+	assertReplayError(t, err, errors.ErrTransferExpired)
+	if !strings.Contains(err.Error(), "晚于当前时间") {
+		t.Errorf("error = %v, want future timestamp detail", err)
+	}
+
+	if err := ClaimTransferNonce(11, "nonce-near-future", now+10, now+60); err != nil {
+		t.Fatalf("claim within clock skew error = %v", err)
+	}
+}
+
+func TestClaimTransferNonceRejectsLongTTL(t *testing.T) {
+	setupReplayDB(t)
+	now := time.Now().Unix()
+
+	err := ClaimTransferNonce(11, "nonce-long", now, now+3600)
+	assertReplayError(t, err, errors.ErrTransferExpired)
+}
+
+func TestCleanupReplayNonces(t *testing.T) {
+	setupReplayDB(t)
+	now := time.Now()
+
+	expired := &model.ReplayNonce{Sender: 11, Nonce: "nonce-old", ExpiresAt: now.Add(-time.Minute)}
+	if err := model.DB.Create(expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ClaimTransferNonce(11, "nonce-live", now.Unix(), now.Unix()+60); err != nil {
+		t.Fatalf("claim error = %v", err)
+	}
+
+	removed, err := CleanupReplayNonces()
+	if err != nil {
+		t.Fatalf("CleanupReplayNonces() error = %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+
+	// 清理后过期的随机数不会再被接受为新请求, 因为签名时间已过期
+	err = ClaimTransferNonce(11, "nonce-old", now.Add(-5*time.Minute).Unix(), now.Add(-time.Minute).Unix())
+	assertReplayError(t, err, errors.ErrTransferExpired)
+
+	// 未过期的随机数仍然保留, 重放继续被拒绝
+	if err := ClaimTransferNonce(11, "nonce-live", now.Unix(), now.Unix()+60); err != errors.ErrTransferReplayed {
+		t.Fatalf("replay after cleanup error = %v, want %v", err, errors.ErrTransferReplayed)
+	}
+}
@@ -0,0 +1,584 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hufu/config"
+	"hufu/cron"
+	"hufu/errors"
+	"hufu/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultSchedulePoll          = 30 * time.Second
+	defaultScheduleBatchSize     = 100
+	defaultScheduleRetryInterval = 10 * time.Minute
+	defaultNotifyTimeout         = 10 * time.Second
+	scheduleErrorMaxLen          = 255
+)
+
+// ScheduleInput 创建计划转账的参数, RunAt 和 Cron 二选一
+type ScheduleInput struct {
+	FromWalletID uint       `json:"from_wallet_id" binding:"required"`
+	ToWalletID   uint       `json:"to_wallet_id" binding:"required"`
+	Amount       float64    `json:"amount" binding:"required"`
+	Mode         string     `json:"mode"` // normal 或 proxy, 默认 normal
+	RunAt        *time.Time `json:"run_at"`
+	Cron         string     `json:"cron"`
+	EndAt        *time.Time `json:"end_at"`
+	Memo         string     `json:"memo"`
+}
+
+// ScheduleFilter 计划转账查询条件, WalletID 匹配转出或转入钱包
+type ScheduleFilter struct {
+	WalletID uint   `json:"wallet_id"`
+	Status   string `json:"status"`
+}
+
+// ScheduleFailureNotice 计划转账执行失败的通知内容
+type ScheduleFailureNotice struct {
+	ScheduleID   uint      `json:"schedule_id"`
+	FromWalletID uint      `json:"from_wallet_id"`
+	ToWalletID   uint      `json:"to_wallet_id"`
+	Amount       float64   `json:"amount"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	Attempts     int       `json:"attempts"`
+	Error        string    `json:"error"`
+	Status       string    `json:"status"` // 计划当前状态
+}
+
+// scheduleRule 计划的执行规则, 签名内容的一部分
+func scheduleRule(input *ScheduleInput) string {
+	if input.RunAt != nil {
+		return "at:" + strconv.FormatInt(input.RunAt.Unix(), 10)
+	}
+	rule := "cron:" + input.Cron
+	if input.EndAt != nil {
+		rule += ":until:" + strconv.FormatInt(input.EndAt.Unix(), 10)
+	}
+	return rule
+}
+
+// ScheduleSigningMessage 创建计划转账的签名内容, 规则放在最后, cron 表达式中的字符不会造成歧义
+func ScheduleSigningMessage(input *ScheduleInput, nonce string, timestamp, expiresAt int64) []byte {
+	mode := input.Mode
+	if mode == "" {
+		mode = model.ScheduleModeNormal
+	}
+	return []byte(fmt.Sprintf("hufu-schedule:v1:%d:%d:%s:%s:%s:%d:%d:%s",
+		input.FromWalletID, input.ToWalletID, FormatEvidenceAmount(input.Amount), mode, nonce, timestamp, expiresAt, scheduleRule(input)))
+}
+
+// nextOccurrence 计算 after 之后的下一次执行时间, 超过截止时间或不会再触发时返回 nil
+func nextOccurrence(s *model.ScheduledTransfer, after time.Time) (*time.Time, error) {
+	if s.CronExpr == "" {
+		return nil, nil
+	}
+	parsed, err := cron.Parse(s.CronExpr)
+	if err != nil {
+		return nil, errors.ErrCronInvalid
+	}
+	next := parsed.Next(after.Local())
+	if next.IsZero() || (s.EndAt != nil && next.After(*s.EndAt)) {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// CreateScheduledTransfer 创建计划转账, 调用方已验证发起钱包对 ScheduleSigningMessage 的签名
+func CreateScheduledTransfer(input *ScheduleInput, signature string, creator *model.Account) (*model.ScheduledTransfer, error) {
+	if err := validatePaymentAmount(input.Amount, input.Memo); err != nil {
+		return nil, err
+	}
+	if input.FromWalletID == input.ToWalletID {
+		return nil, fmt.Errorf("source and destination wallets must differ")
+	}
+	if input.Mode == "" {
+		input.Mode = model.ScheduleModeNormal
+	}
+	if input.Mode != model.ScheduleModeNormal && input.Mode != model.ScheduleModeProxy {
+		return nil, fmt.Errorf("mode must be normal or proxy")
+	}
+	if (input.RunAt == nil) == (input.Cron == "") {
+		return nil, fmt.Errorf("exactly one of run_at and cron is required")
+	}
+
+	from, err := GetWalletByID(input.FromWalletID)
+	if err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+	to, err := GetWalletByID(input.ToWalletID)
+	if err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+	if err := CheckTransferAllowed(from, to); err != nil {
+		return nil, err
+	}
+	if input.Mode == model.ScheduleModeProxy {
+		if err := CheckProxyTransferAllowed(from); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &model.ScheduledTransfer{
+		FromWalletID: input.FromWalletID,
+		ToWalletID:   input.ToWalletID,
+		Amount:       input.Amount,
+		Mode:         input.Mode,
+		Memo:         input.Memo,
+		RunAt:        input.RunAt,
+		CronExpr:     input.Cron,
+		EndAt:        input.EndAt,
+		Status:       model.ScheduleActive,
+		CreatedBy:    creator.ID,
+		Signature:    signature,
+	}
+	if input.RunAt != nil {
+		if !input.RunAt.After(time.Now()) {
+			return nil, fmt.Errorf("run_at must be in the future")
+		}
+		s.EndAt = nil
+		s.NextRunAt = input.RunAt
+	} else {
+		if _, err := cron.Parse(input.Cron); err != nil {
+			return nil, errors.ErrCronInvalid
+		}
+		if s.NextRunAt, err = nextOccurrence(s, time.Now()); err != nil {
+			return nil, err
+		}
+		if s.NextRunAt == nil {
+			return nil, fmt.Errorf("cron expression never fires before end_at")
+		}
+	}
+
+	if err := model.DB.Create(s).Error; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetScheduledTransfer 获取计划转账
+func GetScheduledTransfer(id uint) (*model.ScheduledTransfer, error) {
+	var s model.ScheduledTransfer
+	if err := model.DB.First(&s, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrScheduleNotFound
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// updateSchedule 在行锁内检查状态后更新计划, 与调度器互斥
+func updateSchedule(id uint, allowed []model.ScheduleStatus, update func(s *model.ScheduledTransfer) error) (*model.ScheduledTransfer, error) {
+	var s model.ScheduledTransfer
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&s, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.ErrScheduleNotFound
+			}
+			return err
+		}
+		ok := false
+		for _, status := range allowed {
+			if s.Status == status {
+				ok = true
+			}
+		}
+		if !ok {
+			return errors.ErrScheduleState
+		}
+		if err := update(&s); err != nil {
+			return err
+		}
+		return tx.Save(&s).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// PauseScheduledTransfer 暂停计划转账, 正在等待重试的执行也一并暂停
+func PauseScheduledTransfer(id uint) (*model.ScheduledTransfer, error) {
+	return updateSchedule(id, []model.ScheduleStatus{model.ScheduleActive}, func(s *model.ScheduledTransfer) error {
+		s.Status = model.SchedulePaused
+		return nil
+	})
+}
+
+// ResumeScheduledTransfer 恢复计划转账; 周期计划跳过暂停期间错过的执行时间, 一次性计划已过期时立即执行
+func ResumeScheduledTransfer(id uint) (*model.ScheduledTransfer, error) {
+	return updateSchedule(id, []model.ScheduleStatus{model.SchedulePaused}, func(s *model.ScheduledTransfer) error {
+		now := time.Now()
+		if s.CronExpr != "" && s.RetryAt == nil && s.NextRunAt != nil && s.NextRunAt.Before(now) {
+			next, err := nextOccurrence(s, now)
+			if err != nil {
+				return err
+			}
+			if next == nil {
+				return errors.ErrScheduleState
+			}
+			s.NextRunAt = next
+		}
+		s.Status = model.ScheduleActive
+		return nil
+	})
+}
+
+// CancelScheduledTransfer 取消计划转账
+func CancelScheduledTransfer(id uint) (*model.ScheduledTransfer, error) {
+	return updateSchedule(id, []model.ScheduleStatus{model.ScheduleActive, model.SchedulePaused}, func(s *model.ScheduledTransfer) error {
+		s.Status = model.ScheduleCancelled
+		s.NextRunAt = nil
+		s.RetryAt = nil
+		return nil
+	})
+}
+
+// ListScheduledTransfers 分页查询计划转账
+func ListScheduledTransfers(filter ScheduleFilter, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.ScheduledTransfer{})
+	if filter.WalletID != 0 {
+		query = query.Where("(from_wallet_id = ? OR to_wallet_id = ?)", filter.WalletID, filter.WalletID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var schedules []model.ScheduledTransfer
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     schedules,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// ListScheduledTransferRuns 分页查询计划转账的执行记录
+func ListScheduledTransferRuns(scheduleID uint, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.ScheduledTransferRun{}).Where("schedule_id = ?", scheduleID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var runs []model.ScheduledTransferRun
+	if err := query.Order("scheduled_for DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&runs).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     runs,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// scheduleDue 计划是否到了执行或重试时间
+func scheduleDue(s *model.ScheduledTransfer, now time.Time) bool {
+	if s.Status != model.ScheduleActive {
+		return false
+	}
+	if s.RetryAt != nil {
+		return !s.RetryAt.After(now)
+	}
+	return s.NextRunAt != nil && !s.NextRunAt.After(now)
+}
+
+// runScheduledTransfer 按计划的模式执行一次转账
+// 代理模式与代理转账入口一样检查 KYC 等级是否允许代理转账, nonce 在创建计划时已经占用
+func runScheduledTransfer(tx *gorm.DB, s *model.ScheduledTransfer) (*model.Transaction, error) {
+	var from, to model.Wallet
+	if err := tx.First(&from, s.FromWalletID).Error; err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+	if err := tx.First(&to, s.ToWalletID).Error; err != nil {
+		return nil, errors.ErrWalletNotFound
+	}
+	if err := CheckTransferAllowed(&from, &to); err != nil {
+		return nil, err
+	}
+	proxy := s.Mode == model.ScheduleModeProxy
+	if proxy {
+		if err := CheckProxyTransferAllowed(&from); err != nil {
+			return nil, err
+		}
+	}
+	return scheduledTransfer(tx, &from, &to, s.Amount, proxy)
+}
+
+// scheduledTransfer 在事务中执行计划转账, 两种模式都按 KYC 等级限额检查, 代理模式经过代理钱包
+// 违规时返回 *RuleViolation, 失败的交易和异常记录随执行记录一起提交
+func scheduledTransfer(tx *gorm.DB, from, to *model.Wallet, amount float64, proxy bool) (*model.Transaction, error) {
+	originalTx, err := createOriginalTransaction(tx, from, to, amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTransaction(tx, from, originalTx); err != nil {
+		if _, violated := err.(*RuleViolation); violated {
+			return originalTx, err
+		}
+		return nil, err
+	}
+
+	if proxy {
+		if err := createAssociatedTransactions(tx, originalTx); err != nil {
+			return nil, err
+		}
+	}
+	if err := updateWalletBalances(tx, originalTx, from, to, amount); err != nil {
+		return nil, err
+	}
+	originalTx.Status = TransactionStatusSuccess
+	if err := tx.Save(originalTx).Error; err != nil {
+		return nil, err
+	}
+	return originalTx, nil
+}
+
+// truncateScheduleError 截断错误信息以适应 varchar(255) 列, 按字符截断避免产生不完整的 UTF-8
+func truncateScheduleError(err error) string {
+	msg := []rune(err.Error())
+	if len(msg) > scheduleErrorMaxLen {
+		msg = msg[:scheduleErrorMaxLen]
+	}
+	return string(msg)
+}
+
+// finishOccurrence 结束当前执行时间, 周期计划前进到下一个执行时间
+func finishOccurrence(s *model.ScheduledTransfer, succeeded bool, now time.Time) error {
+	s.Attempts = 0
+	s.RetryAt = nil
+	next, err := nextOccurrence(s, now)
+	if err != nil {
+		return err
+	}
+	s.NextRunAt = next
+	switch {
+	case next != nil:
+	case succeeded || s.CronExpr != "":
+		s.Status = model.ScheduleCompleted
+	default:
+		s.Status = model.ScheduleFailed
+	}
+	return nil
+}
+
+// executeSchedule 处理一个到期的计划, 返回需要发送的失败通知
+// 转账, 执行记录和计划状态在同一事务中提交; 进程在提交前退出时下次扫描会重新执行, 提交后执行记录保证不会重复转账
+func executeSchedule(id uint, now time.Time) (*ScheduleFailureNotice, error) {
+	var notice *ScheduleFailureNotice
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		var s model.ScheduledTransfer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&s, id).Error; err != nil {
+			return err
+		}
+		// 加锁后重新检查, 计划可能已被其他实例处理, 暂停或取消
+		if !scheduleDue(&s, now) {
+			return nil
+		}
+		occurrence := *s.NextRunAt
+
+		var run model.ScheduledTransferRun
+		err := tx.Where("schedule_id = ? AND scheduled_for = ?", s.ID, occurrence).First(&run).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if run.Status == model.ScheduleRunSucceeded {
+			// 已经执行过, 只需要前进到下一个执行时间
+			if err := finishOccurrence(&s, true, now); err != nil {
+				return err
+			}
+			return tx.Save(&s).Error
+		}
+		run.ScheduleID = s.ID
+		run.ScheduledFor = occurrence
+		run.Attempts++
+		s.Attempts++
+
+		// 转账失败时回滚到保存点, 只保留执行记录和计划状态
+		if err := tx.SavePoint("scheduled_transfer").Error; err != nil {
+			return err
+		}
+		transfer, transferErr := runScheduledTransfer(tx, &s)
+		if _, violated := transferErr.(*RuleViolation); transferErr != nil && !violated {
+			if err := tx.RollbackTo("scheduled_transfer").Error; err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case transferErr == nil:
+			run.Status = model.ScheduleRunSucceeded
+			run.TransactionID = transfer.ID
+			run.Error = ""
+			s.RunCount++
+			s.LastRunAt = &now
+			s.LastError = ""
+			if err := finishOccurrence(&s, true, now); err != nil {
+				return err
+			}
+		case transferErr == errors.ErrInsufficientBalance && s.Attempts <= scheduleMaxRetries():
+			run.Status = model.ScheduleRunRetrying
+			run.Error = truncateScheduleError(transferErr)
+			retryAt := now.Add(scheduleRetryInterval())
+			s.RetryAt = &retryAt
+			s.LastError = run.Error
+		default:
+			run.Status = model.ScheduleRunFailed
+			run.Error = truncateScheduleError(transferErr)
+			if transfer != nil {
+				run.TransactionID = transfer.ID
+			}
+			s.LastRunAt = &now
+			s.LastError = run.Error
+			if transferErr == errors.ErrWalletClosed || transferErr == errors.ErrWalletNotFound {
+				// 钱包已注销, 后续执行都不会成功
+				s.Status = model.ScheduleFailed
+				s.NextRunAt, s.RetryAt, s.Attempts = nil, nil, 0
+			} else if err := finishOccurrence(&s, false, now); err != nil {
+				return err
+			}
+			notice = &ScheduleFailureNotice{
+				ScheduleID:   s.ID,
+				FromWalletID: s.FromWalletID,
+				ToWalletID:   s.ToWalletID,
+				Amount:       s.Amount,
+				ScheduledFor: occurrence,
+				Attempts:     run.Attempts,
+				Error:        run.Error,
+				Status:       string(s.Status),
+			}
+		}
+
+		if err := tx.Save(&run).Error; err != nil {
+			return err
+		}
+		return tx.Save(&s).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notice, nil
+}
+
+func scheduleMaxRetries() int {
+	return config.GlobalConfig.Schedules.MaxRetries
+}
+
+func scheduleRetryInterval() time.Duration {
+	if s := config.GlobalConfig.Schedules.RetryIntervalSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultScheduleRetryInterval
+}
+
+// RunDueScheduledTransfers 执行到期的计划转账, 返回处理的计划数
+func RunDueScheduledTransfers() (int, error) {
+	now := time.Now()
+	batchSize := defaultScheduleBatchSize
+	if n := config.GlobalConfig.Schedules.BatchSize; n > 0 {
+		batchSize = n
+	}
+
+	var ids []uint
+	if err := model.DB.Model(&model.ScheduledTransfer{}).
+		Where("status = ? AND ((retry_at IS NULL AND next_run_at <= ?) OR retry_at <= ?)", model.ScheduleActive, now, now).
+		Order("id").
+		Limit(batchSize).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, id := range ids {
+		notice, err := executeSchedule(id, now)
+		if err != nil {
+			log.Printf("failed to run scheduled transfer %d: %v", id, err)
+			continue
+		}
+		processed++
+		if notice != nil {
+			notifyScheduleFailure(notice)
+		}
+	}
+	return processed, nil
+}
+
+// notifyScheduleFailure 记录计划转账失败, 配置了 schedules.notify_webhook 时同时发送通知
+func notifyScheduleFailure(notice *ScheduleFailureNotice) {
+	log.Printf("scheduled transfer %d failed for %s after %d attempts: %s",
+		notice.ScheduleID, notice.ScheduledFor.Format(time.RFC3339), notice.Attempts, notice.Error)
+
+	cfg := config.GlobalConfig.Schedules
+	if cfg.NotifyWebhook == "" {
+		return
+	}
+	body, err := json.Marshal(notice)
+	if err != nil {
+		log.Printf("failed to encode schedule failure notice: %v", err)
+		return
+	}
+	timeout := defaultNotifyTimeout
+	if cfg.NotifyTimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.NotifyTimeoutSeconds) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(cfg.NotifyWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("failed to send schedule failure notice: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("schedule failure webhook returned %s", resp.Status)
+	}
+}
+
+// StartTransferScheduler 启动计划转账的调度任务
+func StartTransferScheduler() {
+	interval := defaultSchedulePoll
+	if s := config.GlobalConfig.Schedules.PollSeconds; s > 0 {
+		interval = time.Duration(s) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			processed, err := RunDueScheduledTransfers()
+			if err != nil {
+				log.Printf("failed to run scheduled transfers: %v", err)
+			}
+			if processed > 0 {
+				log.Printf("processed %d scheduled transfers", processed)
+			}
+		}
+	}()
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"testing"
+	"time"
+)
+
+func setupScheduleDB(t *testing.T) {
+	t.Helper()
+	setupTierDB(t, &model.ScheduledTransfer{}, &model.ScheduledTransferRun{}, &model.WalletKey{},
+		&model.EncryptedTransaction{}, &model.DesensitizedTransaction{})
+}
+
+// createDueSchedule 创建一个已经到期的一次性计划
+func createDueSchedule(t *testing.T, from, to *model.Wallet, amount float64, mode string) *model.ScheduledTransfer {
+	t.Helper()
+	runAt := time.Now().Add(-time.Minute)
+	s := &model.ScheduledTransfer{
+		FromWalletID: from.ID,
+		ToWalletID:   to.ID,
+		Amount:       amount,
+		Mode:         mode,
+		RunAt:        &runAt,
+		NextRunAt:    &runAt,
+		Status:       model.ScheduleActive,
+	}
+	if err := model.DB.Create(s).Error; err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func runSchedule(t *testing.T, s *model.ScheduledTransfer) *model.ScheduledTransferRun {
+	t.Helper()
+	if _, err := executeSchedule(s.ID, time.Now()); err != nil {
+		t.Fatalf("executeSchedule() error = %v", err)
+	}
+	var run model.ScheduledTransferRun
+	if err := model.DB.Where("schedule_id = ?", s.ID).First(&run).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &run
+}
+
+func assertBalance(t *testing.T, w *model.Wallet, want float64) {
+	t.Helper()
+	var current model.Wallet
+	if err := model.DB.First(&current, w.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.Balance != want {
+		t.Fatalf("wallet %d balance = %v, want %v", w.ID, current.Balance, want)
+	}
+}
+
+// createWalletKey 为钱包保存公钥, 代理转账需要为双方生成加密交易记录
+func createWalletKey(t *testing.T, w *model.Wallet) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Create(&model.WalletKey{WalletID: w.ID, PublicKey: hex.EncodeToString(key.N.Bytes())}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// usePoolWallets 用新建的代理钱包替换全局钱包池, 测试结束后恢复
+func usePoolWallets(t *testing.T, count int) []*model.Wallet {
+	t.Helper()
+	previous := GlobalWalletPool
+	GlobalWalletPool = &WalletPool{}
+	t.Cleanup(func() { GlobalWalletPool = previous })
+
+	wallets := make([]*model.Wallet, 0, count)
+	for i := 0; i < count; i++ {
+		w := &model.Wallet{WalletName: fmt.Sprintf("ProxyWallet%d", i), Username: fmt.Sprintf("proxy-user%d", i), Balance: 1000000}
+		if err := model.DB.Create(w).Error; err != nil {
+			t.Fatal(err)
+		}
+		GlobalWalletPool.AddWallet(w)
+		wallets = append(wallets, w)
+	}
+	return wallets
+}
+
+func createScheduleWallets(t *testing.T, tier int) (*model.Wallet, *model.Wallet) {
+	t.Helper()
+	_, from := createKYCUser(t, model.KYCVerified, tier)
+	to := &model.Wallet{UserID: from.UserID, Username: from.Username}
+	if err := model.DB.Create(to).Error; err != nil {
+		t.Fatal(err)
+	}
+	fundWallet(t, from, 5000)
+	return from, to
+}
+
+func TestScheduledTransferAboveHalfDailyLimit(t *testing.T) {
+	setupScheduleDB(t)
+	config.GlobalConfig.KYC.Tiers = []config.TierPolicy{
+		{Tier: 0, MaxTransactionAmount: 2000, MaxDailyAmount: 2000, HourlyFrequency: 10},
+	}
+	from, to := createScheduleWallets(t, 0)
+
+	// 执行前保存的待处理交易就是本次转账, 不能在日累计金额中再算一次
+	s := createDueSchedule(t, from, to, 1500, model.ScheduleModeNormal)
+	if run := runSchedule(t, s); run.Status != model.ScheduleRunSucceeded {
+		t.Fatalf("run status = %s (%s), want succeeded", run.Status, run.Error)
+	}
+	assertBalance(t, from, 3500)
+
+	s = createDueSchedule(t, from, to, 1000, model.ScheduleModeNormal)
+	if run := runSchedule(t, s); run.Status != model.ScheduleRunFailed {
+		t.Fatalf("run status = %s, want failed over daily limit", run.Status)
+	}
+	assertBalance(t, from, 3500)
+}
+
+func TestScheduledProxyTransfer(t *testing.T) {
+	setupScheduleDB(t)
+	from, to := createScheduleWallets(t, 1)
+	createWalletKey(t, from)
+	createWalletKey(t, to)
+	proxies := usePoolWallets(t, ProxyWalletCount+1)
+
+	// 代理钱包全部冻结时资金不能进入代理流程
+	for _, proxy := range proxies {
+		model.DB.Model(proxy).Update("status", model.WalletFrozen)
+	}
+	s := createDueSchedule(t, from, to, 1200, model.ScheduleModeProxy)
+	run := runSchedule(t, s)
+	if run.Status != model.ScheduleRunFailed || run.Error != errors.ErrWalletFrozen.Error() {
+		t.Fatalf("run = %s (%s), want failed with frozen proxy wallet", run.Status, run.Error)
+	}
+	assertBalance(t, from, 5000)
+
+	for _, proxy := range proxies {
+		model.DB.Model(proxy).Update("status", model.WalletActive)
+	}
+	s = createDueSchedule(t, from, to, 1200, model.ScheduleModeProxy)
+	if run := runSchedule(t, s); run.Status != model.ScheduleRunSucceeded {
+		t.Fatalf("run status = %s (%s), want succeeded", run.Status, run.Error)
+	}
+	assertBalance(t, from, 3800)
+	assertBalance(t, to, 1200)
+
+	var legs int64
+	model.DB.Model(&model.Transaction{}).Where("type = ?", model.ToProxyTransaction).Count(&legs)
+	if legs != ProxyWalletCount {
+		t.Fatalf("proxy legs = %d, want %d", legs, ProxyWalletCount)
+	}
+}
+
+func TestScheduledProxyTransferRequiresProxyTier(t *testing.T) {
+	setupScheduleDB(t)
+	from, to := createScheduleWallets(t, 0)
+
+	s := createDueSchedule(t, from, to, 500, model.ScheduleModeProxy)
+	if run := runSchedule(t, s); run.Status != model.ScheduleRunFailed || run.Error != errors.ErrProxyTransferNotAllowed.Error() {
+		t.Fatalf("run = %s (%s), want failed with proxy transfer not allowed", run.Status, run.Error)
+	}
+	assertBalance(t, from, 5000)
+
+	_, err := CreateScheduledTransfer(&ScheduleInput{
+		FromWalletID: from.ID,
+		ToWalletID:   to.ID,
+		Amount:       500,
+		Mode:         model.ScheduleModeProxy,
+		Cron:         "@daily",
+	}, "", &model.Account{})
+	if err != errors.ErrProxyTransferNotAllowed {
+		t.Fatalf("CreateScheduledTransfer() error = %v, want %v", err, errors.ErrProxyTransferNotAllowed)
+	}
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hufu/errors"
+	"hufu/model"
+	"hufu/tee"
+	"hufu/utils"
+	"time"
+)
+
+const (
+	challengeTTL       = 2 * time.Minute
+	challengeNonceSize = 32
+
+	// ChallengePurposeHistory 查询加密交易记录
+	ChallengePurposeHistory = "history"
+)
+
+// ChallengeSigningMessage 挑战的签名内容, 绑定钱包, 用途和过期时间
+func ChallengeSigningMessage(c *model.WalletChallenge) []byte {
+	return []byte(fmt.Sprintf("hufu-wallet-challenge:v1:%d:%s:%s:%d", c.WalletID, c.Purpose, c.Nonce, c.ExpiresAt.Unix()))
+}
+
+// TransferSigningMessage 普通转账的签名内容, nonce 和有效期用于防重放
+func TransferSigningMessage(from, to uint, amount float64, nonce string, timestamp, expiresAt int64) []byte {
+	return []byte(fmt.Sprintf("hufu-transfer:v1:%d:%d:%s:%s:%d:%d", from, to, FormatEvidenceAmount(amount), nonce, timestamp, expiresAt))
+}
+
+// EnvelopeSigningMessage 代理转账信封的签名内容, 覆盖信封的全部字段
+func EnvelopeSigningMessage(envelope *tee.Envelope) []byte {
+	return []byte(fmt.Sprintf("hufu-envelope:v%d:%s:%d:%s:%s:%s",
+		envelope.Version, envelope.KeyID, envelope.Sender, envelope.EncryptedKey, envelope.Nonce, envelope.Ciphertext))
+}
+
+// VerifyWalletSignature 使用钱包公钥验证签名
+func VerifyWalletSignature(walletID uint, message []byte, signature string) error {
+	walletKey, err := GetWalletKeyByWalletID(walletID)
+	if err != nil {
+		return errors.ErrSignatureInvalid
+	}
+	if err := utils.RSAVerifyPSSWithHexKey(message, signature, walletKey.PublicKey); err != nil {
+		return errors.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// IssueWalletChallenge 为钱包生成一次性挑战, 客户端用钱包私钥签名 ChallengeSigningMessage 后提交
+func IssueWalletChallenge(walletID uint, purpose string) (*model.WalletChallenge, error) {
+	nonce := make([]byte, challengeNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	challenge := &model.WalletChallenge{
+		WalletID:  walletID,
+		Purpose:   purpose,
+		Nonce:     hex.EncodeToString(nonce),
+		ExpiresAt: time.Now().Add(challengeTTL),
+	}
+	if err := model.DB.Create(challenge).Error; err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// RedeemWalletChallenge 验证挑战签名并将挑战标记为已使用, 每个挑战只能使用一次
+func RedeemWalletChallenge(walletID uint, purpose, nonce, signature string) error {
+	var challenge model.WalletChallenge
+	if err := model.DB.Where("nonce = ? AND wallet_id = ? AND purpose = ?", nonce, walletID, purpose).First(&challenge).Error; err != nil {
+		return errors.ErrChallengeInvalid
+	}
+	now := time.Now()
+	if challenge.UsedAt != nil || !challenge.ExpiresAt.After(now) {
+		return errors.ErrChallengeInvalid
+	}
+	if err := VerifyWalletSignature(walletID, ChallengeSigningMessage(&challenge), signature); err != nil {
+		return err
+	}
+
+	// 条件更新保证并发提交同一挑战时只有一个成功
+	result := model.DB.Model(&model.WalletChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrChallengeInvalid
+	}
+	return nil
+}
+
+// CleanupWalletChallenges 删除已过期的挑战
+func CleanupWalletChallenges() (int64, error) {
+	result := model.DB.Where("expires_at < ?", time.Now()).Delete(&model.WalletChallenge{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hufu/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ServerTimestamp 服务端时间戳, 以数据库时钟取时并用 TEE 签名密钥签名
+// 时间和文档签名来自同一方, 不是独立授时机构签发的 RFC 3161 时间戳, 只能证明签名密钥持有方声明摘要在 Time 时已经存在
+type ServerTimestamp struct {
+	Time      string `json:"time"`      // 数据库时间, RFC3339 UTC
+	Digest    string `json:"digest"`    // 内容的 sha256
+	Authority string `json:"authority"` // 签名密钥ID
+	Signature string `json:"signature"` // 对 Time, Digest, Authority 规范化编码的签名
+}
+
+type timestampClaims struct {
+	Time      string `json:"time"`
+	Digest    string `json:"digest"`
+	Authority string `json:"authority"`
+}
+
+// databaseNow 读取 MySQL 服务器的 UTC 时间, 多个应用实例使用同一时钟
+// 查询使用调用方的事务, 与证据在同一连接上取时
+func databaseNow(db *gorm.DB) (time.Time, error) {
+	var now time.Time
+	if err := db.Raw("SELECT UTC_TIMESTAMP(6)").Scan(&now).Error; err != nil {
+		return time.Time{}, fmt.Errorf("failed to read database time: %v", err)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), time.UTC), nil
+}
+
+// IssueServerTimestamp 为摘要签发服务端时间戳
+func IssueServerTimestamp(db *gorm.DB, digest []byte) (*ServerTimestamp, error) {
+	now, err := databaseNow(db)
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := teeSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := timestampClaims{
+		Time:      now.Format(time.RFC3339Nano),
+		Digest:    hex.EncodeToString(digest),
+		Authority: signingKey.ID,
+	}
+	data, err := utils.CanonicalJSON(claims)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := utils.SignData(signingKey.PrivateKey, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServerTimestamp{
+		Time:      claims.Time,
+		Digest:    claims.Digest,
+		Authority: claims.Authority,
+		Signature: signature,
+	}, nil
+}
+
+// VerifyServerTimestamp 验证服务端时间戳的签名, 并检查其摘要与给定内容一致
+func VerifyServerTimestamp(token *ServerTimestamp, digest []byte) error {
+	if token == nil {
+		return fmt.Errorf("missing timestamp")
+	}
+	if token.Digest != hex.EncodeToString(digest) {
+		return fmt.Errorf("timestamp digest mismatch")
+	}
+	if _, err := time.Parse(time.RFC3339Nano, token.Time); err != nil {
+		return fmt.Errorf("invalid timestamp time: %v", err)
+	}
+
+	key, ok := teeVerifyKeys()[token.Authority]
+	if !ok {
+		return fmt.Errorf("unknown timestamp authority %q", token.Authority)
+	}
+
+	data, err := utils.CanonicalJSON(timestampClaims{
+		Time:      token.Time,
+		Digest:    token.Digest,
+		Authority: token.Authority,
+	})
+	if err != nil {
+		return err
+	}
+	valid, err := utils.VerifySignature(key, string(data), token.Signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("invalid timestamp signature")
+	}
+	return nil
+}
@@ -2,10 +2,8 @@ package controller
 
 import (
 	"fmt"
-	"hufu/config"
 	"hufu/errors"
 	"hufu/model"
-	"hufu/utils"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,85 +12,97 @@ import (
 const (
 	TransactionStatusFailed  = "failed"
 	TransactionStatusSuccess = "completed"
+	TransactionStatusPending = "pending"
 )
 
 const ProxyWalletCount = 3
 
 // NormalTransfer 普通转账,不经过代理钱包
 func NormalTransfer(from *model.Wallet, to *model.Wallet, amount float64) (*model.Transaction, error) {
-	tx := model.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	if err := CheckTransferAllowed(from, to); err != nil {
+		return nil, err
+	}
 
+	var originalTx *model.Transaction
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		originalTx, err = normalTransfer(tx, from, to, amount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return originalTx, nil
+}
+
+// normalTransfer 在事务中创建交易记录并更新双方余额, 供需要和其他记录一起提交的转账使用
+func normalTransfer(tx *gorm.DB, from *model.Wallet, to *model.Wallet, amount float64) (*model.Transaction, error) {
 	originalTx, err := createOriginalTransaction(tx, from, to, amount)
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
-	if err := updateWalletBalances(tx, from, to, amount); err != nil {
-		tx.Rollback()
+	if err := updateWalletBalances(tx, originalTx, from, to, amount); err != nil {
 		return nil, err
 	}
 
 	originalTx.Status = TransactionStatusSuccess
 	if err := tx.Save(originalTx).Error; err != nil {
-		tx.Rollback()
 		return nil, err
 	}
-
-	return originalTx, tx.Commit().Error
+	return originalTx, nil
 }
 
 // ProxyTransfer 代理转账, 经过代理钱包
 func ProxyTransfer(from *model.Wallet, to *model.Wallet, amount float64) (*model.Transaction, error) {
-	tx := model.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	if err := CheckTransferAllowed(from, to); err != nil {
+		return nil, err
+	}
+	if err := CheckProxyTransferAllowed(from); err != nil {
+		return nil, err
+	}
 
+	var originalTx *model.Transaction
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		originalTx, err = proxyTransfer(tx, from, to, amount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return originalTx, nil
+}
+
+// proxyTransfer 在事务中执行代理转账
+// 不合规的交易不返回错误: validateTransaction 已把交易标记为失败并创建异常记录, 需要随事务提交
+func proxyTransfer(tx *gorm.DB, from *model.Wallet, to *model.Wallet, amount float64) (*model.Transaction, error) {
 	// 1. 创建并保存原始交易
 	originalTx, err := createOriginalTransaction(tx, from, to, amount)
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
 	// 2. 验证交易合规性
 	if err := validateTransaction(tx, from, originalTx); err != nil {
-		// 如果是不合规的交易，直接提交事务并返回
-		// 因为validateTransaction已经更新了交易状态并创建了异常记录
-		if err := tx.Commit().Error; err != nil {
-			tx.Rollback()
-			return nil, err
-		}
 		return originalTx, nil
 	}
 
 	// 3. 创建关联交易记录
 	if err := createAssociatedTransactions(tx, originalTx); err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
 	// 4. 更新钱包余额
-	if err := updateWalletBalances(tx, from, to, amount); err != nil {
-		tx.Rollback()
+	if err := updateWalletBalances(tx, originalTx, from, to, amount); err != nil {
 		return nil, err
 	}
 
 	// 5. 完成交易
 	if err := finalizeTransaction(tx, originalTx); err != nil {
-		tx.Rollback()
 		return nil, err
 	}
-
-	return originalTx, tx.Commit().Error
+	return originalTx, nil
 }
 
 // GetTransferHistory 获取转账历史
@@ -146,37 +156,26 @@ func createOriginalTransaction(tx *gorm.DB, from *model.Wallet, to *model.Wallet
 		ToWalletID:   to.ID,
 		Amount:       amount,
 		Type:         model.DirectTransaction,
-		Status:       "pending",
+		Status:       TransactionStatusPending,
 	}
 	return originalTx, tx.Create(originalTx).Error
 }
 
-// validateTransaction 验证交易合规性
+// validateTransaction 验证交易合规性, 违规时把交易标记为失败并返回 *RuleViolation
 func validateTransaction(tx *gorm.DB, from *model.Wallet, originalTx *model.Transaction) error {
-	regulator := NewRegulator()
-	if err := regulator.CheckTransaction(originalTx, from); err != nil {
-		// 生成证据和签名
-		evidence := fmt.Sprintf("Transaction ID: %d, From: %d, To: %d, Amount: %f, Time: %s, Error: %v",
-			originalTx.ID, originalTx.FromWalletID, originalTx.ToWalletID,
-			originalTx.Amount, time.Now().Format(time.RFC3339), err)
-
-		// 使用监管者的私钥对证据进行签名
-		signature, err := utils.SignData(config.GlobalConfig.Tee.PrivateKey, evidence)
+	if violation := tierViolation(tx, from, originalTx); violation != nil {
+		// 生成证据和签名, 创建异常交易记录
+		abnormal, err := NewAbnormalTransaction(tx, originalTx, from.ID, violation)
 		if err != nil {
 			return err
 		}
 
-		// 创建异常交易记录
-		abnormal := &model.AbnormalTransaction{
-			WalletID:      from.ID,
-			TransactionID: originalTx.ID,
-			Evidence:      evidence,
-			Signature:     signature,
-		}
-
 		if err := tx.Create(abnormal).Error; err != nil {
 			return err
 		}
+		if err := freezeOnRuleViolations(tx, from.ID); err != nil {
+			return err
+		}
 
 		// 更新原始交易状态为失败
 		originalTx.Status = TransactionStatusFailed
@@ -184,19 +183,69 @@ func validateTransaction(tx *gorm.DB, from *model.Wallet, originalTx *model.Tran
 			return err
 		}
 
-		return errors.ErrTransactionAmountTooLarge
+		return violation
+	}
+	return nil
+}
+
+// tierViolation 按发起方 KYC 等级的监管规则检查交易, 无法确定等级时也视为违规
+func tierViolation(db *gorm.DB, from *model.Wallet, t *model.Transaction) *RuleViolation {
+	regulator, err := RegulatorForWallet(from)
+	if err != nil {
+		return &RuleViolation{Rule: RuleCheckFailed, Message: fmt.Sprintf("获取 KYC 等级失败: %v", err)}
+	}
+	if err := regulator.CheckTransaction(db, t, from); err != nil {
+		if violation, ok := err.(*RuleViolation); ok {
+			return violation
+		}
+		return &RuleViolation{Rule: RuleCheckFailed, Message: err.Error()}
+	}
+	return nil
+}
+
+// CheckTierLimits 在转账前按发起方 KYC 等级的限额检查, 违规时保存失败的交易和异常证据
+// 普通转账和 TEE 代理转账的入口调用, 代理钱包之间的转账不再检查
+func CheckTierLimits(from, to *model.Wallet, amount float64) error {
+	if err := checkTierLimits(model.DB, from, to, amount); err != nil {
+		return tierLimitError(from, to, amount, err)
 	}
 	return nil
 }
 
+// checkTierLimits 在事务中按 KYC 等级限额检查尚未保存的转账, 违规时返回 *RuleViolation, 不写任何记录
+// 调用方回滚事务后用 tierLimitError 保存违规记录
+func checkTierLimits(tx *gorm.DB, from, to *model.Wallet, amount float64) error {
+	if violation := tierViolation(tx, from, &model.Transaction{
+		FromWalletID: from.ID,
+		ToWalletID:   to.ID,
+		Amount:       amount,
+		Type:         model.DirectTransaction,
+	}); violation != nil {
+		return violation
+	}
+	return nil
+}
+
+// tierLimitError 保存 checkTierLimits 返回的违规并转换为 ErrTransactionAmountTooLarge, 其他错误原样返回
+func tierLimitError(from, to *model.Wallet, amount float64, err error) error {
+	violation, ok := err.(*RuleViolation)
+	if !ok {
+		return err
+	}
+	if _, err := RecordRuleViolation(from, to, amount, violation); err != nil {
+		return err
+	}
+	return errors.NewHufuError(errors.ErrTransactionAmountTooLarge.Code, errors.ErrTransactionAmountTooLarge.Message+": "+violation.Message)
+}
+
 // createAssociatedTransactions 创建关联交易记录
 func createAssociatedTransactions(tx *gorm.DB, originalTx *model.Transaction) error {
-	// 创建加密交易记录
-	encryptedTx, err := createEncryptedTransaction(originalTx)
+	// 创建发起方和接收方的加密交易记录
+	encryptedTxs, err := createEncryptedTransactions(originalTx)
 	if err != nil {
 		return err
 	}
-	if err := tx.Create(encryptedTx).Error; err != nil {
+	if err := tx.Create(encryptedTxs).Error; err != nil {
 		return err
 	}
 
@@ -207,7 +256,7 @@ func createAssociatedTransactions(tx *gorm.DB, originalTx *model.Transaction) er
 	}
 
 	// 创建代交易记录
-	proxyTxs, err := createProxyTransactions(originalTx, originalTx.Amount)
+	proxyTxs, err := createProxyTransactions(tx, originalTx, originalTx.Amount)
 	if err != nil {
 		return err
 	}
@@ -220,18 +269,38 @@ func createAssociatedTransactions(tx *gorm.DB, originalTx *model.Transaction) er
 }
 
 // updateWalletBalances 更新钱包余额
-func updateWalletBalances(tx *gorm.DB, from *model.Wallet, to *model.Wallet, amount float64) error {
-	if from.Balance < amount {
+// 在行锁内重新读取双方钱包, 检查状态和可用余额, 只更新余额字段, 不会覆盖并发的冻结或注销
+func updateWalletBalances(tx *gorm.DB, t *model.Transaction, from *model.Wallet, to *model.Wallet, amount float64) error {
+	if from.ID == to.ID {
+		return fmt.Errorf("source and destination wallets must differ")
+	}
+	// 负数金额会反向扣减收款方余额
+	if amount <= 0 {
+		return errors.ErrInvalidAmount
+	}
+	locked, err := lockWallets(tx, from.ID, to.ID)
+	if err != nil {
+		return err
+	}
+	src, dst := locked[from.ID], locked[to.ID]
+	if err := CheckTransferAllowed(src, dst); err != nil {
+		return err
+	}
+	// 担保冻结的余额不能转出
+	if src.AvailableBalance() < amount {
 		return errors.ErrInsufficientBalance
 	}
 
-	from.Balance -= amount
-	to.Balance += amount
-
-	if err := tx.Save(from).Error; err != nil {
+	// Update 会把新值写回 src 和 dst, 先算出更新后的余额
+	fromBalance, toBalance := src.Balance-amount, dst.Balance+amount
+	if err := tx.Model(src).Update("balance", fromBalance).Error; err != nil {
 		return err
 	}
-	return tx.Save(to).Error
+	if err := tx.Model(dst).Update("balance", toBalance).Error; err != nil {
+		return err
+	}
+	from.Balance, to.Balance = fromBalance, toBalance
+	return recordTransferLedger(tx, t, fromBalance, toBalance)
 }
 
 // finalizeTransaction 完成交易
@@ -240,13 +309,23 @@ func finalizeTransaction(tx *gorm.DB, originalTx *model.Transaction) error {
 	return tx.Save(originalTx).Error
 }
 
-// createProxyTransactions 创建代理交易记录
-func createProxyTransactions(originalTx *model.Transaction, amount float64) ([]*model.Transaction, error) {
+// createProxyTransactions 创建代理交易记录, 选中的代理钱包必须都能转出
+func createProxyTransactions(tx *gorm.DB, originalTx *model.Transaction, amount float64) ([]*model.Transaction, error) {
 	// 获取代理钱包
 	proxyWallets, err := GlobalWalletPool.GetRandomWallets(ProxyWalletCount)
 	if err != nil {
 		return nil, err
 	}
+	// 池中的钱包是启动时加载的, 重新读取状态, 与 TEE 代理转账一样拒绝冻结或注销的代理钱包
+	for _, proxyWallet := range proxyWallets {
+		var current model.Wallet
+		if err := tx.First(&current, proxyWallet.ID).Error; err != nil {
+			return nil, errors.ErrWalletNotFound
+		}
+		if err := CheckWalletCanSend(&current); err != nil {
+			return nil, err
+		}
+	}
 
 	// 拆分金额
 	amounts := splitAmount(amount)
@@ -289,35 +368,14 @@ func splitAmount(amount float64) []float64 {
 	return []float64{part, part, amount - 2*part}
 }
 
-func createEncryptedTransaction(t *model.Transaction) (*model.EncryptedTransaction, error) {
-	// 从数据库读取公钥和私钥
-	walletKey, err := GetWalletKeyByWalletID(t.FromWalletID)
-	if err != nil {
-		return nil, err
-	}
-
-	// 加密交易
-	encryptedFromWalletID, err := utils.RSAEncryptWithHexKey(fmt.Sprintf("%d", t.FromWalletID), walletKey.PublicKey)
-	if err != nil {
-		return nil, err
-	}
-
-	encryptedToWalletID, err := utils.RSAEncryptWithHexKey(fmt.Sprintf("%d", t.ToWalletID), walletKey.PublicKey)
-	if err != nil {
-		return nil, err
-	}
-
-	encryptedAmount, err := utils.RSAEncryptWithHexKey(fmt.Sprintf("%f", t.Amount), walletKey.PublicKey)
-	if err != nil {
-		return nil, err
-	}
-
-	return &model.EncryptedTransaction{
-		TransactionID:         t.ID,
-		EncryptedFromWalletID: encryptedFromWalletID,
-		EncryptedToWalletID:   encryptedToWalletID,
-		EncryptedAmount:       encryptedAmount,
-	}, nil
+// createEncryptedTransactions 为交易双方各创建一份加密交易记录
+func createEncryptedTransactions(t *model.Transaction) ([]*model.EncryptedTransaction, error) {
+	return SealTransactionCopies(&TransactionRecord{
+		TransactionID: t.ID,
+		From:          t.FromWalletID,
+		To:            t.ToWalletID,
+		Amount:        t.Amount,
+	})
 }
 
 // TODO: 脱敏金额和时间范围需要根据实际情况进行调整
@@ -330,17 +388,12 @@ func createDesensitizedTransaction(t *model.Transaction) *model.DesensitizedTran
 	}
 }
 
-// GetEncryptedTransaction 获取加密交易信息
-func GetEncryptedTransaction(walletID uint, privateKey string) ([]*model.Transaction, error) {
-	walletKey, err := GetWalletKeyByWalletID(walletID)
-	if err != nil {
+// GetEncryptedTransaction 获取加密交易信息, 调用方需先通过 RedeemWalletChallenge 完成钱包认证
+func GetEncryptedTransaction(walletID uint) ([]*model.Transaction, error) {
+	if _, err := GetWalletKeyByWalletID(walletID); err != nil {
 		return nil, err
 	}
 
-	if walletKey.PrivateKey != privateKey {
-		return nil, errors.ErrPrivateKeyInvalid
-	}
-
 	// 从数据库读取
 	var txs []*model.Transaction
 	if err := model.DB.Where("from_wallet_id = ? OR to_wallet_id = ?", walletID, walletID).Find(&txs).Error; err != nil {
@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hufu/errors"
+	"hufu/model"
+
+	"gorm.io/gorm"
+)
+
+const userUIDPrefix = "u_"
+
+// UserProfile 用户资料
+type UserProfile struct {
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+}
+
+// UserFilter 用户查询条件
+type UserFilter struct {
+	Username  string `json:"username"`
+	KYCStatus string `json:"kyc_status"`
+}
+
+// UserWallets 用户的钱包列表和余额合计
+type UserWallets struct {
+	User         *model.User    `json:"user"`
+	Wallets      []model.Wallet `json:"wallets"`
+	TotalBalance float64        `json:"total_balance"`
+}
+
+func newUserUID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return userUIDPrefix + hex.EncodeToString(b), nil
+}
+
+// CreateUser 创建用户, accountID 不为空时绑定登录账号
+func CreateUser(username string, accountID *uint, profile UserProfile) (*model.User, error) {
+	if username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	return createUser(model.DB, username, accountID, profile)
+}
+
+func createUser(db *gorm.DB, username string, accountID *uint, profile UserProfile) (*model.User, error) {
+	var count int64
+	if err := db.Model(&model.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.ErrUserExists
+	}
+	if accountID != nil {
+		if err := checkLinkableAccount(db, *accountID); err != nil {
+			return nil, err
+		}
+	}
+
+	uid, err := newUserUID()
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		UID:         uid,
+		Username:    username,
+		AccountID:   accountID,
+		DisplayName: profile.DisplayName,
+		Email:       profile.Email,
+		Phone:       profile.Phone,
+		KYCStatus:   model.KYCUnverified,
+	}
+	if err := db.Create(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkLinkableAccount 只有未绑定用户的钱包持有人账号可以绑定
+func checkLinkableAccount(db *gorm.DB, accountID uint) error {
+	var account model.Account
+	if err := db.First(&account, accountID).Error; err != nil {
+		return fmt.Errorf("account %d not found", accountID)
+	}
+	if account.Role != model.RoleWalletOwner {
+		return fmt.Errorf("account %d is not a wallet owner", accountID)
+	}
+	var count int64
+	if err := db.Model(&model.User{}).Where("account_id = ?", accountID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("account %d is already linked to a user", accountID)
+	}
+	return nil
+}
+
+// GetUserByID 根据ID获取用户
+func GetUserByID(id uint) (*model.User, error) {
+	var user model.User
+	if err := model.DB.First(&user, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByUID 根据公开标识获取用户
+func GetUserByUID(uid string) (*model.User, error) {
+	var user model.User
+	if err := model.DB.Where("uid = ?", uid).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByAccountID 获取登录账号绑定的用户
+func GetUserByAccountID(accountID uint) (*model.User, error) {
+	var user model.User
+	if err := model.DB.Where("account_id = ?", accountID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// EnsureUserForAccount 获取账号绑定的用户, 没有时以账号用户名创建
+// 用户名已被未绑定的用户(如迁移创建的用户)占用时返回 ErrUserExists, 需由运营人员绑定, 避免按同名认领他人钱包
+func EnsureUserForAccount(account *model.Account) (*model.User, error) {
+	user, err := GetUserByAccountID(account.ID)
+	if err != errors.ErrUserNotFound {
+		return user, err
+	}
+	accountID := account.ID
+	return CreateUser(account.Username, &accountID, UserProfile{})
+}
+
+// UpdateUserProfile 更新用户资料
+func UpdateUserProfile(id uint, profile UserProfile) (*model.User, error) {
+	user, err := GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.DB.Model(user).Updates(map[string]interface{}{
+		"display_name": profile.DisplayName,
+		"email":        profile.Email,
+		"phone":        profile.Phone,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkUserAccount 为用户绑定登录账号, 用户的钱包随之归属该账号
+func LinkUserAccount(userID, accountID uint) (*model.User, error) {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.AccountID != nil {
+		return nil, fmt.Errorf("user %d is already linked to account %d", userID, *user.AccountID)
+	}
+
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkLinkableAccount(tx, accountID); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("account_id", accountID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Wallet{}).Where("user_id = ?", userID).Update("account_id", accountID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.AccountID = &accountID
+	return user, nil
+}
+
+// CanAccessUser 运营人员可以访问所有用户, 钱包持有人只能访问绑定自己账号的用户
+func CanAccessUser(account *model.Account, userID uint) error {
+	if account.Role == model.RoleOperator {
+		return nil
+	}
+	if account.Role != model.RoleWalletOwner {
+		return errors.ErrForbidden
+	}
+	user, err := GetUserByID(userID)
+	if err != nil || user.AccountID == nil || *user.AccountID != account.ID {
+		return errors.ErrForbidden
+	}
+	return nil
+}
+
+// ListUserWallets 获取用户的所有钱包和余额合计
+func ListUserWallets(userID uint) (*UserWallets, error) {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var wallets []model.Wallet
+	if err := model.DB.Where("user_id = ?", userID).Order("id").Find(&wallets).Error; err != nil {
+		return nil, err
+	}
+	result := &UserWallets{User: user, Wallets: wallets}
+	for _, w := range wallets {
+		result.TotalBalance += w.Balance
+	}
+	return result, nil
+}
+
+// TransferBetweenUserWallets 在同一用户的两个钱包之间转账, 走普通转账流程
+func TransferBetweenUserWallets(from, to *model.Wallet, amount float64) (*model.Transaction, error) {
+	if from.ID == to.ID {
+		return nil, fmt.Errorf("source and destination wallets must differ")
+	}
+	if from.UserID == 0 || from.UserID != to.UserID {
+		return nil, errors.ErrForbidden
+	}
+	if amount <= 0 {
+		return nil, errors.ErrInvalidAmount
+	}
+	// 按转出钱包的 KYC 等级限额检查, 不能先转入同一用户的其他钱包绕过钱包级别的覆盖
+	if err := CheckTierLimits(from, to, amount); err != nil {
+		return nil, err
+	}
+	return NormalTransfer(from, to, amount)
+}
+
+// ListUsers 分页查询用户
+func ListUsers(filter UserFilter, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.User{})
+	if filter.Username != "" {
+		query = query.Where("username LIKE ?", "%"+filter.Username+"%")
+	}
+	if filter.KYCStatus != "" {
+		query = query.Where("kyc_status = ?", filter.KYCStatus)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var users []model.User
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     users,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// createUsersFromWalletUsernames 为旧钱包的用户名创建用户并关联钱包, 代理钱包除外
+// 同名钱包只属于一个登录账号时, 用户绑定该账号
+func createUsersFromWalletUsernames() error {
+	var usernames []string
+	if err := model.DB.Model(&model.Wallet{}).
+		Where("user_id = 0 AND username <> '' AND wallet_name NOT LIKE ?", initPrefix+"%").
+		Distinct().Pluck("username", &usernames).Error; err != nil {
+		return err
+	}
+
+	for _, username := range usernames {
+		err := model.DB.Transaction(func(tx *gorm.DB) error {
+			var user model.User
+			err := tx.Where("username = ?", username).First(&user).Error
+			if err == gorm.ErrRecordNotFound {
+				var accountIDs []uint
+				if err := tx.Model(&model.Wallet{}).
+					Where("username = ? AND account_id <> 0", username).
+					Distinct().Pluck("account_id", &accountIDs).Error; err != nil {
+					return err
+				}
+				var accountID *uint
+				if len(accountIDs) == 1 && checkLinkableAccount(tx, accountIDs[0]) == nil {
+					accountID = &accountIDs[0]
+				}
+				created, err := createUser(tx, username, accountID, UserProfile{})
+				if err != nil {
+					return err
+				}
+				user = *created
+			} else if err != nil {
+				return err
+			}
+
+			return tx.Model(&model.Wallet{}).
+				Where("username = ? AND user_id = 0 AND wallet_name NOT LIKE ?", username, initPrefix+"%").
+				Update("user_id", user.ID).Error
+		})
+		if err != nil {
+			return fmt.Errorf("username %s: %v", username, err)
+		}
+	}
+	return nil
+}
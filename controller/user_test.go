@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"hufu/model"
+	"testing"
+)
+
+func TestTransferBetweenUserWalletsAppliesWalletTier(t *testing.T) {
+	setupTierDB(t)
+	_, from := createKYCUser(t, model.KYCVerified, 2)
+	to := &model.Wallet{UserID: from.UserID, Username: from.Username}
+	if err := model.DB.Create(to).Error; err != nil {
+		t.Fatal(err)
+	}
+	fundWallet(t, from, 5000)
+
+	// 用户等级 2 允许单笔 50000, 钱包覆盖为等级 0 后单笔上限 1000
+	tier := 0
+	if err := model.DB.Model(from).Update("kyc_tier", &tier).Error; err != nil {
+		t.Fatal(err)
+	}
+	from.KYCTier = &tier
+	if _, err := TransferBetweenUserWallets(from, to, 1500); err == nil {
+		t.Fatal("transfer above the wallet tier succeeded")
+	} else {
+		assertTierLimitError(t, err)
+	}
+
+	if _, err := TransferBetweenUserWallets(from, to, 500); err != nil {
+		t.Fatalf("TransferBetweenUserWallets() error = %v", err)
+	}
+}
@@ -3,8 +3,10 @@ package controller
 import (
 	"fmt"
 	"hufu/model"
-	"hufu/utils"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type WalletStats struct {
@@ -12,37 +14,66 @@ type WalletStats struct {
 	TotalTransactions int64 `json:"total_transactions"` // 总交易次数
 }
 
-func NewWallet(walletName, username string, balance float64) (*model.Wallet, error) {
+// NewWallet 创建余额为0的钱包和钱包密钥, 余额只能通过余额操作变更
+// owner 为空时创建系统钱包并使用 username, 否则钱包归属该用户及其登录账号
+// 提供 publicKey 时为非托管钱包, 服务端只保存公钥; 否则由 TEE 生成密钥对, 私钥经 KMS 封装后保存
+func NewWallet(owner *model.User, walletName, username string, publicKey string) (*model.Wallet, error) {
+	if publicKey == "" && owner != nil && CustodyMode() == model.CustodyNonCustodial {
+		return nil, fmt.Errorf("public_key is required in non-custodial mode")
+	}
+	if publicKey != "" {
+		if err := ValidateWalletPublicKey(publicKey); err != nil {
+			return nil, err
+		}
+	}
+
 	w := &model.Wallet{
 		WalletName: walletName,
 		Username:   username,
-		Balance:    balance,
+		Status:     model.WalletActive,
 	}
-
-	// 统计id数量
-	var count int64
-	if err := model.DB.Model(&model.Wallet{}).Count(&count).Error; err != nil {
-		return nil, err
+	if owner != nil {
+		w.UserID = owner.ID
+		w.Username = owner.Username
+		if owner.AccountID != nil {
+			w.AccountID = *owner.AccountID
+		}
 	}
 
-	privateKey, publicKey := utils.GenerateRSAKey(int(count + 1))
-	if privateKey == "" || publicKey == "" {
-		return nil, fmt.Errorf("failed to generate RSA key")
+	walletKey := &model.WalletKey{
+		Custody:   model.CustodyNonCustodial,
+		PublicKey: strings.TrimPrefix(publicKey, "0x"),
 	}
-
-	if err := model.DB.Create(w).Error; err != nil {
-		return nil, err
+	var privateKey string
+	if publicKey == "" {
+		// 统计id数量
+		var count int64
+		if err := model.DB.Model(&model.Wallet{}).Count(&count).Error; err != nil {
+			return nil, err
+		}
+
+		var err error
+		privateKey, walletKey.PublicKey, err = NewTeeController().CreateWalletKeys(int(count + 1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %v", err)
+		}
 	}
 
-	walletKey := &model.WalletKey{
-		WalletID:   w.ID,
-		PublicKey:  publicKey,
-		PrivateKey: privateKey,
-	}
-	if err := model.DB.Create(walletKey).Error; err != nil {
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(w).Error; err != nil {
+			return err
+		}
+		walletKey.WalletID = w.ID
+		if privateKey != "" {
+			if err := SealWalletPrivateKey(walletKey, privateKey); err != nil {
+				return err
+			}
+		}
+		return tx.Create(walletKey).Error
+	})
+	if err != nil {
 		return nil, err
 	}
-
 	return w, nil
 }
 
@@ -70,10 +101,6 @@ func GetWalletByID(ID uint) (*model.Wallet, error) {
 	return &w, nil
 }
 
-func SetWalletBalance(ID uint, balance float64) error {
-	return model.DB.Model(&model.Wallet{}).Where("id = ?", ID).Update("balance", balance).Error
-}
-
 func GetWalletKeyByWalletID(walletID uint) (*model.WalletKey, error) {
 	var wk model.WalletKey
 	if err := model.DB.Where("wallet_id = ?", walletID).First(&wk).Error; err != nil {
@@ -82,23 +109,18 @@ func GetWalletKeyByWalletID(walletID uint) (*model.WalletKey, error) {
 	return &wk, nil
 }
 
-// UpdateWallet 更新钱包信息
-func UpdateWallet(walletID uint, name string, balance float64) error {
-	// 首先检查钱包是否存在
-	wallet, err := GetWalletByID(walletID)
-	if err != nil {
+// UpdateWallet 更新钱包名称, 余额只能通过余额操作变更
+func UpdateWallet(walletID uint, name string) error {
+	if name == "" {
+		return fmt.Errorf("wallet_name is required")
+	}
+	if _, err := GetWalletByID(walletID); err != nil {
 		return fmt.Errorf("wallet not found: %v", err)
 	}
 
-	// 更新钱包信息
-	wallet.WalletName = name
-	wallet.Balance = balance
-
-	// 保存更新
-	if err := model.DB.Save(wallet).Error; err != nil {
+	if err := model.DB.Model(&model.Wallet{}).Where("id = ?", walletID).Update("wallet_name", name).Error; err != nil {
 		return fmt.Errorf("update wallet failed: %v", err)
 	}
-
 	return nil
 }
 
@@ -0,0 +1,440 @@
+package controller
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/model"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultViolationWindow     = 24 * time.Hour
+	defaultFreezeExpiryCheck   = time.Minute
+	walletStatusReasonMaxBytes = 255
+)
+
+// WalletStatusOf 返回钱包当前生效的状态, 已到期的冻结视为正常
+func WalletStatusOf(w *model.Wallet) model.WalletStatus {
+	switch w.Status {
+	case "":
+		return model.WalletActive
+	case model.WalletFrozen:
+		if w.FrozenUntil != nil && !time.Now().Before(*w.FrozenUntil) {
+			return model.WalletActive
+		}
+	}
+	return w.Status
+}
+
+// CheckWalletCanSend 检查钱包能否转出, 冻结, 注销中和已注销的钱包不能转出
+func CheckWalletCanSend(w *model.Wallet) error {
+	switch WalletStatusOf(w) {
+	case model.WalletActive:
+		return nil
+	case model.WalletFrozen:
+		return errors.ErrWalletFrozen
+	}
+	return errors.ErrWalletClosed
+}
+
+// CheckWalletCanReceive 检查钱包能否收款, 冻结的钱包仍可以收款
+func CheckWalletCanReceive(w *model.Wallet) error {
+	switch WalletStatusOf(w) {
+	case model.WalletActive, model.WalletFrozen:
+		return nil
+	}
+	return errors.ErrWalletClosed
+}
+
+// CheckTransferAllowed 检查转账双方的钱包状态
+func CheckTransferAllowed(from, to *model.Wallet) error {
+	if err := CheckWalletCanSend(from); err != nil {
+		return err
+	}
+	return CheckWalletCanReceive(to)
+}
+
+// lockWallets 在事务中按 ID 顺序加行锁读取钱包, 避免并发转账互相死锁
+func lockWallets(tx *gorm.DB, ids ...uint) (map[uint]*model.Wallet, error) {
+	var wallets []*model.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&wallets).Error; err != nil {
+		return nil, err
+	}
+	locked := make(map[uint]*model.Wallet, len(wallets))
+	for _, w := range wallets {
+		locked[w.ID] = w
+	}
+	for _, id := range ids {
+		if locked[id] == nil {
+			return nil, errors.ErrWalletNotFound
+		}
+	}
+	return locked, nil
+}
+
+// setWalletStatus 在事务中更新钱包状态并追加状态变更日志
+func setWalletStatus(tx *gorm.DB, w *model.Wallet, change *model.WalletStatusChange) error {
+	if len(change.Reason) > walletStatusReasonMaxBytes {
+		return fmt.Errorf("reason must not exceed %d bytes", walletStatusReasonMaxBytes)
+	}
+	change.WalletID = w.ID
+	change.FromStatus = w.Status
+	if change.FromStatus == "" {
+		change.FromStatus = model.WalletActive
+	}
+	if err := tx.Model(w).Updates(map[string]interface{}{"status": change.ToStatus, "frozen_until": change.ExpiresAt}).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(change).Error; err != nil {
+		return err
+	}
+	w.Status, w.FrozenUntil = change.ToStatus, change.ExpiresAt
+	return nil
+}
+
+// freezeWallet 在事务中冻结钱包; 已冻结时保留较长的冻结期限, 系统钱包不能冻结
+func freezeWallet(tx *gorm.DB, walletID uint, change *model.WalletStatusChange) (*model.Wallet, error) {
+	locked, err := lockWallets(tx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	w := locked[walletID]
+	if w.UserID == 0 {
+		// 代理钱包等系统钱包不能冻结, 否则代理转账的中间环节会滞留资金
+		return nil, errors.ErrWalletStatusTransition
+	}
+
+	switch WalletStatusOf(w) {
+	case model.WalletActive:
+	case model.WalletFrozen:
+		if w.FrozenUntil == nil {
+			change.ExpiresAt = nil
+		} else if change.ExpiresAt != nil && change.ExpiresAt.Before(*w.FrozenUntil) {
+			change.ExpiresAt = w.FrozenUntil
+		}
+	default:
+		return nil, errors.ErrWalletStatusTransition
+	}
+
+	change.ToStatus = model.WalletFrozen
+	if err := setWalletStatus(tx, w, change); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// FreezeWallet 运营人员冻结钱包, expiresAt 为空时冻结到人工解冻为止
+func FreezeWallet(walletID uint, actor *model.Account, reason string, expiresAt *time.Time) (*model.Wallet, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	var wallet *model.Wallet
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		wallet, err = freezeWallet(tx, walletID, &model.WalletStatusChange{
+			Source:    model.WalletStatusByOperator,
+			ActorID:   actor.ID,
+			Reason:    reason,
+			ExpiresAt: expiresAt,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// UnfreezeWallet 运营人员解除冻结
+func UnfreezeWallet(walletID uint, actor *model.Account, reason string) (*model.Wallet, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	var wallet *model.Wallet
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockWallets(tx, walletID)
+		if err != nil {
+			return err
+		}
+		wallet = locked[walletID]
+		if wallet.Status != model.WalletFrozen {
+			return errors.ErrWalletStatusTransition
+		}
+		return setWalletStatus(tx, wallet, &model.WalletStatusChange{
+			ToStatus: model.WalletActive,
+			Source:   model.WalletStatusByOperator,
+			ActorID:  actor.ID,
+			Reason:   reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// freezeOnRuleViolations 统计窗口内的异常交易达到阈值时冻结钱包, 在记录异常交易的事务中调用
+func freezeOnRuleViolations(tx *gorm.DB, walletID uint) error {
+	cfg := config.GlobalConfig.WalletStatus
+	if cfg.ViolationFreezeThreshold <= 0 {
+		return nil
+	}
+	window := defaultViolationWindow
+	if cfg.ViolationWindowHours > 0 {
+		window = time.Duration(cfg.ViolationWindowHours) * time.Hour
+	}
+
+	var count int64
+	if err := tx.Model(&model.AbnormalTransaction{}).
+		Where("wallet_id = ? AND created_at >= ?", walletID, time.Now().Add(-window)).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count < int64(cfg.ViolationFreezeThreshold) {
+		return nil
+	}
+
+	var expiresAt *time.Time
+	if cfg.ViolationFreezeHours > 0 {
+		t := time.Now().Add(time.Duration(cfg.ViolationFreezeHours) * time.Hour)
+		expiresAt = &t
+	}
+	_, err := freezeWallet(tx, walletID, &model.WalletStatusChange{
+		Source:    model.WalletStatusByRule,
+		Reason:    fmt.Sprintf("%d 小时内异常交易 %d 次", int(window.Hours()), count),
+		ExpiresAt: expiresAt,
+	})
+	if err == errors.ErrWalletStatusTransition {
+		// 注销中或已注销的钱包本来就不能转出
+		return nil
+	}
+	return err
+}
+
+// freezeOnJuryApproval 陪审团批准监管申请后冻结对应钱包, 直到人工解冻
+func freezeOnJuryApproval(app *model.RegulatorApplication) error {
+	if !config.GlobalConfig.WalletStatus.FreezeOnJuryApproval {
+		return nil
+	}
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := freezeWallet(tx, app.WalletID, &model.WalletStatusChange{
+			Source:        model.WalletStatusByJury,
+			ApplicationID: app.ID,
+			Reason:        fmt.Sprintf("监管申请 %d 经陪审团批准 (%d 个节点)", app.ID, app.ApprovedNodes),
+		})
+		if err == errors.ErrWalletStatusTransition {
+			return nil
+		}
+		return err
+	})
+}
+
+// CloseWallet 注销钱包: 先置为注销中, 再把余额转入 sweepTo 指定的钱包后关闭
+// 余额转出失败时钱包保持注销中, 可以重新调用完成注销
+func CloseWallet(walletID, sweepTo uint, actor *model.Account, reason string) (*model.Wallet, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	var wallet *model.Wallet
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockWallets(tx, walletID)
+		if err != nil {
+			return err
+		}
+		wallet = locked[walletID]
+		if wallet.UserID == 0 {
+			// 代理钱包等系统钱包不能注销
+			return errors.ErrWalletStatusTransition
+		}
+		switch WalletStatusOf(wallet) {
+		case model.WalletActive:
+			if err := checkNoOpenEscrow(tx, walletID); err != nil {
+				return err
+			}
+			return setWalletStatus(tx, wallet, &model.WalletStatusChange{
+				ToStatus: model.WalletClosing,
+				Source:   model.WalletStatusByOperator,
+				ActorID:  actor.ID,
+				Reason:   reason,
+			})
+		case model.WalletClosing:
+			return nil
+		case model.WalletFrozen:
+			return errors.ErrWalletFrozen
+		}
+		return errors.ErrWalletStatusTransition
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		ids := []uint{walletID}
+		if sweepTo != 0 {
+			if sweepTo == walletID {
+				return errors.ErrSweepTargetInvalid
+			}
+			ids = append(ids, sweepTo)
+		}
+		locked, err := lockWallets(tx, ids...)
+		if err == errors.ErrWalletNotFound && sweepTo != 0 {
+			// 注销的钱包已在上一步确认存在, 找不到的是目标钱包
+			return errors.ErrSweepTargetInvalid
+		}
+		if err != nil {
+			return err
+		}
+		wallet = locked[walletID]
+		if wallet.Status != model.WalletClosing {
+			return errors.ErrWalletStatusTransition
+		}
+
+		if wallet.Balance > 0 {
+			target := locked[sweepTo]
+			if target == nil || CheckWalletCanReceive(target) != nil {
+				return errors.ErrSweepTargetInvalid
+			}
+			if err := sweepBalance(tx, wallet, target); err != nil {
+				return err
+			}
+		}
+
+		return setWalletStatus(tx, wallet, &model.WalletStatusChange{
+			ToStatus: model.WalletClosed,
+			Source:   model.WalletStatusByOperator,
+			ActorID:  actor.ID,
+			Reason:   reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// sweepBalance 把注销钱包的全部余额转入目标钱包, 记为 sweep 类型的交易
+func sweepBalance(tx *gorm.DB, from, to *model.Wallet) error {
+	amount := from.Balance
+	sweep := &model.Transaction{
+		FromWalletID: from.ID,
+		ToWalletID:   to.ID,
+		Amount:       amount,
+		Type:         model.SweepTransaction,
+		Status:       TransactionStatusSuccess,
+	}
+	if err := tx.Create(sweep).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(from).Update("balance", 0).Error; err != nil {
+		return err
+	}
+	toBalance := to.Balance + amount
+	if err := tx.Model(to).Update("balance", toBalance).Error; err != nil {
+		return err
+	}
+	from.Balance, to.Balance = 0, toBalance
+	return recordTransferLedger(tx, sweep, 0, toBalance)
+}
+
+// ExpireWalletFreezes 解除已到期的冻结并记录日志, 返回解冻的钱包数
+func ExpireWalletFreezes() (int, error) {
+	var ids []uint
+	if err := model.DB.Model(&model.Wallet{}).
+		Where("status = ? AND frozen_until IS NOT NULL AND frozen_until <= ?", model.WalletFrozen, time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		err := model.DB.Transaction(func(tx *gorm.DB) error {
+			locked, err := lockWallets(tx, id)
+			if err != nil {
+				return err
+			}
+			w := locked[id]
+			// 加锁后重新检查, 冻结可能已被延长或解除
+			if w.Status != model.WalletFrozen || WalletStatusOf(w) != model.WalletActive {
+				return nil
+			}
+			if err := setWalletStatus(tx, w, &model.WalletStatusChange{
+				ToStatus: model.WalletActive,
+				Source:   model.WalletStatusByExpiry,
+				Reason:   "冻结到期",
+			}); err != nil {
+				return err
+			}
+			expired++
+			return nil
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// StartWalletFreezeExpiry 启动定时解除到期冻结的任务
+// 转账检查已把到期的冻结视为正常, 定时任务负责更新状态并留下日志
+func StartWalletFreezeExpiry() {
+	interval := defaultFreezeExpiryCheck
+	if s := config.GlobalConfig.WalletStatus.ExpiryCheckSeconds; s > 0 {
+		interval = time.Duration(s) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expired, err := ExpireWalletFreezes()
+			if err != nil {
+				log.Printf("failed to expire wallet freezes: %v", err)
+			}
+			if expired > 0 {
+				log.Printf("unfroze %d wallets whose freeze expired", expired)
+			}
+		}
+	}()
+}
+
+// ListWalletStatusChanges 分页查询钱包状态变更日志
+func ListWalletStatusChanges(walletID uint, page, pageSize int) (*model.PageResult, error) {
+	query := model.DB.Model(&model.WalletStatusChange{})
+	if walletID != 0 {
+		query = query.Where("wallet_id = ?", walletID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var changes []model.WalletStatusChange
+	if err := query.Order("id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.PageResult{
+		List:     changes,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
@@ -0,0 +1,190 @@
+// Package cron 解析五段式 cron 表达式并计算下一次执行时间
+// 字段依次为 分 时 日 月 周, 支持 *, 列表, 范围, 步长, 月份和星期的英文缩写, 以及 @hourly 等简写
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchLimit 查找下一次执行时间的范围, 超过时认为表达式不会再触发 (如 2 月 30 日)
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = field{"minute", 0, 59, nil}
+	hourField   = field{"hour", 0, 23, nil}
+	domField    = field{"day of month", 1, 31, nil}
+	monthField  = field{"month", 1, 12, monthNames}
+	dowField    = field{"day of week", 0, 7, dayNames} // 0 和 7 都表示周日
+)
+
+// Schedule 解析后的 cron 表达式, 每个字段为允许取值的位图
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // 日和周是否为 *, 两者都有限制时满足其一即可
+}
+
+// Parse 解析 cron 表达式
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(parts))
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseField(parts[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(parts[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(parts[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(parts[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(parts[4], dowField); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = parts[2] == "*" || parts[2] == "?"
+	s.dowAny = parts[4] == "*" || parts[4] == "?"
+	return s, nil
+}
+
+// parseField 解析一个字段, 返回允许取值的位图
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(expr, ",") {
+		rangeExpr, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %q", f.name, item)
+			}
+			rangeExpr, step = item[:i], n
+		}
+
+		var lo, hi int
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			lo, hi = f.min, f.max
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in %s field: %q", f.name, item)
+			}
+		default:
+			v, err := parseValue(rangeExpr, f)
+			if err != nil {
+				return 0, err
+			}
+			// a/n 表示从 a 开始到最大值, 每 n 个取一次
+			lo, hi = v, v
+			if strings.Contains(item, "/") {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value in %s field: %q", f.name, s)
+	}
+	return v, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// dayMatches 日和周都有限制时满足其一即可, 与常见 cron 实现一致
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domOK := has(s.dom, t.Day())
+	dowOK := has(s.dow, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// Next 返回 t 之后 (不含 t) 的第一个执行时间, 使用 t 的时区; 找不到时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(searchLimit)
+
+	for t.Before(limit) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -21,6 +21,54 @@ var (
 	ErrPrivateKeyInvalid         = &HufuError{Code: 1006, Message: "私钥无效"}
 	ErrPrivateKeyApply           = &HufuError{Code: 1007, Message: "私钥申请失败"}
 	ErrTransactionAmountTooLarge = &HufuError{Code: 1008, Message: "交易金额过大"}
+	ErrEvidenceTooLarge          = &HufuError{Code: 1009, Message: "证据附件过大"}
+	ErrEvidenceTypeNotAllowed    = &HufuError{Code: 1010, Message: "证据附件类型不允许"}
+	ErrEvidenceIntegrity         = &HufuError{Code: 1011, Message: "证据附件完整性校验失败"}
+	ErrEvidenceInvalid           = &HufuError{Code: 1012, Message: "证据格式错误"}
+	ErrEvidenceSignatureInvalid  = &HufuError{Code: 1013, Message: "证据签名验证失败"}
+	ErrTeeUnavailable            = &HufuError{Code: 1014, Message: "TEE 服务不可用"}
+	ErrTeeAttestationFailed      = &HufuError{Code: 1015, Message: "TEE 远程证明失败"}
+	ErrTeeBadResponse            = &HufuError{Code: 1016, Message: "TEE 响应格式错误"}
+	ErrTeeRequestRejected        = &HufuError{Code: 1017, Message: "TEE 拒绝请求"}
+	ErrTeeDecryptFailed          = &HufuError{Code: 1018, Message: "TEE 解密交易失败"}
+	ErrTransferReplayed          = &HufuError{Code: 1019, Message: "重复的转账请求"}
+	ErrTransferExpired           = &HufuError{Code: 1020, Message: "转账请求已过期"}
+	ErrRecordDecryptFailed       = &HufuError{Code: 1021, Message: "交易记录解密失败"}
+	ErrUnauthorized              = &HufuError{Code: 1022, Message: "未登录或登录已过期"}
+	ErrForbidden                 = &HufuError{Code: 1023, Message: "无权访问"}
+	ErrInvalidCredentials        = &HufuError{Code: 1024, Message: "用户名或密码错误"}
+	ErrAccountExists             = &HufuError{Code: 1025, Message: "账号已存在"}
+	ErrSignatureInvalid          = &HufuError{Code: 1026, Message: "签名验证失败"}
+	ErrChallengeInvalid          = &HufuError{Code: 1027, Message: "认证挑战无效或已过期"}
+	ErrKeyNotCustodial           = &HufuError{Code: 1028, Message: "钱包私钥由客户端保管"}
+	ErrKeyUnsealFailed           = &HufuError{Code: 1029, Message: "钱包私钥解封失败"}
+	ErrBalanceOperationNotFound  = &HufuError{Code: 1030, Message: "余额操作未找到"}
+	ErrBalanceOperationState     = &HufuError{Code: 1031, Message: "余额操作状态不允许此操作"}
+	ErrSelfApproval              = &HufuError{Code: 1032, Message: "不能审批自己发起的操作"}
+	ErrReasonCodeInvalid         = &HufuError{Code: 1033, Message: "原因代码无效"}
+	ErrUserNotFound              = &HufuError{Code: 1034, Message: "用户未找到"}
+	ErrUserExists                = &HufuError{Code: 1035, Message: "用户已存在"}
+	ErrKYCSubmissionNotFound     = &HufuError{Code: 1036, Message: "KYC 申请未找到"}
+	ErrKYCSubmissionState        = &HufuError{Code: 1037, Message: "KYC 申请状态不允许此操作"}
+	ErrKYCTierInvalid            = &HufuError{Code: 1038, Message: "KYC 等级无效"}
+	ErrProxyTransferNotAllowed   = &HufuError{Code: 1039, Message: "当前 KYC 等级不允许代理转账"}
+	ErrWalletFrozen              = &HufuError{Code: 1040, Message: "钱包已冻结"}
+	ErrWalletClosed              = &HufuError{Code: 1041, Message: "钱包已注销或正在注销"}
+	ErrWalletStatusTransition    = &HufuError{Code: 1042, Message: "钱包状态不允许此操作"}
+	ErrSweepTargetInvalid        = &HufuError{Code: 1043, Message: "余额转入钱包无效"}
+	ErrPaymentRequestNotFound    = &HufuError{Code: 1044, Message: "收款请求未找到"}
+	ErrPaymentRequestState       = &HufuError{Code: 1045, Message: "收款请求状态不允许此操作"}
+	ErrPaymentRequestExpired     = &HufuError{Code: 1046, Message: "收款请求已过期"}
+	ErrPaymentMismatch           = &HufuError{Code: 1047, Message: "付款内容与收款请求不一致"}
+	ErrEscrowNotFound            = &HufuError{Code: 1048, Message: "担保未找到"}
+	ErrEscrowState               = &HufuError{Code: 1049, Message: "担保状态不允许此操作"}
+	ErrWalletHasHolds            = &HufuError{Code: 1050, Message: "钱包有未结束的担保"}
+	ErrScheduleNotFound          = &HufuError{Code: 1051, Message: "计划转账未找到"}
+	ErrScheduleState             = &HufuError{Code: 1052, Message: "计划转账状态不允许此操作"}
+	ErrCronInvalid               = &HufuError{Code: 1053, Message: "cron 表达式无效"}
+	ErrTeeTransactionWarning     = &HufuError{Code: 1054, Message: "交易未通过 TEE 风险检查"}
+	ErrInvalidAmount             = &HufuError{Code: 1055, Message: "转账金额必须大于0"}
+	ErrEvidenceNotFound          = &HufuError{Code: 1057, Message: "证据未找到"}
 )
 
 func NewHufuError(code int, message string) *HufuError {
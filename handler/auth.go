@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
+	"hufu/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type credentials struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// respondAccountError 账号已存在返回 409, 其他参数错误返回 400
+func respondAccountError(c *gin.Context, err error) {
+	if err == errors.ErrAccountExists {
+		c.JSON(http.StatusConflict, gin.H{"code": errors.ErrAccountExists.Code, "error": errors.ErrAccountExists.Message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// Register 注册钱包持有人账号
+func Register(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := controller.CreateAccount(req.Username, req.Password, model.RoleWalletOwner)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": account})
+}
+
+// Login 登录并返回令牌
+func Login(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, token, expiresAt, err := controller.Login(req.Username, req.Password)
+	if err != nil {
+		if err == errors.ErrInvalidCredentials {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": errors.ErrInvalidCredentials.Code, "error": errors.ErrInvalidCredentials.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"token":      token,
+			"expires_at": expiresAt.Unix(),
+			"account":    account,
+		},
+	})
+}
+
+// Logout 注销当前账号的所有令牌
+func Logout(c *gin.Context) {
+	if err := controller.Logout(middleware.CurrentAccount(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// GetCurrentAccount 获取当前登录的账号
+func GetCurrentAccount(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": middleware.CurrentAccount(c)})
+}
+
+// CreateAccount 运营人员创建任意角色的账号
+func CreateAccount(c *gin.Context) {
+	var req struct {
+		credentials
+		Role model.AccountRole `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := controller.CreateAccount(req.Username, req.Password, req.Role)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": account})
+}
+
+// respondSignatureError 签名或挑战无效返回 401
+func respondSignatureError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// IssueWalletChallenge 为钱包签发一次性挑战, 客户端使用钱包私钥对 message 做 RSA-PSS 签名
+func IssueWalletChallenge(c *gin.Context) {
+	var req struct {
+		WalletID uint   `json:"wallet_id" binding:"required"`
+		Purpose  string `json:"purpose" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Purpose != controller.ChallengePurposeHistory {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的挑战用途: " + req.Purpose})
+		return
+	}
+
+	if !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
+	challenge, err := controller.IssueWalletChallenge(req.WalletID, req.Purpose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"wallet_id":  challenge.WalletID,
+			"purpose":    challenge.Purpose,
+			"nonce":      challenge.Nonce,
+			"expires_at": challenge.ExpiresAt.Unix(),
+			"message":    string(controller.ChallengeSigningMessage(challenge)),
+		},
+	})
+}
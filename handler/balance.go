@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
+	"hufu/model"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// balanceErrorStatus 余额操作错误对应的 HTTP 状态码
+func balanceErrorStatus(err error) int {
+	switch err {
+	case errors.ErrBalanceOperationNotFound, errors.ErrWalletNotFound:
+		return http.StatusNotFound
+	case errors.ErrBalanceOperationState, errors.ErrWalletFrozen, errors.ErrWalletClosed:
+		return http.StatusConflict
+	case errors.ErrSelfApproval:
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func respondBalanceError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok {
+		c.JSON(balanceErrorStatus(err), gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// requestBalanceOperation 发起指定类型的余额操作
+func requestBalanceOperation(c *gin.Context, opType model.BalanceOperationType) {
+	var req controller.BalanceOperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	op, err := controller.RequestBalanceOperation(opType, &req, middleware.CurrentAccount(c))
+	if err != nil {
+		respondBalanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": op})
+}
+
+// Deposit 入金
+func Deposit(c *gin.Context) {
+	requestBalanceOperation(c, model.BalanceDeposit)
+}
+
+// Withdraw 出金
+func Withdraw(c *gin.Context) {
+	requestBalanceOperation(c, model.BalanceWithdrawal)
+}
+
+// AdjustBalance 调账
+func AdjustBalance(c *gin.Context) {
+	requestBalanceOperation(c, model.BalanceAdjustment)
+}
+
+// ReverseBalanceOperation 冲正一笔已执行的操作
+func ReverseBalanceOperation(c *gin.Context) {
+	requestBalanceOperation(c, model.BalanceReversal)
+}
+
+// ApproveBalanceOperation 审批并执行待处理的余额操作
+func ApproveBalanceOperation(c *gin.Context) {
+	var req struct {
+		OperationID uint `json:"operation_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	op, err := controller.ApproveBalanceOperation(req.OperationID, middleware.CurrentAccount(c))
+	if err != nil {
+		respondBalanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": op})
+}
+
+// RejectBalanceOperation 拒绝待处理的余额操作
+func RejectBalanceOperation(c *gin.Context) {
+	var req struct {
+		OperationID uint   `json:"operation_id" binding:"required"`
+		Reason      string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	op, err := controller.RejectBalanceOperation(req.OperationID, middleware.CurrentAccount(c), req.Reason)
+	if err != nil {
+		respondBalanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": op})
+}
+
+// ListBalanceOperations 分页查询余额操作
+func ListBalanceOperations(c *gin.Context) {
+	var req struct {
+		controller.BalanceOperationFilter
+		Page     int `json:"page"`
+		PageSize int `json:"page_size"`
+	}
+
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListBalanceOperations(req.BalanceOperationFilter, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
+
+// GetBalanceReasonCodes 获取每种余额操作允许的原因代码
+func GetBalanceReasonCodes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": controller.BalanceReasonCodes()})
+}
+
+// GetWalletLedger 分页查询钱包的余额流水
+func GetWalletLedger(c *gin.Context) {
+	var req struct {
+		WalletID uint `json:"wallet_id" binding:"required"`
+		Page     int  `json:"page"`
+		PageSize int  `json:"page_size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListLedgerEntries(req.WalletID, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
@@ -1,44 +1,24 @@
 package handler
 
 import (
-	"encoding/json"
-	"hufu/config"
-	"hufu/utils"
+	"hufu/controller"
+	"hufu/tee"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetEncryptionKeys 获取加密密钥的处理函数
+// GetEncryptionKeys 获取 enclave 当前的交易加密公钥, 客户端按 algorithm 生成信封, 并随密文提交 key_id
 func GetEncryptionKeys(c *gin.Context) {
-	c.JSON(200, gin.H{
-		"public_key": config.GlobalConfig.Tee.PublicKey,
-	})
-}
-
-func EncryptData(c *gin.Context) {
-	type Request struct {
-		FromWalletID uint `json:"from_wallet_id"`
-		ToWalletID   uint `json:"to_wallet_id"`
-		Amount       int  `json:"amount"`
-	}
-
-	var request Request
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
-		return
-	}
-
-	data, err := json.Marshal(request)
+	key, err := controller.NewTeeController().EncryptionKey(c.Request.Context())
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondTeeError(c, err)
 		return
 	}
 
-	encryptedData, err := utils.RSAEncryptWithHexKey(string(data), config.GlobalConfig.Tee.PublicKey)
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(200, gin.H{"data": encryptedData})
+	c.JSON(200, gin.H{
+		"key_id":     key.KeyID,
+		"algorithm":  tee.EnvelopeAlgorithm,
+		"public_key": key.N,
+		"e":          key.E,
+	})
 }
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
+	"hufu/model"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kycErrorStatus KYC 相关错误对应的 HTTP 状态码
+func kycErrorStatus(err error) int {
+	switch err {
+	case errors.ErrKYCSubmissionNotFound, errors.ErrUserNotFound, errors.ErrWalletNotFound:
+		return http.StatusNotFound
+	case errors.ErrKYCSubmissionState:
+		return http.StatusConflict
+	case errors.ErrSelfApproval, errors.ErrForbidden:
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func respondKYCError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok {
+		c.JSON(kycErrorStatus(err), gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// SubmitKYC 提交核验申请, multipart 表单: user_id, requested_tier, 多个 documents 文件及对应顺序的 doc_type
+func SubmitKYC(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.PostForm("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的user_id格式"})
+		return
+	}
+	requestedTier, err := strconv.Atoi(c.PostForm("requested_tier"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的requested_tier格式"})
+		return
+	}
+	if !middleware.AuthorizeUser(c, uint(userID)) {
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "获取documents文件失败"})
+		return
+	}
+	files := form.File["documents"]
+	docTypes := form.Value["doc_type"]
+	if len(files) == 0 || len(files) != len(docTypes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "documents 和 doc_type 数量必须一致且不为空"})
+		return
+	}
+
+	documents := make([]controller.KYCDocumentUpload, 0, len(files))
+	for i, file := range files {
+		if file.Size > controller.KYCDocumentMaxSize() {
+			c.JSON(http.StatusBadRequest, gin.H{"code": errors.ErrEvidenceTooLarge.Code, "error": errors.ErrEvidenceTooLarge.Message})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+			return
+		}
+		content, err := io.ReadAll(io.LimitReader(f, controller.KYCDocumentMaxSize()+1))
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件内容失败"})
+			return
+		}
+		documents = append(documents, controller.KYCDocumentUpload{
+			DocType:  docTypes[i],
+			FileName: filepath.Base(file.Filename),
+			Content:  content,
+		})
+	}
+
+	submission, err := controller.SubmitKYC(uint(userID), requestedTier, documents, middleware.CurrentAccount(c))
+	if err != nil {
+		respondKYCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": submission})
+}
+
+// GetKYCSubmission 获取核验申请及其文档列表
+func GetKYCSubmission(c *gin.Context) {
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	submission, err := controller.GetKYCSubmission(req.ID)
+	if err != nil {
+		respondKYCError(c, err)
+		return
+	}
+	if !middleware.AuthorizeUser(c, submission.UserID) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": submission})
+}
+
+// GetWalletKYCProfile 获取钱包适用的 KYC 等级和监管策略
+func GetWalletKYCProfile(c *gin.Context) {
+	var req struct {
+		WalletID uint `json:"wallet_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account := middleware.CurrentAccount(c)
+	if account.Role != model.RoleRegulator && !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
+	profile, err := controller.GetWalletKYCProfile(req.WalletID)
+	if err != nil {
+		respondKYCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": profile})
+}
+
+// GetTierPolicies 获取各 KYC 等级的监管策略
+func GetTierPolicies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": controller.TierPolicies()})
+}
+
+// ListKYCSubmissions 分页查询核验申请
+func ListKYCSubmissions(c *gin.Context) {
+	var req struct {
+		controller.KYCSubmissionFilter
+		Page     int `json:"page"`
+		PageSize int `json:"page_size"`
+	}
+
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListKYCSubmissions(req.KYCSubmissionFilter, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
+
+// ApproveKYC 审核通过核验申请, 可用 granted_tier 授予低于申请的等级
+func ApproveKYC(c *gin.Context) {
+	var req struct {
+		ID          uint   `json:"id" binding:"required"`
+		GrantedTier *int   `json:"granted_tier"`
+		Note        string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	submission, err := controller.ApproveKYC(req.ID, middleware.CurrentAccount(c), req.GrantedTier, req.Note)
+	if err != nil {
+		respondKYCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": submission})
+}
+
+// RejectKYC 审核拒绝核验申请
+func RejectKYC(c *gin.Context) {
+	var req struct {
+		ID   uint   `json:"id" binding:"required"`
+		Note string `json:"note" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	submission, err := controller.RejectKYC(req.ID, middleware.CurrentAccount(c), req.Note)
+	if err != nil {
+		respondKYCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": submission})
+}
+
+// SetUserKYCTier 运营人员直接调整用户的 KYC 等级
+func SetUserKYCTier(c *gin.Context) {
+	var req struct {
+		UserID uint   `json:"user_id" binding:"required"`
+		Tier   *int   `json:"tier" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := controller.SetUserKYCTier(req.UserID, *req.Tier, middleware.CurrentAccount(c), req.Reason)
+	if err != nil {
+		respondKYCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// SetWalletKYCTier 设置或清除钱包级别的 KYC 等级覆盖, 不提交 tier 时清除
+func SetWalletKYCTier(c *gin.Context) {
+	var req struct {
+		WalletID uint   `json:"wallet_id" binding:"required"`
+		Tier     *int   `json:"tier"`
+		Reason   string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wallet, err := controller.SetWalletKYCTier(req.WalletID, req.Tier, middleware.CurrentAccount(c), req.Reason)
+	if err != nil {
+		respondKYCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
+}
+
+// ListKYCTierChanges 分页查询 KYC 等级变更审计日志
+func ListKYCTierChanges(c *gin.Context) {
+	var req struct {
+		UserID   uint `json:"user_id"`
+		WalletID uint `json:"wallet_id"`
+		Page     int  `json:"page"`
+		PageSize int  `json:"page_size"`
+	}
+
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListKYCTierChanges(req.UserID, req.WalletID, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
+
+// GetKYCDocument 获取核验文档内容
+func GetKYCDocument(c *gin.Context) {
+	var req struct {
+		Hash string `json:"hash" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, blob, err := controller.ReadBlob(req.Hash)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, blob.ContentType, content)
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
+	"hufu/model"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// paymentErrorStatus 收款请求和担保错误对应的 HTTP 状态码, 超过 KYC 等级限额返回 403
+func paymentErrorStatus(err error) int {
+	if hufuErr, ok := err.(*errors.HufuError); ok && hufuErr.Code == errors.ErrTransactionAmountTooLarge.Code {
+		return http.StatusForbidden
+	}
+	switch err {
+	case errors.ErrPaymentRequestNotFound, errors.ErrEscrowNotFound, errors.ErrWalletNotFound:
+		return http.StatusNotFound
+	case errors.ErrPaymentRequestState, errors.ErrPaymentRequestExpired, errors.ErrEscrowState,
+		errors.ErrWalletFrozen, errors.ErrWalletClosed:
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func respondPaymentError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok {
+		c.JSON(paymentErrorStatus(err), gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// authorizeEitherWallet 当前账号能操作其中任一钱包时返回 true, 否则写入 403
+func authorizeEitherWallet(c *gin.Context, walletIDs ...uint) bool {
+	account := middleware.CurrentAccount(c)
+	for _, id := range walletIDs {
+		if id != 0 && controller.CanAccessWallet(account, id) == nil {
+			return true
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{"code": errors.ErrForbidden.Code, "error": errors.ErrForbidden.Message})
+	return false
+}
+
+// bindPaymentList 绑定分页查询参数, 钱包持有人必须指定自己的钱包
+func bindPaymentList(c *gin.Context) (*controller.PaymentFilter, int, int, bool) {
+	var req struct {
+		controller.PaymentFilter
+		Page     int `json:"page"`
+		PageSize int `json:"page_size"`
+	}
+
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, 0, 0, false
+	}
+
+	if middleware.CurrentAccount(c).Role == model.RoleWalletOwner {
+		if req.WalletID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_id is required"})
+			return nil, 0, 0, false
+		}
+		if !middleware.AuthorizeWallet(c, req.WalletID) {
+			return nil, 0, 0, false
+		}
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+	return &req.PaymentFilter, req.Page, req.PageSize, true
+}
+
+// CreatePaymentRequest 收款方创建收款请求, 返回的 ref 交给付款方
+func CreatePaymentRequest(c *gin.Context) {
+	var req controller.PaymentRequestInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.AuthorizeWallet(c, req.PayeeWalletID) {
+		return
+	}
+
+	request, err := controller.CreatePaymentRequest(&req, middleware.CurrentAccount(c))
+	if err != nil {
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// GetPaymentRequest 凭 ref 查看收款请求
+func GetPaymentRequest(c *gin.Context) {
+	var req struct {
+		Ref string `json:"ref" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := controller.GetPaymentRequest(req.Ref)
+	if err != nil {
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// PayPaymentRequest 付款方支付收款请求, 请求体为普通转账的签名请求加上 ref
+func PayPaymentRequest(c *gin.Context) {
+	var req struct {
+		SignedTransfer
+		Ref string `json:"ref" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, ok := verifySignedTransfer(c, &req.SignedTransfer)
+	if !ok {
+		return
+	}
+
+	request, err := controller.PayPaymentRequest(req.Ref, from, to, req.Amount)
+	if err != nil {
+		if err == errors.ErrInsufficientBalance {
+			respondTransferError(c, err)
+			return
+		}
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// CancelPaymentRequest 收款方取消未付款的收款请求
+func CancelPaymentRequest(c *gin.Context) {
+	var req struct {
+		Ref string `json:"ref" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := controller.GetPaymentRequest(req.Ref)
+	if err != nil {
+		respondPaymentError(c, err)
+		return
+	}
+	if !middleware.AuthorizeWallet(c, request.PayeeWalletID) {
+		return
+	}
+
+	request, err = controller.CancelPaymentRequest(req.Ref)
+	if err != nil {
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// ListPaymentRequests 分页查询钱包作为付款方或收款方的收款请求
+func ListPaymentRequests(c *gin.Context) {
+	filter, page, pageSize, ok := bindPaymentList(c)
+	if !ok {
+		return
+	}
+
+	result, err := controller.ListPaymentRequests(*filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
+
+// CreateEscrowHold 付款方创建担保, 请求体为普通转账的签名请求, hold_expires_at 为担保期限
+func CreateEscrowHold(c *gin.Context) {
+	var req struct {
+		SignedTransfer
+		Memo          string     `json:"memo"`
+		HoldExpiresAt *time.Time `json:"hold_expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, ok := verifySignedTransfer(c, &req.SignedTransfer)
+	if !ok {
+		return
+	}
+
+	hold, err := controller.CreateEscrowHold(from, to, req.Amount, req.Memo, req.HoldExpiresAt, middleware.CurrentAccount(c))
+	if err != nil {
+		if err == errors.ErrInsufficientBalance {
+			respondTransferError(c, err)
+			return
+		}
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": hold})
+}
+
+// bindEscrowHold 按 id 获取担保, 失败时已写入响应
+func bindEscrowHold(c *gin.Context) (*model.EscrowHold, bool) {
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	hold, err := controller.GetEscrowHold(req.ID)
+	if err != nil {
+		respondPaymentError(c, err)
+		return nil, false
+	}
+	return hold, true
+}
+
+// GetEscrowHold 获取担保, 付款方和收款方都可以查看
+func GetEscrowHold(c *gin.Context) {
+	hold, ok := bindEscrowHold(c)
+	if !ok {
+		return
+	}
+	if !authorizeEitherWallet(c, hold.PayerWalletID, hold.PayeeWalletID) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": hold})
+}
+
+// ReleaseEscrowHold 付款方把担保资金释放给收款方
+func ReleaseEscrowHold(c *gin.Context) {
+	hold, ok := bindEscrowHold(c)
+	if !ok {
+		return
+	}
+	if !middleware.AuthorizeWallet(c, hold.PayerWalletID) {
+		return
+	}
+
+	hold, err := controller.ReleaseEscrowHold(hold.ID, middleware.CurrentAccount(c))
+	if err != nil {
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": hold})
+}
+
+// RefundEscrowHold 收款方把担保资金退回付款方
+func RefundEscrowHold(c *gin.Context) {
+	hold, ok := bindEscrowHold(c)
+	if !ok {
+		return
+	}
+	if !middleware.AuthorizeWallet(c, hold.PayeeWalletID) {
+		return
+	}
+
+	hold, err := controller.RefundEscrowHold(hold.ID, middleware.CurrentAccount(c))
+	if err != nil {
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": hold})
+}
+
+// ListEscrowHolds 分页查询钱包作为付款方或收款方的担保
+func ListEscrowHolds(c *gin.Context) {
+	filter, page, pageSize, ok := bindPaymentList(c)
+	if !ok {
+		return
+	}
+
+	result, err := controller.ListEscrowHolds(*filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
@@ -1,20 +1,16 @@
 package handler
 
 import (
-	"fmt"
 	"hufu/controller"
+	"hufu/errors"
 	"hufu/supervisor"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
-	"time"
 
 	"io"
+	"log"
 	"path/filepath"
-	"strings"
 
-	"github.com/SSSaaS/sssa-golang"
 	"github.com/gin-gonic/gin"
 )
 
@@ -54,6 +50,12 @@ func GetPrivateKey(c *gin.Context) {
 		})
 		return
 	}
+	if file.Size > controller.BlobMaxSize() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": errors.ErrEvidenceTooLarge.Message,
+		})
+		return
+	}
 
 	// 读取文件内容
 	f, err := file.Open()
@@ -65,7 +67,7 @@ func GetPrivateKey(c *gin.Context) {
 	}
 	defer f.Close()
 
-	evidence, err := io.ReadAll(f)
+	evidence, err := io.ReadAll(io.LimitReader(f, controller.BlobMaxSize()+1))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "读取文件内容失败",
@@ -73,49 +75,38 @@ func GetPrivateKey(c *gin.Context) {
 		return
 	}
 
-	// 解析文件内容，提取异常证据
-	evidenceStr := string(evidence)
-	var actualEvidence string
-
-	fileName := fmt.Sprintf("wallet-%d-%s-failed", wID, time.Now().Format("20060102150405"))
-	filePath := fmt.Sprintf("./evidence/%s.txt", fileName)
-	err = os.WriteFile(filePath, evidence, 0644)
+	// 保存证据附件并创建申请记录
+	app, err := controller.CreateApplication(uint(wID), c.PostForm("requester"), filepath.Base(file.Filename), evidence)
 	if err != nil {
+		if hufuErr, ok := err.(*errors.HufuError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": hufuErr.Message,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "保存证据文件失败",
 		})
 		return
 	}
 
-	// 按行分割文本
-	lines := strings.Split(evidenceStr, "\n")
-	for i := 0; i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
-		if strings.HasPrefix(line, "异常证据:") || strings.HasPrefix(line, "异常证据：") {
-			actualEvidence = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, "异常证据:"), "异常证据："))
-			break
-		}
+	// 解析并校验证据文档, 签名验证通过后才交给陪审团
+	doc, err := controller.ParseEvidenceDocument(evidence, uint(wID), c.PostForm("requester"), c.PostForm("legal_basis"))
+	if err == nil {
+		err = controller.ValidateEvidenceDocument(doc, uint(wID))
 	}
-
-	if actualEvidence == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "文件格式错误：未找到异常证据",
-		})
-		return
-	}
-
-	log.Println("actualEvidence", actualEvidence)
-
-	// 调用处理函数，使用解析出的异常证据
-	res, err := controller.ProcessPrivateKey(uint(wID), actualEvidence)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "处理私钥失败: " + err.Error(),
+		if failErr := controller.FailApplication(app, err.Error()); failErr != nil {
+			log.Printf("failed to mark application %d as failed: %v", app.ID, failErr)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	pk, err := sssa.Combine(res)
+	// 调用处理函数，使用校验后的证据文档
+	pk, res, err := controller.ProcessApplication(app, doc)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "处理私钥失败: " + err.Error(),
@@ -123,14 +114,11 @@ func GetPrivateKey(c *gin.Context) {
 		return
 	}
 
-	// 重命名文件
-	fileName = fmt.Sprintf("wallet-%d-%s-success", wID, time.Now().Format("20060102150405"))
-	os.Rename(filePath, fmt.Sprintf("./evidence/%s.txt", fileName))
-
 	c.JSON(http.StatusOK, gin.H{
-		"message": "success",
-		"data":    pk,
-		"shares":  res,
+		"message":        "success",
+		"data":           pk,
+		"shares":         res,
+		"application_id": app.ID,
 	})
 }
 
@@ -154,6 +142,30 @@ func GetAbnormalTransaction(c *gin.Context) {
 	})
 }
 
+// VerifyAbnormalTransaction 验证异常交易证据的 TEE 签名
+func VerifyAbnormalTransaction(c *gin.Context) {
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := controller.VerifyAbnormalTransaction(req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    result,
+	})
+}
+
 // 获取决策
 func GetDecision(c *gin.Context) {
 	decision, err := supervisor.GetDecision()
@@ -169,6 +181,34 @@ func GetDecision(c *gin.Context) {
 	})
 }
 
+// VerifyEvidence 校验链下证据与链上承诺是否一致
+func VerifyEvidence(c *gin.Context) {
+	var req struct {
+		Ref     string `json:"ref" binding:"required"`
+		Content string `json:"content"` // 可选, 校验调用方持有的证据原文
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := controller.VerifyEvidence(req.Ref, req.Content)
+	if err == errors.ErrEvidenceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"code": errors.ErrEvidenceNotFound.Code, "error": errors.ErrEvidenceNotFound.Message})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    result,
+	})
+}
+
 // 获取事件
 func GetEvent(c *gin.Context) {
 	event, err := supervisor.GetEvent()
@@ -181,45 +221,56 @@ func GetEvent(c *gin.Context) {
 	c.JSON(http.StatusOK, event)
 }
 
-// GetApplication 获取申请记录
+// GetApplication 分页获取申请记录
 func GetApplication(c *gin.Context) {
-	// 查找匹配的文件
-	files, err := filepath.Glob("./evidence/wallet-*")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "查找文件失败"})
-		return
+	var req struct {
+		controller.ApplicationFilter
+		Page     int `json:"page"`
+		PageSize int `json:"page_size"`
 	}
 
-	applications := make([]map[string]interface{}, 0)
-	for _, file := range files {
-		// 读取文件内容
-		content, err := os.ReadFile(file)
-		if err != nil {
-			continue
-		}
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		// 从文件名解析信息
-		fileName := filepath.Base(file)
-		// 移除.txt后缀
-		fileName = strings.TrimSuffix(fileName, ".txt")
-		parts := strings.Split(fileName, "-")
-		if len(parts) < 4 {
-			continue
-		}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
 
-		// 构建返回数据
-		application := map[string]interface{}{
-			"wallet_id": parts[1],                             // 钱包ID (12)
-			"timestamp": parts[2],                             // 时间戳 (20241107124506)
-			"status":    strings.TrimSuffix(parts[3], ".txt"), // 状态 (success/failed)
-			"content":   string(content),
-		}
-		applications = append(applications, application)
+	result, err := controller.ListApplications(req.ApplicationFilter, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取申请记录失败: " + err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 0,
 		"msg":  "success",
-		"data": applications,
+		"data": result,
 	})
 }
+
+// GetApplicationAttachment 获取申请附件内容
+func GetApplicationAttachment(c *gin.Context) {
+	var req struct {
+		Hash string `json:"hash" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, blob, err := controller.ReadBlob(req.Hash)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, blob.ContentType, content)
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
+	"hufu/model"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scheduleErrorStatus 计划转账错误对应的 HTTP 状态码
+func scheduleErrorStatus(err error) int {
+	switch err {
+	case errors.ErrScheduleNotFound, errors.ErrWalletNotFound:
+		return http.StatusNotFound
+	case errors.ErrScheduleState, errors.ErrWalletFrozen, errors.ErrWalletClosed:
+		return http.StatusConflict
+	case errors.ErrProxyTransferNotAllowed:
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func respondScheduleError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok {
+		c.JSON(scheduleErrorStatus(err), gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// CreateScheduledTransfer 创建计划转账, 发起钱包对 ScheduleSigningMessage 签名, nonce 与普通转账共用防重放记录
+func CreateScheduledTransfer(c *gin.Context) {
+	var req struct {
+		controller.ScheduleInput
+		Nonce     string `json:"nonce" binding:"required"`
+		Timestamp int64  `json:"timestamp" binding:"required"`
+		ExpiresAt int64  `json:"expires_at" binding:"required"`
+		Signature string `json:"signature" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.AuthorizeWallet(c, req.FromWalletID) {
+		return
+	}
+	message := controller.ScheduleSigningMessage(&req.ScheduleInput, req.Nonce, req.Timestamp, req.ExpiresAt)
+	if err := controller.VerifyWalletSignature(req.FromWalletID, message, req.Signature); err != nil {
+		respondSignatureError(c, err)
+		return
+	}
+	if err := controller.ClaimTransferNonce(uint64(req.FromWalletID), req.Nonce, req.Timestamp, req.ExpiresAt); err != nil {
+		respondReplayError(c, err)
+		return
+	}
+
+	schedule, err := controller.CreateScheduledTransfer(&req.ScheduleInput, req.Signature, middleware.CurrentAccount(c))
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+// bindScheduledTransfer 按 id 获取计划转账并校验当前账号能操作发起钱包, 失败时已写入响应
+func bindScheduledTransfer(c *gin.Context) (*model.ScheduledTransfer, bool) {
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	schedule, err := controller.GetScheduledTransfer(req.ID)
+	if err != nil {
+		respondScheduleError(c, err)
+		return nil, false
+	}
+	if !middleware.AuthorizeWallet(c, schedule.FromWalletID) {
+		return nil, false
+	}
+	return schedule, true
+}
+
+// GetScheduledTransfer 获取计划转账
+func GetScheduledTransfer(c *gin.Context) {
+	schedule, ok := bindScheduledTransfer(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+// PauseScheduledTransfer 暂停计划转账
+func PauseScheduledTransfer(c *gin.Context) {
+	schedule, ok := bindScheduledTransfer(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := controller.PauseScheduledTransfer(schedule.ID)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+// ResumeScheduledTransfer 恢复已暂停的计划转账
+func ResumeScheduledTransfer(c *gin.Context) {
+	schedule, ok := bindScheduledTransfer(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := controller.ResumeScheduledTransfer(schedule.ID)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+// CancelScheduledTransfer 取消计划转账
+func CancelScheduledTransfer(c *gin.Context) {
+	schedule, ok := bindScheduledTransfer(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := controller.CancelScheduledTransfer(schedule.ID)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": schedule})
+}
+
+// ListScheduledTransfers 分页查询钱包作为转出方或转入方的计划转账
+func ListScheduledTransfers(c *gin.Context) {
+	var req struct {
+		controller.ScheduleFilter
+		Page     int `json:"page"`
+		PageSize int `json:"page_size"`
+	}
+
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if middleware.CurrentAccount(c).Role == model.RoleWalletOwner {
+		if req.WalletID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_id is required"})
+			return
+		}
+		if !middleware.AuthorizeWallet(c, req.WalletID) {
+			return
+		}
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListScheduledTransfers(req.ScheduleFilter, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
+
+// ListScheduledTransferRuns 分页查询计划转账的执行记录
+func ListScheduledTransferRuns(c *gin.Context) {
+	var req struct {
+		ID       uint `json:"id" binding:"required"`
+		Page     int  `json:"page"`
+		PageSize int  `json:"page_size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := controller.GetScheduledTransfer(req.ID)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	if !middleware.AuthorizeWallet(c, schedule.FromWalletID) {
+		return
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListScheduledTransferRuns(schedule.ID, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
@@ -2,10 +2,12 @@ package handler
 
 import (
 	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
 	"hufu/model"
+	"hufu/tee"
 	"hufu/utils"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,6 +22,40 @@ func NewTeeHandler() *TeeHandler {
 	}
 }
 
+// teeErrorStatus TEE 错误对应的 HTTP 状态码, 服务不可用或证明失败返回 503, 未通过风险检查返回 422
+func teeErrorStatus(err error) int {
+	hufuErr, ok := err.(*errors.HufuError)
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	switch hufuErr.Code {
+	case errors.ErrTeeUnavailable.Code, errors.ErrTeeAttestationFailed.Code:
+		return http.StatusServiceUnavailable
+	case errors.ErrTeeBadResponse.Code:
+		return http.StatusBadGateway
+	case errors.ErrTeeRequestRejected.Code, errors.ErrTeeDecryptFailed.Code:
+		return http.StatusBadRequest
+	case errors.ErrTeeTransactionWarning.Code:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondTeeError 返回 TEE 调用失败的响应
+func respondTeeError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok {
+		c.JSON(teeErrorStatus(err), gin.H{
+			"code":  hufuErr.Code,
+			"error": hufuErr.Message,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": err.Error(),
+	})
+}
+
 func (h *TeeHandler) TeeAdd(c *gin.Context) {
 	var requestBody struct {
 		Add string `json:"add"`
@@ -32,15 +68,13 @@ func (h *TeeHandler) TeeAdd(c *gin.Context) {
 		return
 	}
 
-	respBody, statusCode, err := h.TeeController.Add(requestBody.Add)
+	result, err := h.TeeController.Add(c.Request.Context(), requestBody.Add)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "请求失败: " + err.Error(),
-		})
+		respondTeeError(c, err)
 		return
 	}
 
-	c.String(statusCode, string(respBody))
+	c.String(http.StatusOK, result)
 }
 
 func (h *TeeHandler) TeeGenerateKey(c *gin.Context) {
@@ -62,21 +96,19 @@ func (h *TeeHandler) TeeGenerateKey(c *gin.Context) {
 		return
 	}
 
-	respBody, statusCode, err := h.TeeController.GenerateKey(request.WalletID)
+	resp, err := h.TeeController.GenerateKey(c.Request.Context(), request.WalletID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "请求失败: " + err.Error(),
-		})
+		respondTeeError(c, err)
 		return
 	}
 
-	c.String(statusCode, string(respBody))
+	c.JSON(http.StatusOK, resp)
 }
 
 func (h *TeeHandler) TeeShuffle(c *gin.Context) {
 	var request struct {
-		From   int     `json:"from"`
-		To     int     `json:"to"`
+		From   uint64  `json:"from"`
+		To     uint64  `json:"to"`
 		Amount float64 `json:"amount"`
 	}
 
@@ -87,21 +119,19 @@ func (h *TeeHandler) TeeShuffle(c *gin.Context) {
 		return
 	}
 
-	respBody, statusCode, err := h.TeeController.Shuffle(request.From, request.To, request.Amount)
+	resp, err := h.TeeController.Shuffle(c.Request.Context(), request.From, request.To, request.Amount)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "请求失败: " + err.Error(),
-		})
+		respondTeeError(c, err)
 		return
 	}
 
-	c.String(statusCode, string(respBody))
+	c.JSON(http.StatusOK, resp)
 }
 
 func (h *TeeHandler) TeeWarning(c *gin.Context) {
 	var request struct {
-		From   int     `json:"from"`
-		To     int     `json:"to"`
+		From   uint64  `json:"from"`
+		To     uint64  `json:"to"`
 		Amount float64 `json:"amount"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -111,23 +141,17 @@ func (h *TeeHandler) TeeWarning(c *gin.Context) {
 		return
 	}
 
-	respBody, statusCode, err := h.TeeController.Warning(request.From, request.To, request.Amount)
+	resp, err := h.TeeController.Warning(c.Request.Context(), request.From, request.To, request.Amount)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "请求失败: " + err.Error(),
-		})
+		respondTeeError(c, err)
 		return
 	}
 
-	c.String(statusCode, string(respBody))
+	c.JSON(http.StatusOK, resp)
 }
 
 func (h *TeeHandler) TeeDecrypt(c *gin.Context) {
-	var request struct {
-		From   string `json:"from"`
-		To     string `json:"to"`
-		Amount string `json:"amount"`
-	}
+	var request tee.Envelope
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -136,15 +160,17 @@ func (h *TeeHandler) TeeDecrypt(c *gin.Context) {
 		return
 	}
 
-	respBody, statusCode, err := h.TeeController.Decrypt(request.From, request.To, request.Amount)
+	if !middleware.AuthorizeWallet(c, uint(request.Sender)) {
+		return
+	}
+
+	resp, err := h.TeeController.Decrypt(c.Request.Context(), &request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "请求失败: " + err.Error(),
-		})
+		respondTeeError(c, err)
 		return
 	}
 
-	c.String(statusCode, string(respBody))
+	c.JSON(http.StatusOK, resp)
 }
 
 func (h *TeeHandler) TeeEncrypt(c *gin.Context) {
@@ -161,8 +187,16 @@ func (h *TeeHandler) TeeEncrypt(c *gin.Context) {
 		return
 	}
 
-	encryptedData, err := h.TeeController.Encrypt(request.From, request.To, request.Amount)
+	if !middleware.AuthorizeWallet(c, utils.StringToUint(request.From)) {
+		return
+	}
+
+	encryptedData, err := h.TeeController.Encrypt(c.Request.Context(), request.From, request.To, request.Amount)
 	if err != nil {
+		if _, ok := err.(*errors.HufuError); ok {
+			respondTeeError(c, err)
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
@@ -172,118 +206,110 @@ func (h *TeeHandler) TeeEncrypt(c *gin.Context) {
 	c.JSON(http.StatusOK, encryptedData)
 }
 
-func (h *TeeHandler) GetEncryptedHistory(c *gin.Context) {
-	var req struct {
-		Id         string `json:"id"`
-		PrivateKey string `json:"private_key"`
-	}
+const (
+	defaultHistoryPageSize = 10
+	maxHistoryPageSize     = 100
+)
+
+// historyRequest 加密交易记录查询请求
+// nonce 为 /wallet/challenge 签发的挑战, signature 为钱包私钥对挑战内容的签名
+type historyRequest struct {
+	controller.EncryptedHistoryFilter
+	Id        string `json:"id"`
+	Nonce     string `json:"nonce" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+	Page      int    `json:"page"`
+	PageSize  int    `json:"page_size"`
+}
 
+// bindHistoryRequest 解析请求并校验钱包签名, 失败时已写入响应
+func bindHistoryRequest(c *gin.Context) (*historyRequest, *model.WalletKey, bool) {
+	var req historyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "无效的请求格式: " + err.Error(),
 		})
-		return
+		return nil, nil, false
 	}
 
-	// 验证私钥是否正确
-	wallet, err := controller.GetWalletByID(utils.StringToUint(req.Id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "钱包不存在: " + err.Error(),
+	if req.Role != "" && req.Role != model.RecordViewSender && req.Role != model.RecordViewReceiver {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的记录角色: " + string(req.Role),
 		})
-		return
+		return nil, nil, false
+	}
+
+	// 设置默认值
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > maxHistoryPageSize {
+		req.PageSize = defaultHistoryPageSize
+	}
+
+	walletID := utils.StringToUint(req.Id)
+	if !middleware.AuthorizeWallet(c, walletID) {
+		return nil, nil, false
+	}
+
+	// 验证钱包对挑战的签名
+	if err := controller.RedeemWalletChallenge(walletID, controller.ChallengePurposeHistory, req.Nonce, req.Signature); err != nil {
+		respondSignatureError(c, err)
+		return nil, nil, false
 	}
-	walletKey, err := controller.GetWalletKeyByWalletID(wallet.ID)
+
+	walletKey, err := controller.GetWalletKeyByWalletID(walletID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "钱包密钥不存在: " + err.Error(),
 		})
-		return
+		return nil, nil, false
 	}
+	return &req, walletKey, true
+}
 
-	// 验证私钥是否匹配
-	if walletKey.PrivateKey != req.PrivateKey {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "私钥验证失败",
-		})
+// GetEncryptedHistory 分页获取钱包自己的加密交易记录
+func (h *TeeHandler) GetEncryptedHistory(c *gin.Context) {
+	req, walletKey, ok := bindHistoryRequest(c)
+	if !ok {
 		return
 	}
-	var result []model.EncryptedTransaction
-	if err := model.DB.Find(&result).Error; err != nil {
+
+	result, err := controller.ListEncryptedHistory(walletKey.WalletID, req.EncryptedHistoryFilter, req.Page, req.PageSize)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "请求失败: " + err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": result,
+	})
 }
 
+// GetDecryptedHistory 分页获取并解密钱包自己的交易记录, 解密失败的记录带有 error 字段
 func (h *TeeHandler) GetDecryptedHistory(c *gin.Context) {
-	var req struct {
-		Id         string `json:"id"`
-		PrivateKey string `json:"private_key"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "无效的请求格式: " + err.Error(),
-		})
+	req, walletKey, ok := bindHistoryRequest(c)
+	if !ok {
 		return
 	}
 
-	// 验证私钥是否正确
-	wallet, err := controller.GetWalletByID(utils.StringToUint(req.Id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "钱包不存在: " + err.Error(),
-		})
+	result, err := controller.ListDecryptedHistory(walletKey, req.EncryptedHistoryFilter, req.Page, req.PageSize)
+	if err == errors.ErrKeyNotCustodial {
+		c.JSON(http.StatusBadRequest, gin.H{"code": errors.ErrKeyNotCustodial.Code, "error": errors.ErrKeyNotCustodial.Message})
 		return
 	}
-	walletKey, err := controller.GetWalletKeyByWalletID(wallet.ID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "钱包密钥不存在: " + err.Error(),
-		})
-		return
-	}
-
-	// 验证私钥是否匹配
-	if walletKey.PrivateKey != req.PrivateKey {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "私钥验证失败",
-		})
-		return
-	}
-
-	type DecryptedTransaction struct {
-		From     string `json:"from"`
-		To       string `json:"to"`
-		Amount   string `json:"amount"`
-		CreateAt string `json:"create_at"`
-	}
-	var result []model.EncryptedTransaction
-	if err := model.DB.Find(&result).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "请求失败: " + err.Error(),
 		})
 		return
 	}
 
-	var resp []DecryptedTransaction
-	for _, item := range result {
-		from, _ := utils.RSADecryptWithHexKey(item.EncryptedFromWalletID, walletKey.PrivateKey, walletKey.PublicKey)
-		to, _ := utils.RSADecryptWithHexKey(item.EncryptedToWalletID, walletKey.PrivateKey, walletKey.PublicKey)
-		amount, _ := utils.RSADecryptWithHexKey(item.EncryptedAmount, walletKey.PrivateKey, walletKey.PublicKey)
-		createAt := item.CreatedAt.Format(time.DateTime)
-		decrypted := DecryptedTransaction{
-			From:     from,
-			To:       to,
-			Amount:   amount,
-			CreateAt: createAt,
-		}
-		resp = append(resp, decrypted)
-	}
-
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": result,
+	})
 }
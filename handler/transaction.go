@@ -1,259 +1,357 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"hufu/config"
 	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
 	"hufu/model"
+	"hufu/tee"
 	"hufu/utils"
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type EncryptFTA struct {
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Amount string `json:"amount"`
-}
+// EncryptFTA 代理转账请求, 为使用 /keys 返回的 enclave 公钥生成的转账信封
+type EncryptFTA = tee.Envelope
 
 type DecryptFTA struct {
-	From   int     `json:"from"`
-	To     int     `json:"to"`
-	Amount float64 `json:"amount"`
-}
-
-type ResDecrypt struct {
-	Message string     `json:"message"`
-	Data    DecryptFTA `json:"data"`
+	From      uint64  `json:"from"`
+	To        uint64  `json:"to"`
+	Amount    float64 `json:"amount"`
+	Nonce     string  `json:"nonce"`
+	Timestamp int64   `json:"timestamp"`
+	ExpiresAt int64   `json:"expires_at"`
 }
 
-type ResWarning struct {
-	TransactionStatus string `json:"transaction_status"`
-	WarningMessage    string `json:"warning_msg"`
+// SignedTransfer 由发起方钱包签名的普通转账请求, 签名内容见 controller.TransferSigningMessage
+type SignedTransfer struct {
+	FromWalletID uint    `json:"from_wallet_id" binding:"required"`
+	ToWalletID   uint    `json:"to_wallet_id" binding:"required"`
+	Amount       float64 `json:"amount" binding:"required,gt=0"`
+	Nonce        string  `json:"nonce" binding:"required,max=64"`
+	Timestamp    int64   `json:"timestamp" binding:"required"`
+	ExpiresAt    int64   `json:"expires_at" binding:"required"`
+	Signature    string  `json:"signature" binding:"required"`
 }
 
-type ResShuffle struct {
-	Data map[string]float64 `json:"data"`
+// ProxyTransferRequest 由发起方钱包签名的代理转账信封, 签名内容见 controller.EnvelopeSigningMessage
+type ProxyTransferRequest struct {
+	EncryptFTA
+	Signature string `json:"signature" binding:"required"`
 }
 
 // NormalTransfer 处理转账请求
 func NormalTransfer(c *gin.Context) {
-	var req model.Transaction
+	var req SignedTransfer
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	from, err := controller.GetWalletByID(req.FromWalletID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	from, to, ok := verifySignedTransfer(c, &req)
+	if !ok {
 		return
 	}
-	to, err := controller.GetWalletByID(req.ToWalletID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if err := controller.CheckTierLimits(from, to, req.Amount); err != nil {
+		respondTransferError(c, err)
 		return
 	}
 
 	tx, err := controller.NormalTransfer(from, to, req.Amount)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondTransferError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": tx})
 }
 
+// verifySignedTransfer 检查钱包归属, 签名和防重放, 返回转账双方的钱包, 失败时已写入响应
+func verifySignedTransfer(c *gin.Context, req *SignedTransfer) (*model.Wallet, *model.Wallet, bool) {
+	if !middleware.AuthorizeWallet(c, req.FromWalletID) {
+		return nil, nil, false
+	}
+
+	message := controller.TransferSigningMessage(req.FromWalletID, req.ToWalletID, req.Amount, req.Nonce, req.Timestamp, req.ExpiresAt)
+	if err := controller.VerifyWalletSignature(req.FromWalletID, message, req.Signature); err != nil {
+		respondSignatureError(c, err)
+		return nil, nil, false
+	}
+	if err := controller.ClaimTransferNonce(uint64(req.FromWalletID), req.Nonce, req.Timestamp, req.ExpiresAt); err != nil {
+		respondReplayError(c, err)
+		return nil, nil, false
+	}
+
+	from, err := controller.GetWalletByID(req.FromWalletID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	to, err := controller.GetWalletByID(req.ToWalletID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	return from, to, true
+}
+
 // ProxyTransfer 处理转账请求
 func ProxyTransfer(c *gin.Context) {
-	var req EncryptFTA
+	var req ProxyTransferRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	tc := controller.NewTeeController()
+	// 信封中明文的发起方必须是当前账号的钱包, 解密后还会校验与转账内容一致
+	if !middleware.AuthorizeWallet(c, uint(req.Sender)) {
+		return
+	}
+	if err := controller.VerifyWalletSignature(uint(req.Sender), controller.EnvelopeSigningMessage(&req.EncryptFTA), req.Signature); err != nil {
+		respondSignatureError(c, err)
+		return
+	}
 
-	// 1. 解密交易数据
-	decryptedData, err := handleDecryption(tc, req)
+	// KYC 等级不允许代理转账时在解密之前拒绝
+	sender, err := controller.GetWalletByID(uint(req.Sender))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-
-	// 2. 保存EncryptFTA
-	if err := createEncryptedTransaction(decryptedData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := controller.CheckWalletCanSend(sender); err != nil {
+		respondTransferError(c, err)
 		return
 	}
-
-	// 3. 验证交易
-	if err := handleWarningCheck(tc, decryptedData); err != nil {
+	if err := controller.CheckProxyTransferAllowed(sender); err != nil {
+		if err == errors.ErrProxyTransferNotAllowed {
+			c.JSON(http.StatusForbidden, gin.H{"code": errors.ErrProxyTransferNotAllowed.Code, "error": errors.ErrProxyTransferNotAllowed.Message})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 4. 混洗交易
-	shuffleResult, err := handleShuffle(tc, decryptedData)
+	tc := controller.NewTeeController()
+
+	ctx := c.Request.Context()
+
+	// 1. 解密交易数据
+	decryptedData, err := handleDecryption(ctx, tc, req.EncryptFTA)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondTeeError(c, err)
 		return
 	}
 
-	// 5. 执行源钱包到代理钱包的转账
-	if err := handleSourceToProxy(decryptedData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 拒绝过期和重放的请求, 必须在任何资金变动之前
+	if err := controller.ClaimTransferNonce(decryptedData.From, decryptedData.Nonce, decryptedData.Timestamp, decryptedData.ExpiresAt); err != nil {
+		respondReplayError(c, err)
 		return
 	}
 
-	// 6. 执行代理到目标钱包的转账
-	if err := handleProxyToTarget(decryptedData, shuffleResult); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 解密后才知道收款方和金额, 在资金进入代理钱包之前检查双方钱包状态和 KYC 等级限额
+	if err := checkProxyTransferWallets(decryptedData); err != nil {
+		respondTransferError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "success"})
-}
-
-// createEncryptedTransaction 创建加密交易记录
-func createEncryptedTransaction(decryptedData *DecryptFTA) error {
-	walletKey, err := controller.GetWalletKeyByWalletID(uint(decryptedData.From))
-	if err != nil {
-		return err
+	// 2. 验证交易
+	if err := handleWarningCheck(ctx, tc, decryptedData); err != nil {
+		respondTeeError(c, err)
+		return
 	}
 
-	encryptedFromWalletID, err := utils.RSAEncryptWithHexKey(strconv.Itoa(decryptedData.From), walletKey.PublicKey)
+	// 3. 混洗交易
+	shuffleResult, err := handleShuffle(ctx, tc, decryptedData)
 	if err != nil {
-		return err
+		respondTeeError(c, err)
+		return
 	}
 
-	encryptedToWalletID, err := utils.RSAEncryptWithHexKey(strconv.Itoa(decryptedData.To), walletKey.PublicKey)
-	if err != nil {
-		return err
+	// 资金进入代理钱包之后无法退回, 先确认代理钱包都能转出且收款方仍能收款
+	if err := checkProxyLegWallets(decryptedData, shuffleResult); err != nil {
+		respondTransferError(c, err)
+		return
 	}
 
-	encryptedAmount, err := utils.RSAEncryptWithHexKey(strconv.FormatFloat(decryptedData.Amount, 'f', -1, 64), walletKey.PublicKey)
+	// 4. 执行源钱包到代理钱包的转账
+	sourceTx, err := handleSourceToProxy(decryptedData)
 	if err != nil {
-		return err
+		respondTransferError(c, err)
+		return
 	}
 
-	var count int64
-	if err := model.DB.Model(&model.Transaction{}).Count(&count).Error; err != nil {
-		return err
+	// 5. 执行代理到目标钱包的转账
+	if err := handleProxyToTarget(decryptedData, shuffleResult); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	encryptedTx := &model.EncryptedTransaction{
-		TransactionID:         uint(count + 1),
-		EncryptedFromWalletID: encryptedFromWalletID,
-		EncryptedToWalletID:   encryptedToWalletID,
-		EncryptedAmount:       encryptedAmount,
+	// 6. 保存交易双方的加密交易记录, 关联到源钱包转出的交易
+	if err := createEncryptedTransactions(sourceTx.ID, decryptedData); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	return model.DB.Create(encryptedTx).Error
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
 }
 
-// handleDecryption 处理解密过程
-func handleDecryption(tc *controller.TeeController, req EncryptFTA) (*DecryptFTA, error) {
-	respBody, _, _ := tc.Decrypt(req.From, req.To, req.Amount)
-	log.Println(string(respBody))
+// respondReplayError 重放返回 409, 过期返回 400
+func respondReplayError(c *gin.Context, err error) {
+	hufuErr, ok := err.(*errors.HufuError)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusBadRequest
+	if hufuErr.Code == errors.ErrTransferReplayed.Code {
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+}
 
-	var resDecrypt ResDecrypt
-	if err := json.Unmarshal(respBody, &resDecrypt); err != nil {
-		return nil, err
+// createEncryptedTransactions 为交易双方各创建一份加密交易记录
+func createEncryptedTransactions(transactionID uint, decryptedData *DecryptFTA) error {
+	encryptedTxs, err := controller.SealTransactionCopies(&controller.TransactionRecord{
+		TransactionID: transactionID,
+		From:          uint(decryptedData.From),
+		To:            uint(decryptedData.To),
+		Amount:        decryptedData.Amount,
+	})
+	if err != nil {
+		return err
 	}
 
-	if resDecrypt.Message != "Transaction decrypted successfully." {
-		return nil, fmt.Errorf(resDecrypt.Message)
+	return model.DB.Create(encryptedTxs).Error
+}
+
+// handleDecryption 处理解密过程
+func handleDecryption(ctx context.Context, tc *controller.TeeController, req EncryptFTA) (*DecryptFTA, error) {
+	resp, err := tc.Decrypt(ctx, &req)
+	if err != nil {
+		return nil, err
 	}
 
-	return &resDecrypt.Data, nil
+	return &DecryptFTA{
+		From:      resp.Data.From,
+		To:        resp.Data.To,
+		Amount:    resp.Data.Amount,
+		Nonce:     resp.Data.Nonce,
+		Timestamp: resp.Data.Timestamp,
+		ExpiresAt: resp.Data.ExpiresAt,
+	}, nil
 }
 
 // handleWarningCheck 处理交易验证
-func handleWarningCheck(tc *controller.TeeController, decryptedData *DecryptFTA) error {
-	respBody, _, _ := tc.Warning(decryptedData.From, decryptedData.To, decryptedData.Amount)
-	log.Println("warning:", string(respBody))
-
-	var resWarning ResWarning
-	if err := json.Unmarshal(respBody, &resWarning); err != nil {
+func handleWarningCheck(ctx context.Context, tc *controller.TeeController, decryptedData *DecryptFTA) error {
+	resp, err := tc.Warning(ctx, decryptedData.From, decryptedData.To, decryptedData.Amount)
+	if err != nil {
 		return err
 	}
 
-	if resWarning.TransactionStatus != "Success" {
-		log.Println("warning:================================================")
-		log.Println(resWarning.WarningMessage)
-		if err := createAbnormalTransaction(decryptedData, resWarning.WarningMessage); err != nil {
+	if !resp.Passed() {
+		log.Println("warning:", resp.WarningMessage)
+		if err := createAbnormalTransaction(decryptedData, resp.WarningMessage); err != nil {
 			return err
 		}
-		return fmt.Errorf(resWarning.WarningMessage)
+		return errors.NewHufuError(errors.ErrTeeTransactionWarning.Code, errors.ErrTeeTransactionWarning.Message+": "+resp.WarningMessage)
 	}
 
 	return nil
 }
 
-// createAbnormalTransaction 创建异常交易记录
+// createAbnormalTransaction 创建失败的交易记录和异常交易证据
 func createAbnormalTransaction(decryptedData *DecryptFTA, warningMessage string) error {
-	var count int64
-	if err := model.DB.Model(&model.Transaction{}).Count(&count).Error; err != nil {
+	from, err := controller.GetWalletByID(uint(decryptedData.From))
+	if err != nil {
 		return err
 	}
-
-	evidence := fmt.Sprintf("Transaction ID: %d, From: %d, To: %d, Amount: %f, Time: %s, Error: %v",
-		count+1, decryptedData.From, decryptedData.To, decryptedData.Amount,
-		time.Now().Format(time.RFC3339), warningMessage)
-
-	// 使用监管者的私钥对证据进行签名
-	signature, err := utils.SignData(config.GlobalConfig.Tee.PrivateKey, evidence)
+	to, err := controller.GetWalletByID(uint(decryptedData.To))
 	if err != nil {
 		return err
 	}
 
-	abnormal := &model.AbnormalTransaction{
-		WalletID:      uint(decryptedData.From),
-		TransactionID: uint(count + 1),
-		Evidence:      evidence,
-		Signature:     signature,
-	}
-
-	return model.DB.Create(abnormal).Error
+	_, err = controller.RecordRuleViolation(from, to, decryptedData.Amount, &controller.RuleViolation{
+		Rule:    controller.RuleTeeWarning,
+		Message: warningMessage,
+		Inputs: map[string]string{
+			"from":   strconv.FormatUint(decryptedData.From, 10),
+			"to":     strconv.FormatUint(decryptedData.To, 10),
+			"amount": controller.FormatEvidenceAmount(decryptedData.Amount),
+		},
+	})
+	return err
 }
 
 // handleShuffle 处理混洗过程
-func handleShuffle(tc *controller.TeeController, decryptedData *DecryptFTA) (*ResShuffle, error) {
-	respBody, _, _ := tc.Shuffle(decryptedData.From, decryptedData.To, decryptedData.Amount)
-	log.Println("shuffle:", string(respBody))
+func handleShuffle(ctx context.Context, tc *controller.TeeController, decryptedData *DecryptFTA) (*tee.ShuffleResponse, error) {
+	return tc.Shuffle(ctx, decryptedData.From, decryptedData.To, decryptedData.Amount)
+}
 
-	var resShuffle ResShuffle
-	if err := json.Unmarshal(respBody, &resShuffle); err != nil {
-		return nil, err
+// checkProxyTransferWallets 检查解密后的发起方和收款方钱包状态, 以及发起方 KYC 等级的限额
+func checkProxyTransferWallets(decryptedData *DecryptFTA) error {
+	from, err := controller.GetWalletByID(uint(decryptedData.From))
+	if err != nil {
+		return err
+	}
+	to, err := controller.GetWalletByID(uint(decryptedData.To))
+	if err != nil {
+		return err
+	}
+	if err := controller.CheckTransferAllowed(from, to); err != nil {
+		return err
+	}
+	return controller.CheckTierLimits(from, to, decryptedData.Amount)
+}
+
+// checkProxyLegWallets 检查代理钱包 2 和混洗结果中的每个代理钱包能否转出, 以及收款方能否收款
+func checkProxyLegWallets(decryptedData *DecryptFTA, shuffleResult *tee.ShuffleResponse) error {
+	ids := []uint{2}
+	for from := range shuffleResult.Data {
+		id, err := strconv.Atoi(from)
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid proxy wallet id %q in shuffle result", from)
+		}
+		ids = append(ids, uint(id))
+	}
+	for _, id := range ids {
+		proxy, err := controller.GetWalletByID(id)
+		if err != nil {
+			return err
+		}
+		if err := controller.CheckWalletCanSend(proxy); err != nil {
+			return err
+		}
 	}
 
-	return &resShuffle, nil
+	to, err := controller.GetWalletByID(uint(decryptedData.To))
+	if err != nil {
+		return err
+	}
+	return controller.CheckWalletCanReceive(to)
 }
 
 // handleSourceToProxy 处理源钱包到代理钱包的转账
-func handleSourceToProxy(decryptedData *DecryptFTA) error {
+func handleSourceToProxy(decryptedData *DecryptFTA) (*model.Transaction, error) {
 	from, err := controller.GetWalletByID(uint(decryptedData.From))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	proxy, err := controller.GetWalletByID(2)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = controller.NormalTransfer(from, proxy, decryptedData.Amount)
-	return err
+	return controller.NormalTransfer(from, proxy, decryptedData.Amount)
 }
 
 // handleProxyToTarget 处理代理到目标钱包的转账
-func handleProxyToTarget(decryptedData *DecryptFTA, shuffleResult *ResShuffle) error {
+func handleProxyToTarget(decryptedData *DecryptFTA, shuffleResult *tee.ShuffleResponse) error {
 	to, err := controller.GetWalletByID(uint(decryptedData.To))
 	if err != nil {
 		return err
@@ -287,6 +385,10 @@ func GetTransferHistory(c *gin.Context) {
 		return
 	}
 
+	if !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
 	// 设置默认值
 	if req.Page <= 0 {
 		req.Page = 1
@@ -315,7 +417,7 @@ func GetTransferHistory(c *gin.Context) {
 // 		return
 // 	}
 
-// 	encryptedTx, err := controller.GetEncryptedTransaction(req.WalletID, req.PrivateKey)
+// 	encryptedTx, err := controller.GetEncryptedTransaction(req.WalletID)
 // 	if err != nil {
 // 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 // 		return
@@ -357,6 +459,10 @@ func GetReceivedTransactions(c *gin.Context) {
 		return
 	}
 
+	if !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
 	result, err := controller.GetReceivedTransactions(req.WalletID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -383,6 +489,10 @@ func GetTransactionStats(c *gin.Context) {
 		return
 	}
 
+	if !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
 	stats, err := controller.GetTransactionStats(req.WalletID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
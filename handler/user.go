@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondUserError 用户不存在返回 404, 用户名冲突返回 409, 其他参数错误返回 400
+func respondUserError(c *gin.Context, err error) {
+	switch err {
+	case errors.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"code": errors.ErrUserNotFound.Code, "error": errors.ErrUserNotFound.Message})
+	case errors.ErrUserExists:
+		c.JSON(http.StatusConflict, gin.H{"code": errors.ErrUserExists.Code, "error": errors.ErrUserExists.Message})
+	case errors.ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"code": errors.ErrForbidden.Code, "error": errors.ErrForbidden.Message})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// CreateUser 运营人员创建用户, 可同时绑定登录账号
+func CreateUser(c *gin.Context) {
+	var req struct {
+		controller.UserProfile
+		Username  string `json:"username" binding:"required"`
+		AccountID *uint  `json:"account_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := controller.CreateUser(req.Username, req.AccountID, req.UserProfile)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// GetCurrentUser 获取当前账号绑定的用户
+func GetCurrentUser(c *gin.Context) {
+	user, err := controller.GetUserByAccountID(middleware.CurrentAccount(c).ID)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// GetUser 按ID或公开标识获取用户
+func GetUser(c *gin.Context) {
+	var req struct {
+		ID  uint   `json:"id"`
+		UID string `json:"uid"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userID uint
+	switch {
+	case req.ID != 0:
+		userID = req.ID
+	case req.UID != "":
+		user, err := controller.GetUserByUID(req.UID)
+		if err != nil {
+			respondUserError(c, err)
+			return
+		}
+		userID = user.ID
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id 或 uid 至少提供一个"})
+		return
+	}
+
+	if !middleware.AuthorizeUser(c, userID) {
+		return
+	}
+	user, err := controller.GetUserByID(userID)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// UpdateUser 更新用户资料
+func UpdateUser(c *gin.Context) {
+	var req struct {
+		controller.UserProfile
+		ID uint `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.AuthorizeUser(c, req.ID) {
+		return
+	}
+	user, err := controller.UpdateUserProfile(req.ID, req.UserProfile)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// LinkUserAccount 运营人员为用户绑定登录账号
+func LinkUserAccount(c *gin.Context) {
+	var req struct {
+		ID        uint `json:"id" binding:"required"`
+		AccountID uint `json:"account_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := controller.LinkUserAccount(req.ID, req.AccountID)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// ListUsers 分页查询用户
+func ListUsers(c *gin.Context) {
+	var req struct {
+		controller.UserFilter
+		Page     int `json:"page"`
+		PageSize int `json:"page_size"`
+	}
+
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListUsers(req.UserFilter, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
+
+// GetUserWallets 获取用户的所有钱包和余额合计
+func GetUserWallets(c *gin.Context) {
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.AuthorizeUser(c, req.ID) {
+		return
+	}
+	result, err := controller.ListUserWallets(req.ID)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// TransferBetweenUserWallets 在同一用户的两个钱包之间转账, 与普通转账一样需要发起钱包签名
+func TransferBetweenUserWallets(c *gin.Context) {
+	var req SignedTransfer
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, ok := verifySignedTransfer(c, &req)
+	if !ok {
+		return
+	}
+
+	tx, err := controller.TransferBetweenUserWallets(from, to, req.Amount)
+	if err != nil {
+		if err == errors.ErrForbidden {
+			respondUserError(c, err)
+			return
+		}
+		respondTransferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tx})
+}
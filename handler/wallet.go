@@ -2,30 +2,77 @@ package handler
 
 import (
 	"hufu/controller"
+	"hufu/middleware"
 	"hufu/model"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CreateWallet 创建钱包
+// CreateWallet 创建钱包, 新钱包余额为0
+// 钱包持有人只能为自己的用户创建钱包, 首次创建时以账号用户名建立用户
+// 运营人员可以以 user_id 指定所属用户, 不指定时创建系统钱包
+// 提交 public_key 时创建非托管钱包, 非托管模式下必须提交
 func CreateWallet(c *gin.Context) {
-	var req model.Wallet
+	var req struct {
+		UserID     uint   `json:"user_id"`
+		Username   string `json:"user_name"`
+		WalletName string `json:"wallet_name"`
+		PublicKey  string `json:"public_key"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	wallet, err := controller.NewWallet(req.WalletName, req.Username, req.Balance)
+	var (
+		owner *model.User
+		err   error
+	)
+	account := middleware.CurrentAccount(c)
+	switch {
+	case account.Role != model.RoleOperator:
+		owner, err = controller.EnsureUserForAccount(account)
+	case req.UserID != 0:
+		owner, err = controller.GetUserByID(req.UserID)
+	}
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	wallet, err := controller.NewWallet(owner, req.WalletName, req.Username, req.PublicKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	walletKey, err := controller.GetWalletKeyByWalletID(wallet.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if walletKey.Custody == model.CustodyNonCustodial {
+		c.JSON(http.StatusOK, gin.H{"data": wallet, "wallet_key": walletKey})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"data": wallet})
+	// 托管钱包的私钥只在创建时返回这一次, 之后客户端用它对挑战和转账签名, 不再通过接口传输
+	privateKey, err := controller.UnsealWalletPrivateKey(walletKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": wallet,
+		"wallet_key": gin.H{
+			"custody":     walletKey.Custody,
+			"public_key":  walletKey.PublicKey,
+			"private_key": privateKey,
+		},
+	})
 }
 
-// GetWallet 获取单个钱包详情
+// GetWallet 获取单个钱包详情, 可按ID, 钱包名称或用户名查询
 func GetWallet(c *gin.Context) {
 	var req model.Wallet
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -33,38 +80,38 @@ func GetWallet(c *gin.Context) {
 		return
 	}
 
-	if req.ID != 0 {
-		wallet, err := controller.GetWalletByID(req.ID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"data": wallet})
+	var (
+		wallet *model.Wallet
+		err    error
+	)
+	switch {
+	case req.ID != 0:
+		wallet, err = controller.GetWalletByID(req.ID)
+	case req.WalletName != "":
+		wallet, err = controller.GetWalletByWalletName(req.WalletName)
+	case req.Username != "":
+		wallet, err = controller.GetWalletByUsername(req.Username)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id, wallet_name 或 user_name 至少提供一个"})
 		return
 	}
-	if req.WalletName != "" {
-		wallet, err := controller.GetWalletByWalletName(req.WalletName)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"data": wallet})
-
-	}
-	if req.Username != "" {
-		wallet, err := controller.GetWalletByUsername(req.Username)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"data": wallet})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
 
+	if !middleware.AuthorizeWallet(c, wallet.ID) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
 }
 
-// UpdateWallet 更新钱包信息
+// UpdateWallet 更新钱包名称, 余额通过 /balance 下的接口变更
 func UpdateWallet(c *gin.Context) {
-	var req model.Wallet
+	var req struct {
+		ID         uint   `json:"ID" binding:"required"`
+		WalletName string `json:"wallet_name" binding:"required"`
+	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -75,7 +122,7 @@ func UpdateWallet(c *gin.Context) {
 	}
 
 	// 调用 controller 层更新钱包
-	err := controller.UpdateWallet(req.ID, req.WalletName, req.Balance)
+	err := controller.UpdateWallet(req.ID, req.WalletName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": -1,
@@ -101,6 +148,10 @@ func GetWalletStats(c *gin.Context) {
 		return
 	}
 
+	if !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
 	stats, err := controller.GetWalletStats(req.WalletID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -125,6 +176,10 @@ func GetTrend(c *gin.Context) {
 		return
 	}
 
+	if !middleware.AuthorizeWallet(c, req.WalletID) {
+		return
+	}
+
 	// 从数据库获取支出趋势数据
 	trends, err := controller.GetTrend(req.WalletID)
 	if err != nil {
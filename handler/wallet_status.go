@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/middleware"
+	"hufu/model"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// walletStatusErrorStatus 钱包状态相关错误对应的 HTTP 状态码
+func walletStatusErrorStatus(err error) int {
+	switch err {
+	case errors.ErrWalletNotFound:
+		return http.StatusNotFound
+	case errors.ErrWalletFrozen, errors.ErrWalletClosed, errors.ErrWalletStatusTransition, errors.ErrWalletHasHolds:
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func respondWalletStatusError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok {
+		c.JSON(walletStatusErrorStatus(err), gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// respondTransferError 钱包被冻结或注销返回 409, 余额不足返回 400, 超过 KYC 等级限额返回 403, 其他错误返回 500
+func respondTransferError(c *gin.Context, err error) {
+	if hufuErr, ok := err.(*errors.HufuError); ok && hufuErr.Code == errors.ErrTransactionAmountTooLarge.Code {
+		c.JSON(http.StatusForbidden, gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+		return
+	}
+	switch err {
+	case errors.ErrWalletFrozen, errors.ErrWalletClosed:
+		respondWalletStatusError(c, err)
+	case errors.ErrInsufficientBalance, errors.ErrInvalidAmount:
+		hufuErr := err.(*errors.HufuError)
+		c.JSON(http.StatusBadRequest, gin.H{"code": hufuErr.Code, "error": hufuErr.Message})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// FreezeWallet 冻结钱包, 不传 expires_at 时冻结到人工解冻为止
+func FreezeWallet(c *gin.Context) {
+	var req struct {
+		WalletID  uint       `json:"wallet_id" binding:"required"`
+		Reason    string     `json:"reason" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wallet, err := controller.FreezeWallet(req.WalletID, middleware.CurrentAccount(c), req.Reason, req.ExpiresAt)
+	if err != nil {
+		respondWalletStatusError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
+}
+
+// UnfreezeWallet 解除冻结
+func UnfreezeWallet(c *gin.Context) {
+	var req struct {
+		WalletID uint   `json:"wallet_id" binding:"required"`
+		Reason   string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wallet, err := controller.UnfreezeWallet(req.WalletID, middleware.CurrentAccount(c), req.Reason)
+	if err != nil {
+		respondWalletStatusError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
+}
+
+// CloseWallet 注销钱包, 有余额时必须指定 sweep_to 接收余额的钱包
+func CloseWallet(c *gin.Context) {
+	var req struct {
+		WalletID uint   `json:"wallet_id" binding:"required"`
+		SweepTo  uint   `json:"sweep_to"`
+		Reason   string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wallet, err := controller.CloseWallet(req.WalletID, req.SweepTo, middleware.CurrentAccount(c), req.Reason)
+	if err != nil {
+		respondWalletStatusError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": wallet})
+}
+
+// ListWalletStatusChanges 分页查询钱包状态变更日志, 钱包持有人只能查询自己的钱包
+func ListWalletStatusChanges(c *gin.Context) {
+	var req struct {
+		WalletID uint `json:"wallet_id"`
+		Page     int  `json:"page"`
+		PageSize int  `json:"page_size"`
+	}
+
+	// 允许不带请求体, 此时返回第一页
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if middleware.CurrentAccount(c).Role == model.RoleWalletOwner {
+		if req.WalletID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_id is required"})
+			return
+		}
+		if !middleware.AuthorizeWallet(c, req.WalletID) {
+			return
+		}
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	result, err := controller.ListWalletStatusChanges(req.WalletID, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
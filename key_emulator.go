@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hufu/keyprovider/emulator"
+	"log"
+	"net/http"
+)
+
+// runKeyEmulator 启动本地 HSM 模拟服务, 用于 keys.source = emulator
+func runKeyEmulator(args []string) {
+	fs := flag.NewFlagSet("key-emulator", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8084", "listen address")
+	seed := fs.String("seed", "", "seed for the keys, random when empty")
+	fs.Parse(args)
+
+	if *seed == "" {
+		log.Printf("no -seed given, the keys will change on restart")
+	}
+
+	fmt.Printf("key emulator listening on %s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, emulator.NewServer(*seed).Handler()))
+}
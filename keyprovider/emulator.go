@@ -0,0 +1,83 @@
+package keyprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultEmulatorTimeout = 10 * time.Second
+
+// EmulatorKey 模拟服务返回的密钥版本
+type EmulatorKey struct {
+	KeyID      string `json:"key_id"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key,omitempty"`
+	Retired    bool   `json:"retired"`
+}
+
+// EmulatorKeysResponse /v1/keys/{name} 的响应
+type EmulatorKeysResponse struct {
+	Name  string        `json:"name"`
+	Keys  []EmulatorKey `json:"keys"`
+	Error string        `json:"error,omitempty"`
+}
+
+// EmulatorSource 从本地 HSM 模拟服务读取密钥, 仅用于开发和测试
+type EmulatorSource struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewEmulatorSource 创建模拟服务来源
+func NewEmulatorSource(baseURL string, timeoutSeconds int) (*EmulatorSource, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("keys.emulator.url is not configured")
+	}
+	timeout := defaultEmulatorTimeout
+	if timeoutSeconds > 0 {
+		timeout = time.Duration(timeoutSeconds) * time.Second
+	}
+	return &EmulatorSource{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Keys 从模拟服务获取名称对应的所有版本, 名称不存在时返回空
+func (s *EmulatorSource) Keys(name string) ([]Key, error) {
+	path := "/v1/keys/" + url.PathEscape(name)
+	resp, err := s.httpClient.Get(s.baseURL + path)
+	if err != nil {
+		return nil, fmt.Errorf("key emulator %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("key emulator %s: %v", path, err)
+	}
+	var body EmulatorKeysResponse
+	if resp.StatusCode != http.StatusOK {
+		if json.Unmarshal(data, &body) == nil && body.Error != "" {
+			return nil, fmt.Errorf("key emulator %s: %s", path, body.Error)
+		}
+		return nil, fmt.Errorf("key emulator %s: status %d", path, resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("key emulator %s: invalid response: %v", path, err)
+	}
+
+	keys := make([]Key, 0, len(body.Keys))
+	for _, k := range body.Keys {
+		keys = append(keys, Key{Name: name, ID: k.KeyID, PublicKey: k.PublicKey, PrivateKey: k.PrivateKey, Retired: k.Retired})
+	}
+	return keys, nil
+}
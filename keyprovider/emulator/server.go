@@ -0,0 +1,134 @@
+package emulator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hufu/keyprovider"
+	"hufu/utils"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Server 本地 HSM 模拟服务, 为服务启动所需的每个密钥名称提供密钥, 密钥只保存在内存中
+// 指定种子时每个版本的私钥由种子, 名称和版本号推导, 重启后保持不变
+type Server struct {
+	seed  string
+	mu    sync.Mutex
+	names map[string]bool
+	rings map[string][]keyprovider.EmulatorKey
+}
+
+// NewServer 创建模拟服务, seed 为空时随机生成密钥
+func NewServer(seed string) *Server {
+	names := make(map[string]bool)
+	for _, name := range append(keyprovider.RequiredNames(), keyprovider.OptionalNames()...) {
+		names[name] = true
+	}
+	return &Server{seed: seed, names: names, rings: make(map[string][]keyprovider.EmulatorKey)}
+}
+
+// Handler 返回模拟服务的路由
+//
+//	GET  /v1/keys/{name}        获取密钥的所有版本
+//	POST /v1/keys/{name}/rotate 生成新版本, 原版本转为退役
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/keys/", s.handleKeys)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/keys/")
+	name, action, _ := strings.Cut(path, "/")
+	if !s.names[name] {
+		writeJSON(w, http.StatusNotFound, &keyprovider.EmulatorKeysResponse{Error: "unknown key " + name})
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+	case action == "rotate" && r.Method == http.MethodPost:
+		if _, err := s.rotate(name); err != nil {
+			writeJSON(w, http.StatusInternalServerError, &keyprovider.EmulatorKeysResponse{Error: err.Error()})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, &keyprovider.EmulatorKeysResponse{Error: "method not allowed"})
+		return
+	}
+
+	keys, err := s.Keys(name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, &keyprovider.EmulatorKeysResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, &keyprovider.EmulatorKeysResponse{Name: name, Keys: keys})
+}
+
+// Keys 返回名称对应的所有版本, 第一次访问时生成第一个版本
+func (s *Server) Keys(name string) ([]keyprovider.EmulatorKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.rings[name]) == 0 {
+		return s.rotateLocked(name)
+	}
+	return append([]keyprovider.EmulatorKey{}, s.rings[name]...), nil
+}
+
+// rotate 生成新版本, 原版本转为退役并删除私钥
+func (s *Server) rotate(name string) ([]keyprovider.EmulatorKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotateLocked(name)
+}
+
+func (s *Server) rotateLocked(name string) ([]keyprovider.EmulatorKey, error) {
+	ring := append([]keyprovider.EmulatorKey{}, s.rings[name]...)
+	privateKey, err := s.generate(name, len(ring)+1)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := utils.PublicKeyFromPrivate(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := utils.PublicKeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ring {
+		ring[i].Retired = true
+		ring[i].PrivateKey = ""
+	}
+	ring = append(ring, keyprovider.EmulatorKey{KeyID: keyID, PublicKey: publicKey, PrivateKey: privateKey})
+	s.rings[name] = ring
+	return append([]keyprovider.EmulatorKey{}, ring...), nil
+}
+
+// generate 生成名称第 version 个版本的私钥
+func (s *Server) generate(name string, version int) (string, error) {
+	if s.seed == "" {
+		privateKey, _, _ := utils.GenerateKeys()
+		return privateKey, nil
+	}
+	// 哈希结果超出曲线阶的概率可以忽略, 仍按计数重试保证总能得到有效私钥
+	for counter := 0; counter < 16; counter++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("hufu-key-emulator\x00%s\x00%s\x00%d\x00%d", s.seed, name, version, counter)))
+		if _, err := crypto.ToECDSA(sum[:]); err == nil {
+			return hex.EncodeToString(sum[:]), nil
+		}
+	}
+	return "", fmt.Errorf("failed to derive key %s", name)
+}
@@ -0,0 +1,57 @@
+package keyprovider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultEnvPrefix 密钥环境变量的默认前缀
+const DefaultEnvPrefix = "HUFU_KEY"
+
+// EnvSource 从环境变量读取密钥, 适合由容器编排的密钥管理注入
+//
+//	<PREFIX>_<NAME>=[key_id:]私钥hex
+//	<PREFIX>_<NAME>_PREVIOUS=[key_id:]公钥hex,[key_id:]公钥hex
+type EnvSource struct {
+	prefix string
+}
+
+// NewEnvSource 创建环境变量来源
+func NewEnvSource(prefix string) *EnvSource {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	return &EnvSource{prefix: prefix}
+}
+
+// Keys 读取名称对应的当前密钥和退役公钥
+func (s *EnvSource) Keys(name string) ([]Key, error) {
+	variable := s.prefix + "_" + strings.ToUpper(name)
+
+	var keys []Key
+	if value := strings.TrimSpace(os.Getenv(variable)); value != "" {
+		id, privateKey := splitKeyID(value)
+		keys = append(keys, Key{Name: name, ID: id, PrivateKey: privateKey})
+	}
+	for _, value := range strings.Split(os.Getenv(variable+"_PREVIOUS"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		id, publicKey := splitKeyID(value)
+		keys = append(keys, Key{Name: name, ID: id, PublicKey: publicKey, Retired: true})
+	}
+	if len(keys) > 0 && keys[0].Retired {
+		return nil, fmt.Errorf("%s_PREVIOUS is set but %s is not", variable, variable)
+	}
+	return keys, nil
+}
+
+// splitKeyID 拆分可选的 key_id: 前缀
+func splitKeyID(value string) (string, string) {
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		return value[:i], value[i+1:]
+	}
+	return "", value
+}
@@ -0,0 +1,229 @@
+package keyprovider
+
+import (
+	"fmt"
+	"hufu/config"
+	"hufu/utils"
+	"strings"
+)
+
+// 密钥名称
+const (
+	NameTeeSigning = "tee_signing" // 签名异常交易证据和时间戳凭证
+	NameSupervisor = "supervisor"  // 监管方密钥, 可选
+	juryNameFormat = "jury%d"      // 陪审团节点的链上账户密钥
+)
+
+// 密钥来源
+const (
+	SourceKeystore = "keystore"
+	SourceEnv      = "env"
+	SourceEmulator = "emulator"
+)
+
+// JuryKeyName 第 i 个陪审团节点的密钥名称
+func JuryKeyName(i int) string {
+	return fmt.Sprintf(juryNameFormat, i)
+}
+
+// Key secp256k1 密钥, 已退役的密钥只用于验证历史签名, 可以没有私钥
+type Key struct {
+	Name       string `json:"name"`
+	ID         string `json:"key_id"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"-"`
+	Retired    bool   `json:"retired"`
+}
+
+// Source 密钥来源, 返回同一名称下的所有版本
+type Source interface {
+	Keys(name string) ([]Key, error)
+}
+
+// Ring 同一名称下的当前密钥和退役密钥
+type Ring struct {
+	Current  Key
+	Previous []Key
+}
+
+// Provider 启动时加载的全部密钥
+type Provider struct {
+	rings map[string]*Ring
+}
+
+// Default 全局密钥, 由 Init 初始化
+var Default *Provider
+
+// RequiredNames 启动时必须存在的密钥名称, 陪审团节点数与私钥分片数一致
+func RequiredNames() []string {
+	names := []string{NameTeeSigning}
+	for i := 0; i < utils.SHARES5; i++ {
+		names = append(names, JuryKeyName(i))
+	}
+	return names
+}
+
+// OptionalNames 存在时加载的密钥名称
+func OptionalNames() []string {
+	return []string{NameSupervisor}
+}
+
+// Init 根据配置加载所有必需的密钥, 任何密钥缺失或无效都返回错误
+func Init(cfg config.KeysConfig) error {
+	source, err := NewSource(cfg)
+	if err != nil {
+		return err
+	}
+	provider, err := New(source, RequiredNames(), OptionalNames())
+	if err != nil {
+		return err
+	}
+	Default = provider
+	return nil
+}
+
+// NewSource 根据配置创建密钥来源
+func NewSource(cfg config.KeysConfig) (Source, error) {
+	switch cfg.Source {
+	case SourceKeystore, "":
+		return NewKeystoreSource(cfg.Keystore.Dir, cfg.Keystore.PassphraseEnv)
+	case SourceEnv:
+		return NewEnvSource(cfg.Env.Prefix), nil
+	case SourceEmulator:
+		return NewEmulatorSource(cfg.Emulator.URL, cfg.Emulator.TimeoutSeconds)
+	default:
+		return nil, fmt.Errorf("unknown key source %q", cfg.Source)
+	}
+}
+
+// New 从来源加载密钥, 每个名称必须有且仅有一个带私钥的当前密钥, 缺少 required 中的任一密钥时返回错误
+func New(source Source, required, optional []string) (*Provider, error) {
+	p := &Provider{rings: make(map[string]*Ring)}
+	var missing []string
+	for _, name := range append(append([]string{}, required...), optional...) {
+		keys, err := source.Keys(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %v", name, err)
+		}
+		ring, err := newRing(name, keys)
+		if err != nil {
+			return nil, err
+		}
+		if ring != nil {
+			p.rings[name] = ring
+		}
+	}
+	for _, name := range required {
+		if _, ok := p.rings[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing keys: %s", strings.Join(missing, ", "))
+	}
+	return p, nil
+}
+
+// newRing 校验并整理同一名称的密钥, 没有任何密钥时返回 nil
+func newRing(name string, keys []Key) (*Ring, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	ring := &Ring{}
+	seen := make(map[string]bool)
+	hasCurrent := false
+	for _, key := range keys {
+		key.Name = name
+		if err := normalizeKey(&key); err != nil {
+			return nil, fmt.Errorf("invalid key %s/%s: %v", name, key.ID, err)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate key id %s/%s", name, key.ID)
+		}
+		seen[key.ID] = true
+
+		if key.Retired {
+			ring.Previous = append(ring.Previous, key)
+			continue
+		}
+		if hasCurrent {
+			return nil, fmt.Errorf("key %s has more than one current version, retire the old one", name)
+		}
+		if key.PrivateKey == "" {
+			return nil, fmt.Errorf("current key %s/%s has no private key", name, key.ID)
+		}
+		ring.Current = key
+		hasCurrent = true
+	}
+	if !hasCurrent {
+		return nil, fmt.Errorf("key %s has no current version", name)
+	}
+	return ring, nil
+}
+
+// normalizeKey 由私钥推导公钥并检查一致, 缺少ID时由公钥推导
+func normalizeKey(key *Key) error {
+	key.PrivateKey = strings.TrimPrefix(key.PrivateKey, "0x")
+	key.PublicKey = strings.TrimPrefix(key.PublicKey, "0x")
+	if key.PrivateKey != "" {
+		derived, err := utils.PublicKeyFromPrivate(key.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if key.PublicKey != "" && !strings.EqualFold(key.PublicKey, derived) {
+			return fmt.Errorf("public key does not match private key")
+		}
+		key.PublicKey = derived
+	}
+	if key.PublicKey == "" {
+		return fmt.Errorf("public key is required")
+	}
+	id, err := utils.PublicKeyID(key.PublicKey)
+	if err != nil {
+		return err
+	}
+	if key.ID == "" {
+		key.ID = id
+	}
+	return nil
+}
+
+// Current 返回名称对应的当前密钥
+func (p *Provider) Current(name string) (*Key, error) {
+	ring, ok := p.rings[name]
+	if !ok {
+		return nil, fmt.Errorf("key %s is not loaded", name)
+	}
+	key := ring.Current
+	return &key, nil
+}
+
+// VerifyKeys 返回名称对应的所有公钥, 包括退役的版本, 键为密钥ID
+func (p *Provider) VerifyKeys(name string) map[string]string {
+	keys := make(map[string]string)
+	ring, ok := p.rings[name]
+	if !ok {
+		return keys
+	}
+	keys[ring.Current.ID] = ring.Current.PublicKey
+	for _, key := range ring.Previous {
+		keys[key.ID] = key.PublicKey
+	}
+	return keys
+}
+
+// Current 从全局密钥中获取当前密钥
+func Current(name string) (*Key, error) {
+	if Default == nil {
+		return nil, fmt.Errorf("key provider is not initialized")
+	}
+	return Default.Current(name)
+}
+
+// VerifyKeys 从全局密钥中获取验签公钥
+func VerifyKeys(name string) map[string]string {
+	if Default == nil {
+		return map[string]string{}
+	}
+	return Default.VerifyKeys(name)
+}
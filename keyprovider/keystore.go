@@ -0,0 +1,255 @@
+package keyprovider
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"hufu/kms"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// DefaultPassphraseEnv 保存密钥库口令的环境变量
+	DefaultPassphraseEnv = "HUFU_KEYSTORE_PASSPHRASE"
+
+	keystoreVersion = 1
+	scryptN         = 1 << 15
+	scryptR         = 8
+	scryptP         = 1
+	scryptSaltSize  = 16
+
+	// 读取密钥库时接受的 scrypt 参数范围, 防止被篡改的文件降低强度或耗尽内存
+	scryptMinN = 1 << 14
+	scryptMaxN = 1 << 20
+	scryptMaxR = 16
+	scryptMaxP = 4
+)
+
+// KeystoreFile 密钥库文件, 每个密钥名称一个文件, 包含该名称的所有版本
+type KeystoreFile struct {
+	Version int             `json:"version"`
+	Name    string          `json:"name"`
+	Keys    []KeystoreEntry `json:"keys"`
+}
+
+// KeystoreEntry 密钥库中的一个密钥版本, 退役的版本只保留公钥
+type KeystoreEntry struct {
+	KeyID     string          `json:"key_id"`
+	PublicKey string          `json:"public_key"`
+	Retired   bool            `json:"retired"`
+	Crypto    *KeystoreCrypto `json:"crypto,omitempty"`
+}
+
+// KeystoreCrypto 私钥的加密参数, 口令经 scrypt 派生出 AES-256-GCM 密钥
+type KeystoreCrypto struct {
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Ciphertext []byte `json:"ciphertext"` // nonce || 密文
+}
+
+// KeystoreSource 从加密的密钥库目录读取密钥
+type KeystoreSource struct {
+	dir        string
+	passphrase string
+}
+
+// NewKeystoreSource 创建密钥库来源, 口令从 passphraseEnv 指定的环境变量读取
+func NewKeystoreSource(dir, passphraseEnv string) (*KeystoreSource, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("keys.keystore.dir is not configured")
+	}
+	if passphraseEnv == "" {
+		passphraseEnv = DefaultPassphraseEnv
+	}
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		return nil, fmt.Errorf("keystore passphrase is not set, export %s", passphraseEnv)
+	}
+	return &KeystoreSource{dir: dir, passphrase: passphrase}, nil
+}
+
+// Keys 读取并解密名称对应的密钥文件, 文件不存在时返回空
+func (s *KeystoreSource) Keys(name string) ([]Key, error) {
+	file, err := readKeystoreFile(s.path(name))
+	if err != nil || file == nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(file.Keys))
+	for _, entry := range file.Keys {
+		key := Key{Name: name, ID: entry.KeyID, PublicKey: entry.PublicKey, Retired: entry.Retired}
+		if entry.Crypto != nil {
+			privateKey, err := decryptKeystoreEntry(entry.Crypto, s.passphrase, keystoreAAD(name, entry.KeyID))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s/%s: %v", name, entry.KeyID, err)
+			}
+			key.PrivateKey = privateKey
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Add 加入新的当前密钥, 原当前密钥转为退役并删除其私钥, 只保留公钥用于验证历史签名
+func (s *KeystoreSource) Add(name, keyID, privateKey string) (*Key, error) {
+	key := Key{Name: name, ID: keyID, PrivateKey: privateKey}
+	if err := normalizeKey(&key); err != nil {
+		return nil, err
+	}
+
+	path := s.path(name)
+	file, err := readKeystoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		file = &KeystoreFile{Version: keystoreVersion, Name: name}
+	}
+	for i := range file.Keys {
+		if file.Keys[i].KeyID == key.ID {
+			return nil, fmt.Errorf("key id %s/%s already exists", name, key.ID)
+		}
+		file.Keys[i].Retired = true
+		file.Keys[i].Crypto = nil
+	}
+
+	sealed, err := encryptKeystoreEntry(key.PrivateKey, s.passphrase, keystoreAAD(name, key.ID))
+	if err != nil {
+		return nil, err
+	}
+	file.Keys = append(file.Keys, KeystoreEntry{KeyID: key.ID, PublicKey: key.PublicKey, Crypto: sealed})
+
+	if err := writeKeystoreFile(path, file); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// AddRetired 加入只有公钥的退役密钥, 用于导入轮换前的旧公钥, 不影响当前密钥
+func (s *KeystoreSource) AddRetired(name, keyID, publicKey string) (*Key, error) {
+	key := Key{Name: name, ID: keyID, PublicKey: publicKey, Retired: true}
+	if err := normalizeKey(&key); err != nil {
+		return nil, err
+	}
+
+	path := s.path(name)
+	file, err := readKeystoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		file = &KeystoreFile{Version: keystoreVersion, Name: name}
+	}
+	for _, entry := range file.Keys {
+		if entry.KeyID == key.ID {
+			return nil, fmt.Errorf("key id %s/%s already exists", name, key.ID)
+		}
+	}
+	file.Keys = append(file.Keys, KeystoreEntry{KeyID: key.ID, PublicKey: key.PublicKey, Retired: true})
+
+	if err := writeKeystoreFile(path, file); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *KeystoreSource) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// keystoreAAD 将密文绑定到密钥名称和ID, 防止文件之间互相替换
+func keystoreAAD(name, keyID string) []byte {
+	return []byte(fmt.Sprintf("hufu-keystore:v%d:%s:%s", keystoreVersion, name, keyID))
+}
+
+func readKeystoreFile(path string) (*KeystoreFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var file KeystoreFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid keystore file %s: %v", path, err)
+	}
+	if file.Version != keystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d in %s", file.Version, path)
+	}
+	return &file, nil
+}
+
+func writeKeystoreFile(path string, file *KeystoreFile) error {
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func encryptKeystoreEntry(privateKey, passphrase string, aad []byte) (*KeystoreCrypto, error) {
+	salt := make([]byte, scryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	c := &KeystoreCrypto{KDF: "scrypt", Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+	derived, err := scrypt.Key([]byte(passphrase), c.Salt, c.N, c.R, c.P, kms.MasterKeySize)
+	if err != nil {
+		return nil, err
+	}
+	c.Ciphertext, err = kms.Seal(derived, []byte(strings.ToLower(privateKey)), aad)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkScryptParams 检查文件中的 scrypt 参数, N 必须是 2 的幂
+func checkScryptParams(c *KeystoreCrypto) error {
+	if c.N < scryptMinN || c.N > scryptMaxN || c.N&(c.N-1) != 0 {
+		return fmt.Errorf("scrypt n %d out of range", c.N)
+	}
+	if c.R < 1 || c.R > scryptMaxR {
+		return fmt.Errorf("scrypt r %d out of range", c.R)
+	}
+	if c.P < 1 || c.P > scryptMaxP {
+		return fmt.Errorf("scrypt p %d out of range", c.P)
+	}
+	if len(c.Salt) < scryptSaltSize {
+		return fmt.Errorf("scrypt salt is too short")
+	}
+	return nil
+}
+
+func decryptKeystoreEntry(c *KeystoreCrypto, passphrase string, aad []byte) (string, error) {
+	if c.KDF != "scrypt" {
+		return "", fmt.Errorf("unsupported kdf %q", c.KDF)
+	}
+	if err := checkScryptParams(c); err != nil {
+		return "", err
+	}
+	derived, err := scrypt.Key([]byte(passphrase), c.Salt, c.N, c.R, c.P, kms.MasterKeySize)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := kms.Open(derived, c.Ciphertext, aad)
+	if err != nil {
+		return "", fmt.Errorf("wrong passphrase or corrupted keystore")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hufu/keyprovider"
+	"hufu/utils"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// legacyTeeKeys 旧版 config.yaml 中 tee 段落的签名密钥配置
+type legacyTeeKeys struct {
+	Tee struct {
+		KeyID        string `yaml:"key_id"`
+		PrivateKey   string `yaml:"private_key"`
+		PublicKey    string `yaml:"public_key"`
+		PreviousKeys []struct {
+			KeyID     string `yaml:"key_id"`
+			PublicKey string `yaml:"public_key"`
+		} `yaml:"previous_keys"`
+	} `yaml:"tee"`
+}
+
+// readSecret 从文件读取私钥, 路径为 - 时从标准输入读取, 避免私钥出现在命令行参数中
+func readSecret(path string) (string, error) {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// importLegacyTeeKeys 将旧版配置中的 tee 签名密钥导入密钥库, 保留原密钥ID, previous_keys 导入为只有公钥的退役密钥
+func importLegacyTeeKeys(store *keyprovider.KeystoreSource, configPath string) error {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	var legacy legacyTeeKeys
+	if err := yaml.Unmarshal(content, &legacy); err != nil {
+		return fmt.Errorf("invalid config %s: %v", configPath, err)
+	}
+	if legacy.Tee.PrivateKey == "" {
+		return fmt.Errorf("%s has no tee.private_key", configPath)
+	}
+
+	// 导入会把旧密钥设为当前密钥, 已有的密钥不能被覆盖
+	existing, err := store.Keys(keyprovider.NameTeeSigning)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("keystore already has %s keys, import before running keystore init", keyprovider.NameTeeSigning)
+	}
+
+	for _, previous := range legacy.Tee.PreviousKeys {
+		key, err := store.AddRetired(keyprovider.NameTeeSigning, previous.KeyID, previous.PublicKey)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%s\tretired\t%s\n", keyprovider.NameTeeSigning, key.ID, key.PublicKey)
+	}
+	key, err := store.Add(keyprovider.NameTeeSigning, legacy.Tee.KeyID, legacy.Tee.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if legacy.Tee.PublicKey != "" && !strings.EqualFold(strings.TrimPrefix(legacy.Tee.PublicKey, "0x"), key.PublicKey) {
+		log.Printf("warning: tee.public_key in %s does not match tee.private_key, using the derived public key", configPath)
+	}
+	fmt.Printf("%s\t%s\tcurrent\t%s\n", keyprovider.NameTeeSigning, key.ID, key.PublicKey)
+	return nil
+}
+
+// runKeystore 管理加密密钥库
+//
+//	keystore init    为缺少的密钥名称生成密钥
+//	keystore add     加入新版本, 原版本转为退役
+//	keystore import  导入旧版 config.yaml 中的 tee 签名密钥和 previous_keys
+//	keystore list    列出所有密钥版本
+func runKeystore(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: keystore <init|add|import|list> [flags]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("keystore "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", "config/keystore", "keystore directory")
+	passphraseEnv := fs.String("passphrase-env", keyprovider.DefaultPassphraseEnv, "environment variable holding the passphrase")
+	name := fs.String("name", "", "key name (add)")
+	keyID := fs.String("key-id", "", "key id, derived from the public key when empty (add)")
+	privateKeyFile := fs.String("private-key-file", "", "file holding the hex private key, - for stdin, generated when empty (add)")
+	legacyConfig := fs.String("config", "", "legacy config.yaml with tee.private_key and tee.previous_keys (import)")
+	fs.Parse(args[1:])
+
+	store, err := keyprovider.NewKeystoreSource(*dir, *passphraseEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	names := append(keyprovider.RequiredNames(), keyprovider.OptionalNames()...)
+
+	switch args[0] {
+	case "init":
+		for _, n := range names {
+			keys, err := store.Keys(n)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(keys) > 0 {
+				continue
+			}
+			generated, _, _ := utils.GenerateKeys()
+			key, err := store.Add(n, "", generated)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s\t%s\t%s\n", n, key.ID, key.PublicKey)
+		}
+	case "add":
+		if *name == "" {
+			log.Fatal("-name is required")
+		}
+		var privateKey string
+		if *privateKeyFile != "" {
+			privateKey, err = readSecret(*privateKeyFile)
+			if err != nil {
+				log.Fatalf("failed to read private key: %v", err)
+			}
+			if privateKey == "" {
+				log.Fatal("private key file is empty")
+			}
+		} else {
+			privateKey, _, _ = utils.GenerateKeys()
+		}
+		key, err := store.Add(*name, *keyID, privateKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\t%s\t%s\n", *name, key.ID, key.PublicKey)
+	case "import":
+		if *legacyConfig == "" {
+			log.Fatal("-config is required")
+		}
+		if err := importLegacyTeeKeys(store, *legacyConfig); err != nil {
+			log.Fatal(err)
+		}
+	case "list":
+		for _, n := range names {
+			keys, err := store.Keys(n)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, key := range keys {
+				state := "current"
+				if key.Retired {
+					state = "retired"
+				}
+				fmt.Printf("%s\t%s\t%s\t%s\n", n, key.ID, state, key.PublicKey)
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown keystore command %q\n", args[0])
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,127 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultEmulatorTimeout = 10 * time.Second
+
+// EmulatorProvider 访问本地 KMS 模拟服务, 接口与云 KMS 的 Encrypt/Decrypt 一致, 仅用于开发和测试
+type EmulatorProvider struct {
+	baseURL    string
+	keyID      string
+	httpClient *http.Client
+}
+
+// EmulatorKeyResponse /v1/key 的响应
+type EmulatorKeyResponse struct {
+	KeyID string `json:"key_id"`
+}
+
+// EmulatorRequest /v1/encrypt 和 /v1/decrypt 的请求, 二进制字段为 base64
+type EmulatorRequest struct {
+	KeyID      string `json:"key_id"`
+	Plaintext  []byte `json:"plaintext,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+	AAD        []byte `json:"aad,omitempty"`
+}
+
+// EmulatorResponse /v1/encrypt 和 /v1/decrypt 的响应
+type EmulatorResponse struct {
+	KeyID      string `json:"key_id"`
+	Plaintext  []byte `json:"plaintext,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewEmulatorProvider 创建模拟服务客户端, 未配置密钥ID时使用服务的当前主密钥
+func NewEmulatorProvider(baseURL, keyID string, timeoutSeconds int) (*EmulatorProvider, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("kms emulator url is not configured")
+	}
+	timeout := defaultEmulatorTimeout
+	if timeoutSeconds > 0 {
+		timeout = time.Duration(timeoutSeconds) * time.Second
+	}
+	p := &EmulatorProvider{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		keyID:      keyID,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+
+	if p.keyID == "" {
+		var key EmulatorKeyResponse
+		if err := p.post(context.Background(), "/v1/key", struct{}{}, &key); err != nil {
+			return nil, err
+		}
+		if key.KeyID == "" {
+			return nil, fmt.Errorf("kms emulator returned empty key id")
+		}
+		p.keyID = key.KeyID
+	}
+	return p, nil
+}
+
+// KeyID 主密钥ID
+func (p *EmulatorProvider) KeyID() string {
+	return p.keyID
+}
+
+// Encrypt 由模拟服务使用主密钥加密
+func (p *EmulatorProvider) Encrypt(ctx context.Context, plaintext, aad []byte) ([]byte, error) {
+	var resp EmulatorResponse
+	if err := p.post(ctx, "/v1/encrypt", &EmulatorRequest{KeyID: p.keyID, Plaintext: plaintext, AAD: aad}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Ciphertext, nil
+}
+
+// Decrypt 由模拟服务使用主密钥解密
+func (p *EmulatorProvider) Decrypt(ctx context.Context, ciphertext, aad []byte) ([]byte, error) {
+	var resp EmulatorResponse
+	if err := p.post(ctx, "/v1/decrypt", &EmulatorRequest{KeyID: p.keyID, Ciphertext: ciphertext, AAD: aad}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+func (p *EmulatorProvider) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms emulator %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("kms emulator %s: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure EmulatorResponse
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("kms emulator %s: %s", path, failure.Error)
+		}
+		return fmt.Errorf("kms emulator %s: status %d", path, resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("kms emulator %s: invalid response: %v", path, err)
+	}
+	return nil
+}
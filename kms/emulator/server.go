@@ -0,0 +1,98 @@
+package emulator
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hufu/kms"
+	"net/http"
+)
+
+// Server 本地 KMS 模拟服务, 主密钥只保存在内存中
+// 指定种子时主密钥由种子推导, 重启后仍能解密之前的数据
+type Server struct {
+	keyID string
+	key   []byte
+}
+
+// NewServer 创建模拟服务, seed 为空时随机生成主密钥
+func NewServer(seed string) (*Server, error) {
+	key := make([]byte, kms.MasterKeySize)
+	if seed != "" {
+		sum := sha256.Sum256([]byte("hufu-kms-emulator\x00" + seed))
+		copy(key, sum[:])
+	} else if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(key)
+	return &Server{keyID: "emulator-" + hex.EncodeToString(id[:8]), key: key}, nil
+}
+
+// KeyID 当前主密钥ID
+func (s *Server) KeyID() string {
+	return s.keyID
+}
+
+// Handler 返回模拟服务的路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/key", s.handleKey)
+	mux.HandleFunc("/v1/encrypt", s.handleEncrypt)
+	mux.HandleFunc("/v1/decrypt", s.handleDecrypt)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) handleKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &kms.EmulatorKeyResponse{KeyID: s.keyID})
+}
+
+// decodeRequest 解析请求并检查密钥ID, 失败时已写入响应
+func (s *Server) decodeRequest(w http.ResponseWriter, r *http.Request) (*kms.EmulatorRequest, bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, &kms.EmulatorResponse{Error: "method not allowed"})
+		return nil, false
+	}
+	var req kms.EmulatorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, &kms.EmulatorResponse{Error: "invalid request"})
+		return nil, false
+	}
+	if req.KeyID != s.keyID {
+		writeJSON(w, http.StatusNotFound, &kms.EmulatorResponse{Error: "unknown key " + req.KeyID})
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Server) handleEncrypt(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.decodeRequest(w, r)
+	if !ok {
+		return
+	}
+	ciphertext, err := kms.Seal(s.key, req.Plaintext, req.AAD)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, &kms.EmulatorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, &kms.EmulatorResponse{KeyID: s.keyID, Ciphertext: ciphertext})
+}
+
+func (s *Server) handleDecrypt(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.decodeRequest(w, r)
+	if !ok {
+		return
+	}
+	plaintext, err := kms.Open(s.key, req.Ciphertext, req.AAD)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, &kms.EmulatorResponse{Error: "decryption failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, &kms.EmulatorResponse{KeyID: s.keyID, Plaintext: plaintext})
+}
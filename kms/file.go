@@ -0,0 +1,49 @@
+package kms
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileProvider 从本地文件读取主密钥, 适合单机部署, 文件权限应限制为服务账号只读
+type FileProvider struct {
+	keyID string
+	key   []byte
+}
+
+// NewFileProvider 读取保存 32 字节 hex 主密钥的文件, 可用 openssl rand -hex 32 生成
+func NewFileProvider(path, keyID string) (*FileProvider, error) {
+	if path == "" {
+		return nil, fmt.Errorf("kms key_file is not configured")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kms key file: %v", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != MasterKeySize {
+		return nil, fmt.Errorf("kms key file must contain %d bytes of hex", MasterKeySize)
+	}
+	if keyID == "" {
+		keyID = deriveKeyID(key)
+	}
+	return &FileProvider{keyID: keyID, key: key}, nil
+}
+
+// KeyID 主密钥ID
+func (p *FileProvider) KeyID() string {
+	return p.keyID
+}
+
+// Encrypt 使用主密钥加密
+func (p *FileProvider) Encrypt(_ context.Context, plaintext, aad []byte) ([]byte, error) {
+	return Seal(p.key, plaintext, aad)
+}
+
+// Decrypt 使用主密钥解密
+func (p *FileProvider) Decrypt(_ context.Context, ciphertext, aad []byte) ([]byte, error) {
+	return Open(p.key, ciphertext, aad)
+}
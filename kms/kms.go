@@ -0,0 +1,114 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hufu/config"
+)
+
+// 主密钥提供方
+const (
+	ProviderFile     = "file"
+	ProviderPKCS11   = "pkcs11"
+	ProviderEmulator = "emulator"
+)
+
+const keyIDSize = 8
+
+// Provider 持有主密钥的 KMS, 只用来加解密数据密钥, 主密钥本身不离开提供方
+// aad 与密文绑定, 解密时必须提供相同的值
+type Provider interface {
+	KeyID() string
+	Encrypt(ctx context.Context, plaintext, aad []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext, aad []byte) ([]byte, error)
+}
+
+// Default 全局主密钥提供方, 由 Init 初始化
+var Default Provider
+
+// retired 轮换前的主密钥, 按密钥ID索引, 只用于解密
+var retired = map[string]Provider{}
+
+// Init 根据配置初始化全局主密钥提供方和已轮换的主密钥, 并各做一次加解密自检
+func Init(cfg config.KMSConfig) error {
+	provider, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	if err := SelfCheck(context.Background(), provider); err != nil {
+		return err
+	}
+
+	retiredProviders := make(map[string]Provider, len(cfg.Retired))
+	for _, retiredCfg := range cfg.Retired {
+		p, err := New(retiredCfg)
+		if err != nil {
+			return fmt.Errorf("retired kms key: %v", err)
+		}
+		if p.KeyID() == provider.KeyID() {
+			return fmt.Errorf("retired kms key %s is the current key", p.KeyID())
+		}
+		if err := SelfCheck(context.Background(), p); err != nil {
+			return err
+		}
+		retiredProviders[p.KeyID()] = p
+	}
+
+	Default = provider
+	retired = retiredProviders
+	return nil
+}
+
+// ForKeyID 返回能解密该主密钥ID所封装数据的提供方, 当前主密钥或已轮换的主密钥
+func ForKeyID(keyID string) (Provider, bool) {
+	if Default != nil && Default.KeyID() == keyID {
+		return Default, true
+	}
+	p, ok := retired[keyID]
+	return p, ok
+}
+
+// SelfCheck 加密再解密一段随机数据, 确认主密钥可用
+func SelfCheck(ctx context.Context, provider Provider) error {
+	probe := make([]byte, 16)
+	if _, err := rand.Read(probe); err != nil {
+		return err
+	}
+	aad := []byte("hufu-kms-self-check")
+	ciphertext, err := provider.Encrypt(ctx, probe, aad)
+	if err != nil {
+		return fmt.Errorf("kms %s self check failed: %v", provider.KeyID(), err)
+	}
+	plaintext, err := provider.Decrypt(ctx, ciphertext, aad)
+	if err != nil {
+		return fmt.Errorf("kms %s self check failed: %v", provider.KeyID(), err)
+	}
+	if !bytes.Equal(plaintext, probe) {
+		return fmt.Errorf("kms %s self check returned wrong plaintext", provider.KeyID())
+	}
+	return nil
+}
+
+// New 根据配置创建主密钥提供方
+func New(cfg config.KMSConfig) (Provider, error) {
+	switch cfg.Provider {
+	case ProviderFile, "":
+		return NewFileProvider(cfg.KeyFile, cfg.KeyID)
+	case ProviderPKCS11:
+		return NewPKCS11Provider(cfg)
+	case ProviderEmulator:
+		return NewEmulatorProvider(cfg.Emulator.URL, cfg.KeyID, cfg.Emulator.TimeoutSeconds)
+	default:
+		return nil, fmt.Errorf("unknown kms provider %q", cfg.Provider)
+	}
+}
+
+// deriveKeyID 由主密钥推导密钥ID, 取 sha256 的前8字节
+func deriveKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:keyIDSize])
+}
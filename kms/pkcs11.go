@@ -0,0 +1,51 @@
+package kms
+
+import (
+	"context"
+	"fmt"
+	"hufu/config"
+)
+
+// PKCS11Provider 通过 PKCS#11 使用 HSM 中不可导出的主密钥
+// 当前构建没有链接 PKCS#11 库, 只校验配置, 加解密调用均返回错误
+type PKCS11Provider struct {
+	module     string
+	tokenLabel string
+	keyLabel   string
+	keyID      string
+}
+
+// ErrPKCS11Unavailable 当前构建不支持 PKCS#11
+var ErrPKCS11Unavailable = fmt.Errorf("pkcs11 kms provider is not available in this build")
+
+// NewPKCS11Provider 校验 PKCS#11 配置
+func NewPKCS11Provider(cfg config.KMSConfig) (*PKCS11Provider, error) {
+	if cfg.PKCS11.Module == "" || cfg.PKCS11.TokenLabel == "" || cfg.PKCS11.KeyLabel == "" {
+		return nil, fmt.Errorf("kms pkcs11 requires module, token_label and key_label")
+	}
+	p := &PKCS11Provider{
+		module:     cfg.PKCS11.Module,
+		tokenLabel: cfg.PKCS11.TokenLabel,
+		keyLabel:   cfg.PKCS11.KeyLabel,
+		keyID:      cfg.KeyID,
+	}
+	if p.keyID == "" {
+		p.keyID = "pkcs11:" + p.tokenLabel + "/" + p.keyLabel
+	}
+	return p, nil
+}
+
+// KeyID 主密钥ID
+func (p *PKCS11Provider) KeyID() string {
+	return p.keyID
+}
+
+// Encrypt 当前构建不支持
+func (p *PKCS11Provider) Encrypt(context.Context, []byte, []byte) ([]byte, error) {
+	return nil, ErrPKCS11Unavailable
+}
+
+// Decrypt 当前构建不支持
+func (p *PKCS11Provider) Decrypt(context.Context, []byte, []byte) ([]byte, error) {
+	return nil, ErrPKCS11Unavailable
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hufu/kms/emulator"
+	"log"
+	"net/http"
+)
+
+// runKMSEmulator 启动本地 KMS 模拟服务, 用于 custody.kms.provider = emulator
+func runKMSEmulator(args []string) {
+	fs := flag.NewFlagSet("kms-emulator", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8083", "listen address")
+	seed := fs.String("seed", "", "seed for the master key, random when empty")
+	fs.Parse(args)
+
+	server, err := emulator.NewServer(*seed)
+	if err != nil {
+		log.Fatalf("failed to start kms emulator: %v", err)
+	}
+	if *seed == "" {
+		log.Printf("no -seed given, the master key will be lost on restart")
+	}
+
+	fmt.Printf("kms emulator listening on %s\n", *addr)
+	fmt.Printf("master key id: %s\n", server.KeyID())
+	log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+}
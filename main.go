@@ -4,21 +4,65 @@ import (
 	"fmt"
 	"hufu/config"
 	"hufu/controller"
+	"hufu/keyprovider"
+	"hufu/kms"
 	"hufu/model"
 	"hufu/router"
 	"hufu/supervisor"
+	"hufu/tee"
+	"os"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "mock-tee":
+			runMockTee(os.Args[2:])
+			return
+		case "kms-emulator":
+			runKMSEmulator(os.Args[2:])
+			return
+		case "key-emulator":
+			runKeyEmulator(os.Args[2:])
+			return
+		case "keystore":
+			runKeystore(os.Args[2:])
+			return
+		}
+	}
+
 	if _, err := config.LoadConfig("config/config.yaml"); err != nil {
 		panic(fmt.Sprintf("Error loading config: %v", err))
 	}
+	if err := keyprovider.Init(config.GlobalConfig.Keys); err != nil {
+		panic(fmt.Sprintf("Error loading keys: %v", err))
+	}
 	model.SetupDB()
+	if err := kms.Init(config.GlobalConfig.Custody.KMS); err != nil {
+		panic(fmt.Sprintf("Error initializing kms: %v", err))
+	}
+	if err := controller.RunMigrations(); err != nil {
+		panic(fmt.Sprintf("Error running migrations: %v", err))
+	}
+	if err := controller.EnsureBootstrapAccount(); err != nil {
+		panic(fmt.Sprintf("Error initializing auth: %v", err))
+	}
+	controller.StartReplayCleanup()
+	controller.StartRecordReencryption()
+	controller.StartWalletKeyRewrap()
+	controller.StartWalletFreezeExpiry()
+	controller.StartPaymentExpiry()
+	controller.StartTransferScheduler()
+	if err := tee.InitClient(config.GlobalConfig.Tee.Client); err != nil {
+		panic(fmt.Sprintf("Error initializing tee client: %v", err))
+	}
 	controller.InitWalletPool()
-	supervisor.InitJury()
+	if err := supervisor.InitJury(); err != nil {
+		panic(fmt.Sprintf("Error initializing jury: %v", err))
+	}
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
@@ -32,6 +76,7 @@ func main() {
 		c.JSON(200, gin.H{"message": "pong"})
 	})
 
+	router.InitAuthRouter(r)
 	router.InitHufuRouter(r)
 	router.InitRegulatorRouter(r)
 	r.Run(":3338")
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"hufu/controller"
+	"hufu/errors"
+	"hufu/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const accountKey = "hufu.account"
+
+// abort 以 HufuError 结束请求
+func abort(c *gin.Context, status int, err *errors.HufuError) {
+	c.AbortWithStatusJSON(status, gin.H{"code": err.Code, "error": err.Message})
+}
+
+// Auth 校验 Authorization: Bearer <token>, 并将账号保存在上下文中
+func Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			abort(c, http.StatusUnauthorized, errors.ErrUnauthorized)
+			return
+		}
+
+		account, err := controller.AuthenticateToken(token)
+		if err != nil {
+			if hufuErr, ok := err.(*errors.HufuError); ok {
+				abort(c, http.StatusUnauthorized, hufuErr)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(accountKey, account)
+		c.Next()
+	}
+}
+
+// RequireRoles 只允许指定角色访问, 必须在 Auth 之后使用
+func RequireRoles(roles ...model.AccountRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account := CurrentAccount(c)
+		if account == nil {
+			abort(c, http.StatusUnauthorized, errors.ErrUnauthorized)
+			return
+		}
+		for _, role := range roles {
+			if account.Role == role {
+				c.Next()
+				return
+			}
+		}
+		abort(c, http.StatusForbidden, errors.ErrForbidden)
+	}
+}
+
+// CurrentAccount 返回当前登录的账号, 未经过 Auth 时返回 nil
+func CurrentAccount(c *gin.Context) *model.Account {
+	value, ok := c.Get(accountKey)
+	if !ok {
+		return nil
+	}
+	account, _ := value.(*model.Account)
+	return account
+}
+
+// AuthorizeWallet 检查当前账号能否操作该钱包, 不能时写入 403 并返回 false
+func AuthorizeWallet(c *gin.Context, walletID uint) bool {
+	account := CurrentAccount(c)
+	if account == nil {
+		abort(c, http.StatusUnauthorized, errors.ErrUnauthorized)
+		return false
+	}
+	if err := controller.CanAccessWallet(account, walletID); err != nil {
+		abort(c, http.StatusForbidden, errors.ErrForbidden)
+		return false
+	}
+	return true
+}
+
+// AuthorizeUser 检查当前账号能否访问该用户, 不能时写入 403 并返回 false
+func AuthorizeUser(c *gin.Context, userID uint) bool {
+	account := CurrentAccount(c)
+	if account == nil {
+		abort(c, http.StatusUnauthorized, errors.ErrUnauthorized)
+		return false
+	}
+	if err := controller.CanAccessUser(account, userID); err != nil {
+		abort(c, http.StatusForbidden, errors.ErrForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hufu/tee/mock"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// runMockTee 启动模拟 TEE 服务: go run . mock-tee -addr :8082
+// 将 config.yaml 中 tee.client 的 api_url, add_url, file_url 指向同一地址即可在本地跑通代理转账
+func runMockTee(args []string) {
+	fs := flag.NewFlagSet("mock-tee", flag.ExitOnError)
+	addr := fs.String("addr", ":8082", "listen address")
+	seed := fs.String("seed", "", "seed for deterministic keys and shuffles")
+	keyBits := fs.Int("key-bits", 0, "rsa key size")
+	proxyWallets := fs.String("proxy-wallets", "", "comma separated proxy wallet ids used by shuffle_transaction")
+	proxyCount := fs.Int("proxy-count", 0, "number of proxy wallets per shuffled transfer")
+	warnAbove := fs.Float64("warn-above", 0, "transaction_warning returns Warning above this amount")
+	failRate := fs.Float64("fail-rate", 0, "probability of returning -fail-status")
+	failStatus := fs.Int("fail-status", 0, "status code for injected failures")
+	malformedRate := fs.Float64("malformed-rate", 0, "probability of returning malformed json")
+	failPaths := fs.String("fail-paths", "", "comma separated paths to inject faults on, empty for all")
+	latency := fs.Duration("latency", 0, "added latency per request")
+	certFile := fs.String("cert", "", "tls certificate, serves https and binds it in attestation reports")
+	keyFile := fs.String("key", "", "tls private key for -cert")
+	fs.Parse(args)
+
+	cfg := mock.Config{
+		Seed:       *seed,
+		KeyBits:    *keyBits,
+		ProxyCount: *proxyCount,
+		WarnAbove:  *warnAbove,
+		Faults: mock.Faults{
+			FailRate:      *failRate,
+			FailStatus:    *failStatus,
+			MalformedRate: *malformedRate,
+			Latency:       *latency,
+		},
+	}
+	for _, id := range splitList(*proxyWallets) {
+		v, err := strconv.Atoi(id)
+		if err != nil {
+			log.Fatalf("invalid proxy wallet id %q", id)
+		}
+		cfg.ProxyWalletIDs = append(cfg.ProxyWalletIDs, v)
+	}
+	cfg.Faults.FailPaths = splitList(*failPaths)
+
+	server, err := mock.NewServer(cfg)
+	if err != nil {
+		log.Fatalf("failed to start mock tee: %v", err)
+	}
+
+	fmt.Printf("mock tee listening on %s\n", *addr)
+	fmt.Printf("enclave key %s modulus: %s\n", server.KeyID(), hex.EncodeToString(server.EnclavePublicKey().N.Bytes()))
+	fmt.Printf("attestation root_public_key: %s\n", server.RootPublicKey())
+	fmt.Printf("attestation expected_measurements: [%s]\n", server.Measurement())
+
+	if *certFile == "" {
+		log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+	}
+	// 通过 https 提供服务时, 证明报告绑定该证书, 客户端的 tls.ca_file 需信任该证书
+	cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+	if err != nil {
+		log.Fatalf("failed to load mock tee certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		log.Fatalf("failed to parse mock tee certificate: %v", err)
+	}
+	server.BindTLSCertificate(leaf)
+	log.Fatal(http.ListenAndServeTLS(*addr, *certFile, *keyFile, server.Handler()))
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
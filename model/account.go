@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccountRole 账号角色
+type AccountRole string
+
+const (
+	RoleWalletOwner AccountRole = "wallet_owner" // 钱包持有人, 只能操作自己的钱包
+	RoleOperator    AccountRole = "operator"     // 运营人员, 可以管理所有钱包和账号
+	RoleRegulator   AccountRole = "regulator"    // 监管方, 访问监管接口
+	RoleJuryAdmin   AccountRole = "jury_admin"   // 陪审团管理员, 查看决策和事件
+)
+
+// Account 登录账号
+type Account struct {
+	gorm.Model
+	Username     string      `json:"username" gorm:"type:varchar(100);not null;uniqueIndex"`
+	PasswordHash string      `json:"-" gorm:"type:varchar(100);not null"`
+	Role         AccountRole `json:"role" gorm:"type:varchar(20);not null"`
+	Disabled     bool        `json:"disabled" gorm:"not null;default:false"`
+	TokenVersion int         `json:"-" gorm:"not null;default:0"` // 注销时递增, 使已签发的令牌全部失效
+}
+
+// WalletChallenge 钱包签名认证的一次性挑战
+type WalletChallenge struct {
+	ID        uint       `json:"-" gorm:"primarykey"`
+	WalletID  uint       `json:"wallet_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"type:varchar(32);not null"`
+	Nonce     string     `json:"nonce" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
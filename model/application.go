@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ApplicationStatus 监管申请状态
+type ApplicationStatus string
+
+const (
+	ApplicationPending  ApplicationStatus = "pending"  // 已提交, 等待陪审团决策
+	ApplicationApproved ApplicationStatus = "approved" // 陪审团批准, 私钥已恢复
+	ApplicationRejected ApplicationStatus = "rejected" // 批准节点不足
+	ApplicationFailed   ApplicationStatus = "failed"   // 处理过程出错
+)
+
+// RegulatorApplication 监管机构的私钥恢复申请
+type RegulatorApplication struct {
+	gorm.Model
+	WalletID        uint                    `json:"wallet_id" gorm:"type:int;not null;index"`
+	Requester       string                  `json:"requester" gorm:"type:varchar(100);not null;default:'';index"` // 申请人
+	Status          ApplicationStatus       `json:"status" gorm:"type:varchar(20);not null;default:'pending';index"`
+	SubmittedAt     time.Time               `json:"submitted_at" gorm:"not null"`
+	DecidedAt       *time.Time              `json:"decided_at"`
+	EvidenceRef     string                  `json:"evidence_ref" gorm:"type:varchar(64);index"`           // 关联 EvidenceRecord.Ref
+	DecisionPayload string                  `json:"decision_payload" gorm:"type:varchar(255)"`            // 写入链上的证据载荷, 用于关联链上决策
+	ApprovedNodes   int                     `json:"approved_nodes"`                                       // 批准的陪审团节点数
+	FailureReason   string                  `json:"failure_reason" gorm:"type:text"`                      // 失败原因
+	LegacyFile      string                  `json:"legacy_file,omitempty" gorm:"type:varchar(255);index"` // 从旧版证据文件导入时的文件名
+	Attachments     []ApplicationAttachment `json:"attachments" gorm:"foreignKey:ApplicationID"`
+}
+
+// EvidenceBlob 内容寻址的证据附件, Hash 为内容的 sha256
+type EvidenceBlob struct {
+	gorm.Model
+	Hash        string `json:"hash" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Size        int64  `json:"size" gorm:"not null"`
+	ContentType string `json:"content_type" gorm:"type:varchar(100);not null"`
+	Path        string `json:"-" gorm:"type:varchar(255);not null"`
+}
+
+// ApplicationAttachment 申请与附件的关联
+type ApplicationAttachment struct {
+	gorm.Model
+	ApplicationID uint   `json:"application_id" gorm:"type:int;not null;index"`
+	BlobHash      string `json:"blob_hash" gorm:"type:varchar(64);not null;index"`
+	FileName      string `json:"file_name" gorm:"type:varchar(255)"`
+	ContentType   string `json:"content_type" gorm:"type:varchar(100)"`
+	Size          int64  `json:"size"`
+}
+
+// DataMigration 已执行的数据迁移记录
+type DataMigration struct {
+	gorm.Model
+	Name string `json:"name" gorm:"type:varchar(100);uniqueIndex;not null"`
+}
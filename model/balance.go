@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BalanceOperationType 余额操作类型
+type BalanceOperationType string
+
+const (
+	BalanceDeposit    BalanceOperationType = "deposit"    // 入金, 增加余额
+	BalanceWithdrawal BalanceOperationType = "withdrawal" // 出金, 减少余额
+	BalanceAdjustment BalanceOperationType = "adjustment" // 调账, 金额可正可负
+	BalanceReversal   BalanceOperationType = "reversal"   // 冲正, 撤销一笔已执行的操作
+
+	// 转账产生的流水, 不对应余额操作
+	LedgerTransferOut BalanceOperationType = "transfer_out"
+	LedgerTransferIn  BalanceOperationType = "transfer_in"
+)
+
+// BalanceOperationStatus 余额操作状态
+type BalanceOperationStatus string
+
+const (
+	BalancePending  BalanceOperationStatus = "pending"  // 等待另一名运营人员审批
+	BalanceApplied  BalanceOperationStatus = "applied"  // 已执行并记账
+	BalanceRejected BalanceOperationStatus = "rejected" // 审批拒绝
+	BalanceFailed   BalanceOperationStatus = "failed"   // 执行失败, 如余额不足
+)
+
+// BalanceOperation 运营人员发起的余额操作, 执行后生成一条 LedgerEntry
+type BalanceOperation struct {
+	gorm.Model
+	WalletID      uint                   `json:"wallet_id" gorm:"not null;index"`
+	Type          BalanceOperationType   `json:"type" gorm:"type:varchar(16);not null"`
+	Amount        float64                `json:"amount" gorm:"type:decimal(20,8);not null"` // 对余额的变动, 减少为负数
+	ReasonCode    string                 `json:"reason_code" gorm:"type:varchar(32);not null"`
+	Memo          string                 `json:"memo" gorm:"type:varchar(255)"`
+	ReversalOf    *uint                  `json:"reversal_of,omitempty" gorm:"index"` // 冲正的原操作ID, 每笔操作只能冲正一次
+	Status        BalanceOperationStatus `json:"status" gorm:"type:varchar(16);not null;index"`
+	RequestedBy   uint                   `json:"requested_by" gorm:"not null"` // 发起账号, 0 为系统
+	ApprovedBy    uint                   `json:"approved_by" gorm:"not null;default:0"`
+	DecidedAt     *time.Time             `json:"decided_at"`
+	FailureReason string                 `json:"failure_reason,omitempty" gorm:"type:varchar(255)"`
+}
+
+// LedgerEntry 余额流水, 只追加不修改; 余额操作和转账的每一方各一条, BalanceAfter 与钱包余额一致
+type LedgerEntry struct {
+	ID            uint                 `json:"id" gorm:"primarykey"`
+	WalletID      uint                 `json:"wallet_id" gorm:"not null;index"`
+	OperationID   *uint                `json:"operation_id,omitempty" gorm:"uniqueIndex"` // 余额操作的流水
+	TransactionID *uint                `json:"transaction_id,omitempty" gorm:"index"`     // 转账的流水
+	Type          BalanceOperationType `json:"type" gorm:"type:varchar(16);not null"`
+	Amount        float64              `json:"amount" gorm:"type:decimal(20,8);not null"`
+	BalanceAfter  float64              `json:"balance_after" gorm:"type:decimal(20,8);not null"`
+	ReasonCode    string               `json:"reason_code" gorm:"type:varchar(32);not null"` // 转账流水为交易类型
+	CreatedAt     time.Time            `json:"created_at"`
+}
@@ -28,6 +28,7 @@ func SetupDB() *gorm.DB {
 
 	// 按照依赖关系顺序进行迁移
 	err = db.AutoMigrate(
+		&User{},
 		&Wallet{},
 		&WalletKey{},
 		&Transaction{},
@@ -35,6 +36,25 @@ func SetupDB() *gorm.DB {
 		&DesensitizedTransaction{},
 		&AbnormalTransaction{},
 		&Invoice{},
+		&EvidenceRecord{},
+		&LegacyEvidenceSkip{},
+		&RegulatorApplication{},
+		&EvidenceBlob{},
+		&ApplicationAttachment{},
+		&DataMigration{},
+		&ReplayNonce{},
+		&Account{},
+		&WalletChallenge{},
+		&BalanceOperation{},
+		&LedgerEntry{},
+		&KYCSubmission{},
+		&KYCDocument{},
+		&KYCTierChange{},
+		&WalletStatusChange{},
+		&PaymentRequest{},
+		&EscrowHold{},
+		&ScheduledTransfer{},
+		&ScheduledTransferRun{},
 	)
 	if err != nil {
 		panic("failed to auto migrate: " + err.Error())
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EvidenceRecord 链下证据存储, 链上只保存加盐哈希承诺
+type EvidenceRecord struct {
+	gorm.Model
+	Ref        string `json:"ref" gorm:"type:varchar(64);uniqueIndex;not null"` // 证据引用编号, 随承诺一起上链
+	WalletID   uint   `json:"wallet_id" gorm:"type:int;not null;index"`
+	Content    string `json:"-" gorm:"type:text;not null"`                 // 证据原文, 仅链下保存
+	Salt       string `json:"-" gorm:"type:varchar(64);not null"`          // 承诺盐值
+	Commitment string `json:"commitment" gorm:"type:varchar(64);not null"` // sha256(盐值 || 证据原文)
+}
+
+// LegacyEvidenceSkip 迁移时未能导入的旧版证据文件, 每次启动重新导入时重建
+// 运营人员修正或移走文件后重启即可, 全部处理完之前迁移不会标记为完成
+type LegacyEvidenceSkip struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	FileName  string    `json:"file_name" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Reason    string    `json:"reason" gorm:"type:varchar(255);not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EvidenceSchemaV1 当前证据文档版本
+const EvidenceSchemaV1 = "hufu.evidence/v1"
+
+// EvidenceDocument 结构化的监管申请证据
+type EvidenceDocument struct {
+	Schema               string                `json:"schema"`                // 文档版本, 如 hufu.evidence/v1
+	WalletID             uint                  `json:"wallet_id"`             // 申请恢复私钥的钱包
+	AbnormalTransactions []EvidenceAbnormalRef `json:"abnormal_transactions"` // 引用的异常交易及 TEE 签名
+	Requester            EvidenceRequester     `json:"requester"`             // 申请人身份
+	LegalBasis           string                `json:"legal_basis"`           // 申请的法律依据
+	Legacy               bool                  `json:"legacy,omitempty"`      // 由旧版文本证据转换而来
+}
+
+// EvidenceAbnormalRef 证据中引用的异常交易
+type EvidenceAbnormalRef struct {
+	AbnormalID    uint   `json:"abnormal_id"`    // AbnormalTransaction.ID, 为 0 时按 TransactionID 查找
+	TransactionID uint   `json:"transaction_id"` // 交易ID
+	Evidence      string `json:"evidence"`       // TEE 签名的证据内容
+	Signature     string `json:"signature"`      // validateTransaction 生成的签名
+}
+
+// EvidenceRequester 申请人身份
+type EvidenceRequester struct {
+	Name         string `json:"name"`
+	Organization string `json:"organization"`
+	ID           string `json:"id"` // 证件或工号
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// KYC 文档类型
+const (
+	KYCDocIDCard          = "id_card"
+	KYCDocPassport        = "passport"
+	KYCDocProofOfAddress  = "proof_of_address"
+	KYCDocBusinessLicense = "business_license"
+	KYCDocOther           = "other"
+)
+
+// KYCSubmission 用户提交的身份核验申请, 由运营人员审核
+type KYCSubmission struct {
+	gorm.Model
+	UserID        uint          `json:"user_id" gorm:"not null;index"`
+	RequestedTier int           `json:"requested_tier" gorm:"not null"`
+	Status        KYCStatus     `json:"status" gorm:"type:varchar(16);not null;index"` // pending, verified, rejected
+	SubmittedBy   uint          `json:"submitted_by" gorm:"not null"`                  // 提交账号
+	ReviewedBy    uint          `json:"reviewed_by" gorm:"not null;default:0"`
+	ReviewedAt    *time.Time    `json:"reviewed_at"`
+	GrantedTier   *int          `json:"granted_tier"` // 审核通过时授予的等级, 可以低于申请的等级
+	ReviewNote    string        `json:"review_note" gorm:"type:varchar(255)"`
+	Documents     []KYCDocument `json:"documents" gorm:"foreignKey:SubmissionID"`
+}
+
+// KYCDocument 核验文档, 内容保存在附件存储中
+type KYCDocument struct {
+	gorm.Model
+	SubmissionID uint   `json:"submission_id" gorm:"not null;index"`
+	DocType      string `json:"doc_type" gorm:"type:varchar(32);not null"`
+	BlobHash     string `json:"blob_hash" gorm:"type:varchar(64);not null;index"`
+	FileName     string `json:"file_name" gorm:"type:varchar(255)"`
+	ContentType  string `json:"content_type" gorm:"type:varchar(100)"`
+	Size         int64  `json:"size"`
+}
+
+// KYCTierChange KYC 等级和状态变更的审计日志, 只追加不修改
+// WalletID 不为0时为钱包级别的等级覆盖
+type KYCTierChange struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	UserID       uint      `json:"user_id" gorm:"not null;default:0;index"`
+	WalletID     uint      `json:"wallet_id" gorm:"not null;default:0;index"`
+	SubmissionID uint      `json:"submission_id" gorm:"not null;default:0"`
+	FromTier     *int      `json:"from_tier"`
+	ToTier       *int      `json:"to_tier"`
+	FromStatus   KYCStatus `json:"from_status" gorm:"type:varchar(16)"`
+	ToStatus     KYCStatus `json:"to_status" gorm:"type:varchar(16)"`
+	ActorID      uint      `json:"actor_id" gorm:"not null"` // 操作账号
+	Reason       string    `json:"reason" gorm:"type:varchar(255)"`
+	CreatedAt    time.Time `json:"created_at"`
+}
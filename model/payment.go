@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentRequestStatus 收款请求状态
+type PaymentRequestStatus string
+
+const (
+	PaymentRequestPending   PaymentRequestStatus = "pending"   // 等待付款
+	PaymentRequestPaid      PaymentRequestStatus = "paid"      // 已付款
+	PaymentRequestCancelled PaymentRequestStatus = "cancelled" // 收款方取消
+	PaymentRequestExpired   PaymentRequestStatus = "expired"   // 到期未付款
+)
+
+// PaymentRequest 收款方发起的收款请求, 付款方以普通转账支付
+type PaymentRequest struct {
+	gorm.Model
+	Ref           string               `json:"ref" gorm:"type:varchar(32);uniqueIndex;not null"` // 公开的收款请求编号, 付款方凭此查看和付款
+	PayeeWalletID uint                 `json:"payee_wallet_id" gorm:"not null;index"`
+	PayerWalletID uint                 `json:"payer_wallet_id" gorm:"not null;default:0;index"` // 指定的付款钱包, 0 表示任何钱包都可以付款; 付款后为实际付款的钱包
+	Amount        float64              `json:"amount" gorm:"type:decimal(20,8);not null"`
+	Memo          string               `json:"memo" gorm:"type:varchar(255)"`
+	Status        PaymentRequestStatus `json:"status" gorm:"type:varchar(16);not null;index"`
+	ExpiresAt     time.Time            `json:"expires_at" gorm:"not null;index"`
+	CreatedBy     uint                 `json:"created_by" gorm:"not null"` // 发起账号
+	TransactionID uint                 `json:"transaction_id" gorm:"not null;default:0"`
+	PaidAt        *time.Time           `json:"paid_at"`
+}
+
+// EscrowStatus 担保状态, held 之外的状态都是终态
+type EscrowStatus string
+
+const (
+	EscrowHeld     EscrowStatus = "held"     // 资金冻结在付款钱包中
+	EscrowReleased EscrowStatus = "released" // 已释放给收款方
+	EscrowRefunded EscrowStatus = "refunded" // 已退回付款方
+	EscrowExpired  EscrowStatus = "expired"  // 到期未释放, 自动退回付款方
+)
+
+// EscrowHold 担保, 冻结付款钱包的部分余额, 释放时转给收款方
+type EscrowHold struct {
+	gorm.Model
+	PayerWalletID uint         `json:"payer_wallet_id" gorm:"not null;index"`
+	PayeeWalletID uint         `json:"payee_wallet_id" gorm:"not null;index"`
+	Amount        float64      `json:"amount" gorm:"type:decimal(20,8);not null"`
+	Memo          string       `json:"memo" gorm:"type:varchar(255)"`
+	Status        EscrowStatus `json:"status" gorm:"type:varchar(16);not null;index"`
+	ExpiresAt     time.Time    `json:"expires_at" gorm:"not null;index"`
+	CreatedBy     uint         `json:"created_by" gorm:"not null"`
+	DecidedBy     uint         `json:"decided_by" gorm:"not null;default:0"` // 释放或退回的账号, 0 为到期自动退回
+	DecidedAt     *time.Time   `json:"decided_at"`
+	TransactionID uint         `json:"transaction_id" gorm:"not null;default:0"` // 释放时生成的交易
+}
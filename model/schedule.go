@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScheduleStatus 计划转账状态
+type ScheduleStatus string
+
+const (
+	ScheduleActive    ScheduleStatus = "active"    // 等待执行
+	SchedulePaused    ScheduleStatus = "paused"    // 已暂停, 恢复后从下一个执行时间继续
+	ScheduleCancelled ScheduleStatus = "cancelled" // 已取消
+	ScheduleCompleted ScheduleStatus = "completed" // 一次性计划执行成功, 或周期计划到达截止时间
+	ScheduleFailed    ScheduleStatus = "failed"    // 一次性计划执行失败, 或钱包已注销无法继续
+)
+
+// 计划转账走的转账流程
+const (
+	ScheduleModeNormal = "normal" // 普通转账
+	ScheduleModeProxy  = "proxy"  // 经过代理钱包, 执行监管规则检查
+)
+
+// ScheduledTransfer 计划转账, RunAt 不为空时为一次性计划, 否则按 CronExpr 周期执行
+type ScheduledTransfer struct {
+	gorm.Model
+	FromWalletID uint           `json:"from_wallet_id" gorm:"not null;index"`
+	ToWalletID   uint           `json:"to_wallet_id" gorm:"not null;index"`
+	Amount       float64        `json:"amount" gorm:"type:decimal(20,8);not null"`
+	Mode         string         `json:"mode" gorm:"type:varchar(16);not null"`
+	Memo         string         `json:"memo" gorm:"type:varchar(255)"`
+	RunAt        *time.Time     `json:"run_at"`                        // 一次性计划的执行时间
+	CronExpr     string         `json:"cron" gorm:"type:varchar(100)"` // 周期计划的 cron 表达式, 按服务器时区计算
+	EndAt        *time.Time     `json:"end_at"`                        // 周期计划的截止时间, 为空表示不截止
+	Status       ScheduleStatus `json:"status" gorm:"type:varchar(16);not null;index"`
+	NextRunAt    *time.Time     `json:"next_run_at" gorm:"index"`            // 下一次执行的计划时间, 与计划ID一起作为执行记录的幂等键
+	RetryAt      *time.Time     `json:"retry_at" gorm:"index"`               // 余额不足时下一次重试的时间
+	Attempts     int            `json:"attempts" gorm:"not null;default:0"`  // 本次执行已尝试的次数
+	RunCount     int            `json:"run_count" gorm:"not null;default:0"` // 成功执行的次数
+	LastRunAt    *time.Time     `json:"last_run_at"`
+	LastError    string         `json:"last_error" gorm:"type:varchar(255)"`
+	CreatedBy    uint           `json:"created_by" gorm:"not null"` // 创建账号
+	Signature    string         `json:"-" gorm:"type:text"`         // 发起钱包对计划的签名, 见 controller.ScheduleSigningMessage
+}
+
+// ScheduleRunStatus 计划转账单次执行的状态
+type ScheduleRunStatus string
+
+const (
+	ScheduleRunSucceeded ScheduleRunStatus = "succeeded"
+	ScheduleRunRetrying  ScheduleRunStatus = "retrying" // 余额不足, 等待重试
+	ScheduleRunFailed    ScheduleRunStatus = "failed"
+)
+
+// ScheduledTransferRun 计划转账的执行记录, 每个计划的每个执行时间只有一条
+// 转账与执行记录在同一事务中提交, 调度器重复处理同一执行时间时不会重复转账
+type ScheduledTransferRun struct {
+	ID            uint              `json:"id" gorm:"primarykey"`
+	ScheduleID    uint              `json:"schedule_id" gorm:"not null;uniqueIndex:idx_schedule_occurrence"`
+	ScheduledFor  time.Time         `json:"scheduled_for" gorm:"not null;uniqueIndex:idx_schedule_occurrence"`
+	Status        ScheduleRunStatus `json:"status" gorm:"type:varchar(16);not null"`
+	Attempts      int               `json:"attempts" gorm:"not null"`
+	TransactionID uint              `json:"transaction_id" gorm:"not null;default:0"`
+	Error         string            `json:"error" gorm:"type:varchar(255)"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
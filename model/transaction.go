@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -11,6 +13,8 @@ const (
 	DirectTransaction    TransactionType = "direct"     // 直接交易
 	ToProxyTransaction   TransactionType = "to_proxy"   // 转入代理钱包
 	FromProxyTransaction TransactionType = "from_proxy" // 代理钱包转出
+	SweepTransaction     TransactionType = "sweep"      // 注销钱包时转出余额
+	EscrowTransaction    TransactionType = "escrow"     // 担保释放给收款方
 )
 
 // Transaction 交易记录
@@ -23,13 +27,37 @@ type Transaction struct {
 	Type         TransactionType `json:"type" gorm:"type:varchar(20);not null"`                     // direct, proxy, mixed
 }
 
+// 加密交易记录格式版本
+const (
+	EncryptedRecordLegacy = 1 // 各字段分别以 RSA PKCS#1 v1.5 加密
+	EncryptedRecordV2     = 2 // RSA-OAEP 封装数据密钥, AES-GCM 加密 JSON 记录
+)
+
+// RecordViewRole 加密交易副本的持有方
+type RecordViewRole string
+
+const (
+	RecordViewSender    RecordViewRole = "sender"    // 发起方副本
+	RecordViewReceiver  RecordViewRole = "receiver"  // 接收方副本
+	RecordViewRegulator RecordViewRole = "regulator" // 监管托管副本, 不属于任何钱包
+)
+
 // EncryptedTransaction 加密交易
+// 版本 1 使用 Encrypted* 字段, 版本 2 使用 WrappedKey, Nonce 和 Ciphertext
+// 发起方, 接收方和监管方各持有一份以自己密钥加密的副本, OwnerWalletID 为副本所属钱包
 type EncryptedTransaction struct {
 	gorm.Model
-	TransactionID         uint   `json:"transaction_id" gorm:"type:int;not null"`
-	EncryptedFromWalletID string `json:"encrypted_from_wallet_id"`
-	EncryptedToWalletID   string `json:"encrypted_to_wallet_id"`
-	EncryptedAmount       string `json:"encrypted_amount"`
+	TransactionID         uint           `json:"transaction_id" gorm:"type:int;not null;index"`
+	OwnerWalletID         uint           `json:"owner_wallet_id" gorm:"not null;default:0;index"`
+	Role                  RecordViewRole `json:"role" gorm:"type:varchar(16);not null;default:''"`
+	KeyRef                string         `json:"key_ref" gorm:"type:varchar(64)"` // 加密副本所用的密钥, wallet:<钱包ID>:<密钥ID> 或 regulator:<密钥ID>
+	Version               int            `json:"version" gorm:"not null;default:1"`
+	EncryptedFromWalletID string         `json:"encrypted_from_wallet_id,omitempty"`
+	EncryptedToWalletID   string         `json:"encrypted_to_wallet_id,omitempty"`
+	EncryptedAmount       string         `json:"encrypted_amount,omitempty"`
+	WrappedKey            string         `json:"wrapped_key,omitempty" gorm:"type:text"`  // RSA-OAEP 封装的数据密钥, hex
+	Nonce                 string         `json:"nonce,omitempty" gorm:"type:varchar(32)"` // AES-GCM nonce, hex
+	Ciphertext            string         `json:"ciphertext,omitempty" gorm:"type:text"`   // AES-GCM 密文, hex
 }
 
 // DesensitizedTransaction 脱敏交易
@@ -49,4 +77,14 @@ type AbnormalTransaction struct {
 	TransactionID uint   `json:"transaction_id" gorm:"type:int;not null"`
 	Evidence      string `json:"evidence" gorm:"type:text;not null"`  // 证据内容
 	Signature     string `json:"signature" gorm:"type:text;not null"` // 监管者签名
+	KeyID         string `json:"key_id" gorm:"type:varchar(64)"`      // 签名密钥ID, 为空表示旧版文本证据
+}
+
+// ReplayNonce 已使用的转账信封随机数, 过期后由定时任务清理
+type ReplayNonce struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Sender    uint64    `json:"sender" gorm:"not null;uniqueIndex:idx_replay_sender_nonce"`
+	Nonce     string    `json:"nonce" gorm:"type:varchar(64);not null;uniqueIndex:idx_replay_sender_nonce"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,27 @@
+package model
+
+import "gorm.io/gorm"
+
+// KYCStatus 用户的身份核验状态
+type KYCStatus string
+
+const (
+	KYCUnverified KYCStatus = "unverified" // 未提交核验
+	KYCPending    KYCStatus = "pending"    // 已提交, 等待审核
+	KYCVerified   KYCStatus = "verified"   // 审核通过
+	KYCRejected   KYCStatus = "rejected"   // 审核拒绝
+)
+
+// User 钱包用户, 一个用户可以持有多个钱包
+// AccountID 为用户的登录账号, 运营人员代建且尚未绑定登录账号的用户为空
+type User struct {
+	gorm.Model
+	UID         string    `json:"uid" gorm:"type:varchar(32);not null;uniqueIndex"`       // 对外公开的用户标识
+	Username    string    `json:"username" gorm:"type:varchar(100);not null;uniqueIndex"` // 用户名, 对应钱包的 user_name
+	AccountID   *uint     `json:"account_id" gorm:"uniqueIndex"`
+	DisplayName string    `json:"display_name" gorm:"type:varchar(100)"`
+	Email       string    `json:"email" gorm:"type:varchar(255)"`
+	Phone       string    `json:"phone" gorm:"type:varchar(32)"`
+	KYCStatus   KYCStatus `json:"kyc_status" gorm:"type:varchar(16);not null;default:'unverified'"`
+	KYCTier     int       `json:"kyc_tier" gorm:"not null;default:0"` // 审核通过的等级, 仅在 verified 状态下生效
+}
@@ -1,19 +1,87 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Wallet 钱包
 type Wallet struct {
 	gorm.Model
-	Username   string  `json:"user_name" gorm:"type:varchar(100);not null"`   // 用户名
-	WalletName string  `json:"wallet_name" gorm:"type:varchar(100);not null"` // 钱包名称
-	Balance    float64 `json:"balance" gorm:"type:decimal(20,8);default:0"`   // 余额
+	AccountID   uint         `json:"account_id" gorm:"not null;default:0;index"`                // 所属账号, 0 为系统钱包(如代理钱包)或尚未绑定登录账号的用户的钱包
+	UserID      uint         `json:"user_id" gorm:"not null;default:0;index"`                   // 所属用户, 0 为系统钱包
+	Username    string       `json:"user_name" gorm:"type:varchar(100);not null"`               // 用户名, 与所属用户的用户名一致
+	WalletName  string       `json:"wallet_name" gorm:"type:varchar(100);not null"`             // 钱包名称
+	Balance     float64      `json:"balance" gorm:"type:decimal(20,8);default:0"`               // 余额, 包含担保冻结的部分
+	HeldBalance float64      `json:"held_balance" gorm:"type:decimal(20,8);not null;default:0"` // 担保冻结的余额, 不能转出
+	KYCTier     *int         `json:"kyc_tier"`                                                  // 钱包级别的 KYC 等级覆盖, 为空时使用所属用户的等级
+	Status      WalletStatus `json:"status" gorm:"type:varchar(16);not null;default:'active';index"`
+	FrozenUntil *time.Time   `json:"frozen_until"` // 冻结到期时间, 为空表示冻结到人工解冻为止
+}
+
+// AvailableBalance 可用余额, 即余额减去担保冻结的部分
+func (w *Wallet) AvailableBalance() float64 {
+	return w.Balance - w.HeldBalance
 }
 
+// MarshalJSON 输出时附带可用余额
+func (w Wallet) MarshalJSON() ([]byte, error) {
+	type wallet Wallet
+	return json.Marshal(struct {
+		wallet
+		AvailableBalance float64 `json:"available_balance"`
+	}{wallet(w), w.AvailableBalance()})
+}
+
+// WalletStatus 钱包状态
+type WalletStatus string
+
+const (
+	WalletActive  WalletStatus = "active"  // 正常
+	WalletFrozen  WalletStatus = "frozen"  // 冻结, 不能转出, 可以收款
+	WalletClosing WalletStatus = "closing" // 注销中, 余额转出后关闭, 不能收付款
+	WalletClosed  WalletStatus = "closed"  // 已注销
+)
+
+// 钱包状态变更的来源
+const (
+	WalletStatusByOperator = "operator" // 运营人员操作
+	WalletStatusByRule     = "rule"     // 异常交易次数达到规则阈值
+	WalletStatusByJury     = "jury"     // 陪审团批准的监管申请
+	WalletStatusByExpiry   = "expiry"   // 冻结到期自动解冻
+)
+
+// WalletStatusChange 钱包状态变更日志, 只追加不修改
+type WalletStatusChange struct {
+	ID            uint         `json:"id" gorm:"primarykey"`
+	WalletID      uint         `json:"wallet_id" gorm:"not null;index"`
+	FromStatus    WalletStatus `json:"from_status" gorm:"type:varchar(16);not null"`
+	ToStatus      WalletStatus `json:"to_status" gorm:"type:varchar(16);not null"`
+	Source        string       `json:"source" gorm:"type:varchar(16);not null"`
+	ActorID       uint         `json:"actor_id" gorm:"not null;default:0"`       // 操作账号, 0 为系统
+	ApplicationID uint         `json:"application_id" gorm:"not null;default:0"` // 触发冻结的监管申请
+	Reason        string       `json:"reason" gorm:"type:varchar(255)"`
+	ExpiresAt     *time.Time   `json:"expires_at"` // 冻结到期时间
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// 钱包私钥保管方式
+const (
+	CustodyCustodial    = "custodial"     // 服务端以 KMS 主密钥封装保存私钥
+	CustodyNonCustodial = "non_custodial" // 服务端只保存公钥, 私钥由客户端保管
+)
+
 // 钱包公私钥
+// 托管私钥以一次性数据密钥 AES-GCM 加密, 数据密钥由 KMS 主密钥封装
 type WalletKey struct {
 	gorm.Model
-	WalletID   uint   `json:"wallet_id" gorm:"type:int;not null"`
-	PublicKey  string `json:"public_key" gorm:"type:varchar(1024);not null"`
-	PrivateKey string `json:"private_key" gorm:"type:varchar(1024);not null"`
+	WalletID         uint   `json:"wallet_id" gorm:"type:int;not null"`
+	Custody          string `json:"custody" gorm:"type:varchar(16);not null;default:'custodial'"`
+	PublicKey        string `json:"public_key" gorm:"type:varchar(1024);not null"`
+	PrivateKey       string `json:"-" gorm:"type:varchar(1024);not null;default:''"` // 旧版明文私钥, 迁移后清空
+	SealedPrivateKey string `json:"-" gorm:"type:text"`                              // nonce || AES-GCM 密文, hex
+	WrappedDataKey   string `json:"-" gorm:"type:text"`                              // KMS 主密钥加密的数据密钥, hex
+	KMSKeyID         string `json:"-" gorm:"type:varchar(64)"`                       // 封装数据密钥的主密钥ID
 }
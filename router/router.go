@@ -2,29 +2,98 @@ package router
 
 import (
 	"hufu/handler"
+	"hufu/middleware"
+	"hufu/model"
 
 	"github.com/gin-gonic/gin"
 )
 
+// InitAuthRouter 登录和账号管理路由
+func InitAuthRouter(r *gin.Engine) {
+	auth := r.Group("/api/v1/auth")
+	{
+		auth.POST("/register", handler.Register) // 注册钱包持有人账号
+		auth.POST("/login", handler.Login)       // 登录
+
+		session := auth.Group("", middleware.Auth())
+		{
+			session.POST("/logout", handler.Logout)                                                              // 注销
+			session.POST("/me", handler.GetCurrentAccount)                                                       // 获取当前账号
+			session.POST("/accounts/create", middleware.RequireRoles(model.RoleOperator), handler.CreateAccount) // 创建账号
+		}
+	}
+}
+
+// InitHufuRouter 钱包持有人只能访问自己的钱包, 由各接口检查归属; 管理类接口只允许运营人员访问
 func InitHufuRouter(r *gin.Engine) {
-	hufu := r.Group("/api/v1/hufu")
+	operatorOnly := middleware.RequireRoles(model.RoleOperator)
+	walletUsers := middleware.RequireRoles(model.RoleWalletOwner, model.RoleOperator)
+
+	hufu := r.Group("/api/v1/hufu", middleware.Auth())
 	{
 		// 钱包相关路由
-		wallet := hufu.Group("/wallet")
+		wallet := hufu.Group("/wallet", walletUsers)
+		{
+			wallet.POST("/create", handler.CreateWallet)                   // 创建钱包
+			wallet.POST("/", handler.GetWallet)                            // 获取单个钱包
+			wallet.POST("/update", operatorOnly, handler.UpdateWallet)     // 更新钱包名称
+			wallet.POST("/ledger", handler.GetWalletLedger)                // 获取余额流水
+			wallet.POST("/stats", handler.GetWalletStats)                  // 获取钱包统计
+			wallet.POST("/trend", handler.GetTrend)                        // 获取收支趋势
+			wallet.POST("/challenge", handler.IssueWalletChallenge)        // 签发钱包签名认证挑战
+			wallet.POST("/freeze", operatorOnly, handler.FreezeWallet)     // 冻结钱包
+			wallet.POST("/unfreeze", operatorOnly, handler.UnfreezeWallet) // 解除冻结
+			wallet.POST("/close", operatorOnly, handler.CloseWallet)       // 注销钱包并转出余额
+			wallet.POST("/status-log", handler.ListWalletStatusChanges)    // 查询钱包状态变更日志
+		}
+
+		// 用户相关路由, 一个用户可以持有多个钱包
+		user := hufu.Group("/user", walletUsers)
+		{
+			user.POST("/create", operatorOnly, handler.CreateUser)            // 创建用户
+			user.POST("/me", handler.GetCurrentUser)                          // 获取当前账号的用户
+			user.POST("/get", handler.GetUser)                                // 获取用户
+			user.POST("/update", handler.UpdateUser)                          // 更新用户资料
+			user.POST("/link-account", operatorOnly, handler.LinkUserAccount) // 绑定登录账号
+			user.POST("/list", operatorOnly, handler.ListUsers)               // 查询用户列表
+			user.POST("/wallets", handler.GetUserWallets)                     // 获取用户的钱包和余额合计
+			user.POST("/transfer", handler.TransferBetweenUserWallets)        // 用户钱包之间转账
+		}
+
+		// 余额操作路由, 超过审批阈值的操作需要另一名运营人员审批后执行
+		balance := hufu.Group("/balance", operatorOnly)
 		{
-			wallet.POST("/create", handler.CreateWallet)  // 创建钱包
-			wallet.POST("/", handler.GetWallet)           // 获取单个钱包
-			wallet.POST("/update", handler.UpdateWallet)  // 更新钱包
-			wallet.POST("/stats", handler.GetWalletStats) // 获取钱包统计
-			wallet.POST("/trend", handler.GetTrend)       // 获取收支趋势
+			balance.POST("/deposit", handler.Deposit)                    // 入金
+			balance.POST("/withdraw", handler.Withdraw)                  // 出金
+			balance.POST("/adjust", handler.AdjustBalance)               // 调账
+			balance.POST("/reverse", handler.ReverseBalanceOperation)    // 冲正
+			balance.POST("/approve", handler.ApproveBalanceOperation)    // 审批
+			balance.POST("/reject", handler.RejectBalanceOperation)      // 拒绝
+			balance.POST("/operations", handler.ListBalanceOperations)   // 查询余额操作
+			balance.POST("/reason-codes", handler.GetBalanceReasonCodes) // 获取原因代码
+		}
+
+		// KYC 相关路由, 核验等级决定钱包适用的监管额度
+		kyc := hufu.Group("/kyc", walletUsers)
+		{
+			kyc.POST("/submit", handler.SubmitKYC)                             // 提交核验申请
+			kyc.POST("/submission", handler.GetKYCSubmission)                  // 获取核验申请
+			kyc.POST("/wallet", handler.GetWalletKYCProfile)                   // 获取钱包的 KYC 等级和额度
+			kyc.POST("/tiers", handler.GetTierPolicies)                        // 获取各等级的额度策略
+			kyc.POST("/submissions", operatorOnly, handler.ListKYCSubmissions) // 查询核验申请
+			kyc.POST("/approve", operatorOnly, handler.ApproveKYC)             // 审核通过
+			kyc.POST("/reject", operatorOnly, handler.RejectKYC)               // 审核拒绝
+			kyc.POST("/user-tier", operatorOnly, handler.SetUserKYCTier)       // 调整用户等级
+			kyc.POST("/wallet-tier", operatorOnly, handler.SetWalletKYCTier)   // 设置钱包等级覆盖
+			kyc.POST("/changes", operatorOnly, handler.ListKYCTierChanges)     // 查询等级变更日志
+			kyc.POST("/document", operatorOnly, handler.GetKYCDocument)        // 获取核验文档
 		}
 
 		// 转账相关路由
-		tx := hufu.Group("/tx")
+		tx := hufu.Group("/tx", walletUsers)
 		{
 			tx.POST("/normal-transfer", handler.NormalTransfer) // 普通转账
 			tx.POST("/proxy-transfer", handler.ProxyTransfer)   // 代理转账
-			// tx.POST("/encrypt", handler.EncryptData)            // 加密数据
 			// tx.POST("/encrypted-transfer", handler.EncryptedTransfer)    // 加密转账
 			tx.POST("/history", handler.GetTransferHistory) // 获取转账历史
 			// tx.POST("/desensitized", handler.GetDesensitizedTransaction) // 获取脱敏交易记录
@@ -32,8 +101,40 @@ func InitHufuRouter(r *gin.Engine) {
 			tx.POST("/stats", handler.GetTransactionStats)        // 添加获取收入统计路由
 		}
 
+		// 收款请求相关路由, 付款走普通转账流程
+		payment := hufu.Group("/payment", walletUsers)
+		{
+			payment.POST("/request", handler.CreatePaymentRequest) // 创建收款请求
+			payment.POST("/get", handler.GetPaymentRequest)        // 凭 ref 查看收款请求
+			payment.POST("/pay", handler.PayPaymentRequest)        // 支付收款请求
+			payment.POST("/cancel", handler.CancelPaymentRequest)  // 取消收款请求
+			payment.POST("/list", handler.ListPaymentRequests)     // 查询收款请求
+		}
+
+		// 担保相关路由
+		escrow := hufu.Group("/escrow", walletUsers)
+		{
+			escrow.POST("/create", handler.CreateEscrowHold)   // 冻结资金创建担保
+			escrow.POST("/get", handler.GetEscrowHold)         // 获取担保
+			escrow.POST("/release", handler.ReleaseEscrowHold) // 释放给收款方
+			escrow.POST("/refund", handler.RefundEscrowHold)   // 退回付款方
+			escrow.POST("/list", handler.ListEscrowHolds)      // 查询担保
+		}
+
+		// 计划转账相关路由, 到期后由后台调度任务执行
+		schedule := hufu.Group("/schedule", walletUsers)
+		{
+			schedule.POST("/create", handler.CreateScheduledTransfer) // 创建计划转账
+			schedule.POST("/get", handler.GetScheduledTransfer)       // 获取计划转账
+			schedule.POST("/pause", handler.PauseScheduledTransfer)   // 暂停
+			schedule.POST("/resume", handler.ResumeScheduledTransfer) // 恢复
+			schedule.POST("/cancel", handler.CancelScheduledTransfer) // 取消
+			schedule.POST("/list", handler.ListScheduledTransfers)    // 查询计划转账
+			schedule.POST("/runs", handler.ListScheduledTransferRuns) // 查询执行记录
+		}
+
 		// 发票相关路由
-		invoice := hufu.Group("/invoice")
+		invoice := hufu.Group("/invoice", operatorOnly)
 		{
 			invoice.POST("/create", handler.CreateInvoice)     // 创建发票
 			invoice.POST("/get", handler.GetInvoice)           // 获取单张发票
@@ -53,28 +154,40 @@ func InitHufuRouter(r *gin.Engine) {
 		}
 
 		teeHandler := handler.NewTeeHandler()
-		tee := hufu.Group("/tee")
+		tee := hufu.Group("/tee", walletUsers)
 		{
-			tee.POST("/add", teeHandler.TeeAdd)
-			tee.POST("/generate-key", teeHandler.TeeGenerateKey)
+			tee.POST("/add", operatorOnly, teeHandler.TeeAdd)
+			tee.POST("/generate-key", operatorOnly, teeHandler.TeeGenerateKey)
 			tee.POST("/encrypt-transaction", teeHandler.TeeEncrypt)
 			tee.POST("/decrypt-transaction", teeHandler.TeeDecrypt)
-			tee.POST("/shuffle", teeHandler.TeeShuffle)
-			tee.POST("/warning", teeHandler.TeeWarning)
+			tee.POST("/shuffle", operatorOnly, teeHandler.TeeShuffle)
+			tee.POST("/warning", operatorOnly, teeHandler.TeeWarning)
 			tee.POST("/encrypted-history", teeHandler.GetEncryptedHistory) // 获取加密交易记录
 			tee.POST("/decrypt-history", teeHandler.GetDecryptedHistory)   // 获取解密交易记录
 		}
 	}
 }
 
+// InitRegulatorRouter 监管接口只允许监管方访问, 决策和事件同时开放给陪审团管理员
 func InitRegulatorRouter(r *gin.Engine) {
-	regulator := r.Group("/api/v1/regulator")
+	regulatorOnly := middleware.RequireRoles(model.RoleRegulator)
+	juryReadable := middleware.RequireRoles(model.RoleRegulator, model.RoleJuryAdmin)
+
+	regulator := r.Group("/api/v1/regulator", middleware.Auth())
 	{
-		regulator.POST("/alert", handler.CheckTransaction)          // 检查交易
-		regulator.POST("/private-key", handler.GetPrivateKey)       // 获取私钥
-		regulator.POST("/application", handler.GetApplication)      // 获取申请记录
-		regulator.POST("/abnormal", handler.GetAbnormalTransaction) // 获取异常交易
-		regulator.POST("/decision", handler.GetDecision)            // 获取决策
-		regulator.POST("/event", handler.GetEvent)                  // 获取事件
+		regulator.POST("/alert", regulatorOnly, handler.CheckTransaction)                          // 检查交易
+		regulator.POST("/private-key", regulatorOnly, handler.GetPrivateKey)                       // 获取私钥
+		regulator.POST("/application", regulatorOnly, handler.GetApplication)                      // 获取申请记录
+		regulator.POST("/application/attachment", regulatorOnly, handler.GetApplicationAttachment) // 获取申请附件
+		regulator.POST("/abnormal", regulatorOnly, handler.GetAbnormalTransaction)                 // 获取异常交易
+		regulator.POST("/abnormal/verify", regulatorOnly, handler.VerifyAbnormalTransaction)       // 验证异常交易签名
+		regulator.POST("/decision", juryReadable, handler.GetDecision)                             // 获取决策
+		regulator.POST("/event", juryReadable, handler.GetEvent)                                   // 获取事件
+		regulator.POST("/evidence/verify", regulatorOnly, handler.VerifyEvidence)                  // 校验证据承诺
+		regulator.POST("/wallet/status-log", regulatorOnly, handler.ListWalletStatusChanges)       // 查询钱包状态变更日志
+		regulator.POST("/kyc", regulatorOnly, handler.GetWalletKYCProfile)                         // 获取钱包的 KYC 等级和额度
+		regulator.POST("/kyc/tiers", regulatorOnly, handler.GetTierPolicies)                       // 获取各等级的额度策略
+		regulator.POST("/kyc/changes", regulatorOnly, handler.ListKYCTierChanges)                  // 查询等级变更日志
+		regulator.POST("/kyc/document", regulatorOnly, handler.GetKYCDocument)                     // 获取核验文档
 	}
 }
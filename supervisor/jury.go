@@ -8,6 +8,7 @@ import (
 	"hufu/config"
 	"hufu/contract/Decision"
 	"hufu/contract/KeyShare"
+	"hufu/keyprovider"
 	"hufu/utils"
 	"io"
 	"log"
@@ -36,15 +37,18 @@ type Node struct {
 
 var JuryInstance *Jury
 
-func InitJury() {
-	// keys
-	juryPrivateKeys, juryPublicKeys := config.ReadJuryKeys()
-	nodes := make([]*Node, 5)
-	for i := 0; i < 5; i++ {
+// InitJury 使用密钥提供方加载的陪审团密钥创建节点, 密钥在启动时已校验
+func InitJury() error {
+	nodes := make([]*Node, utils.SHARES5)
+	for i := range nodes {
+		key, err := keyprovider.Current(keyprovider.JuryKeyName(i))
+		if err != nil {
+			return err
+		}
 		nodes[i] = &Node{
 			NodeID:     fmt.Sprintf("node%d", i),
-			PublicKey:  juryPublicKeys[i],
-			PrivateKey: juryPrivateKeys[i],
+			PublicKey:  key.PublicKey,
+			PrivateKey: key.PrivateKey,
 		}
 	}
 	JuryInstance = &Jury{
@@ -54,9 +58,10 @@ func InitJury() {
 	}
 	log.Println(JuryInstance.KeyShareContract)
 	log.Println(JuryInstance.DecisionContract)
+	return nil
 }
 
-// 处理监管机构的请求
+// 处理监管机构的请求, evidence 为证据承诺, 证据原文不会上链
 func (j *Jury) HandleRegulatoryRequest(evidence string) (map[string]bool, error) {
 	// 存储同意提供密钥的节点的密钥碎片
 	res := make(map[string]bool)
@@ -109,7 +114,7 @@ func (n *Node) EvaluateEvidence(evidence string) (bool, error) {
 	return approved, nil
 }
 
-// 记录决定到区块链
+// 记录决定到区块链, 仅写入证据承诺
 func (n *Node) RecordDecision(evidence string) error {
 	config := config.ReadConfig(n.PrivateKey)
 	client, err := client.DialContext(context.Background(), config)
@@ -199,8 +204,47 @@ func (n *Node) GetDecryptedKeyShare(id string) (string, error) {
 	return decryptedPart, nil
 }
 
+// DecisionRecord 链上决策记录, Evidence 字段为证据承诺而非证据原文
+type DecisionRecord struct {
+	Index     int64  `json:"index"`
+	Evidence  string `json:"evidence"`
+	NodeID    string `json:"node_id"`
+	Timestamp string `json:"timestamp"`
+	Approved  bool   `json:"approved"`
+}
+
 // 获取决策
 func GetDecision() ([]string, error) {
+	records, err := GetDecisionRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, len(records))
+	for i, decision := range records {
+		res[i] = decision.Evidence + "," + decision.NodeID + "," + decision.Timestamp + "," + strconv.FormatBool(decision.Approved)
+	}
+	return res, nil
+}
+
+// FindDecisionsByEvidence 查找链上与给定证据承诺匹配的决策记录
+func FindDecisionsByEvidence(evidence string) ([]DecisionRecord, error) {
+	records, err := GetDecisionRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]DecisionRecord, 0)
+	for _, record := range records {
+		if record.Evidence == evidence {
+			res = append(res, record)
+		}
+	}
+	return res, nil
+}
+
+// GetDecisionRecords 获取链上全部决策记录
+func GetDecisionRecords() ([]DecisionRecord, error) {
 	// 获取决策合约实例
 	config := config.ReadConfig(JuryInstance.Nodes[0].PrivateKey)
 	client, err := client.DialContext(context.Background(), config)
@@ -225,13 +269,19 @@ func GetDecision() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	res := make([]string, count.Int64())
+	res := make([]DecisionRecord, count.Int64())
 	for i := int64(0); i < count.Int64(); i++ {
 		decision, err := session.GetDecision(big.NewInt(i))
 		if err != nil {
 			return nil, err
 		}
-		res[i] = decision.Evidence + "," + decision.NodeID + "," + decision.Timestamp.String() + "," + strconv.FormatBool(decision.Approved)
+		res[i] = DecisionRecord{
+			Index:     i,
+			Evidence:  decision.Evidence,
+			NodeID:    decision.NodeID,
+			Timestamp: decision.Timestamp.String(),
+			Approved:  decision.Approved,
+		}
 	}
 	return res, nil
 }
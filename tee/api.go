@@ -0,0 +1,208 @@
+package tee
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hufu/errors"
+	"net/http"
+	"strings"
+)
+
+// TEE 服务返回的状态文本
+const (
+	DecryptSuccessMessage    = "Transaction decrypted successfully."
+	WalletCreatedMessage     = "wallet created successfully"
+	TransactionStatusSuccess = "Success"
+)
+
+// CreateWalletRequest create_wallet 请求
+type CreateWalletRequest struct {
+	WalletID int `json:"wallet_id"`
+}
+
+// CreateWalletResponse create_wallet 响应
+type CreateWalletResponse struct {
+	Message    string `json:"message"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+}
+
+// Transfer 明文转账信息
+type Transfer struct {
+	From   uint64  `json:"from"`
+	To     uint64  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+// DecryptResponse decrypt_transaction 响应, 请求体为 Envelope
+type DecryptResponse struct {
+	Message string          `json:"message"`
+	Data    TransferPayload `json:"data"`
+}
+
+// WarningResponse transaction_warning 响应
+type WarningResponse struct {
+	TransactionStatus string `json:"transaction_status"`
+	WarningMessage    string `json:"warning_msg"`
+}
+
+// Passed 交易是否通过 TEE 的风险检查
+func (r *WarningResponse) Passed() bool {
+	return r.TransactionStatus == TransactionStatusSuccess
+}
+
+// ShuffleResponse shuffle_transaction 响应, 键为代理钱包ID, 值为该钱包转出的金额
+type ShuffleResponse struct {
+	Data map[string]float64 `json:"data"`
+}
+
+// GetFileRequest getfile 请求
+type GetFileRequest struct {
+	ID string `json:"id"`
+}
+
+// errorBody TEE 服务出错时的响应体
+type errorBody struct {
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// teeError 在基础错误上附加细节, 保留错误码
+func teeError(base *errors.HufuError, format string, args ...interface{}) *errors.HufuError {
+	return errors.NewHufuError(base.Code, base.Message+": "+fmt.Sprintf(format, args...))
+}
+
+// statusError 将非 2xx 响应映射为错误码, 5xx 视为服务不可用, 4xx 视为请求被拒绝
+func statusError(statusCode int, body []byte) *errors.HufuError {
+	description := strings.TrimSpace(string(body))
+	var parsed errorBody
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		if parsed.Error != "" {
+			description = parsed.Error
+		} else if parsed.Message != "" {
+			description = parsed.Message
+		}
+	}
+	if description == "" {
+		description = http.StatusText(statusCode)
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		return teeError(errors.ErrTeeUnavailable, "status %d: %s", statusCode, description)
+	}
+	return teeError(errors.ErrTeeRequestRejected, "status %d: %s", statusCode, description)
+}
+
+// send 发送请求并检查状态码, 传输错误统一映射为 HufuError, idempotent 见 Post
+func (c *Client) send(ctx context.Context, service Service, path string, body []byte, contentType string, idempotent bool) ([]byte, error) {
+	respBody, statusCode, err := c.Post(ctx, service, path, body, contentType, idempotent)
+	if err != nil {
+		if hufuErr, ok := err.(*errors.HufuError); ok {
+			return nil, hufuErr
+		}
+		return nil, teeError(errors.ErrTeeUnavailable, "%v", err)
+	}
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return nil, statusError(statusCode, respBody)
+	}
+	return respBody, nil
+}
+
+// call 以 JSON 格式调用 TEE 接口并解析响应
+func (c *Client) call(ctx context.Context, service Service, path string, request, response interface{}, idempotent bool) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	respBody, err := c.send(ctx, service, path, body, "application/json", idempotent)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBody, response); err != nil {
+		return teeError(errors.ErrTeeBadResponse, "%s: %v", path, err)
+	}
+	return nil
+}
+
+// CreateWallet 在 TEE 中为钱包生成密钥对
+func (c *Client) CreateWallet(ctx context.Context, req CreateWalletRequest) (*CreateWalletResponse, error) {
+	var resp CreateWalletResponse
+	if err := c.call(ctx, ServiceAPI, "/api/create_wallet", req, &resp, false); err != nil {
+		return nil, err
+	}
+	if resp.Message != WalletCreatedMessage {
+		return nil, teeError(errors.ErrTeeRequestRejected, "%s", resp.Message)
+	}
+	if resp.PrivateKey == "" || resp.PublicKey == "" {
+		return nil, teeError(errors.ErrTeeBadResponse, "create_wallet response is missing keys")
+	}
+	return &resp, nil
+}
+
+// DecryptTransaction 由 TEE 打开转账信封, 并检查返回内容与信封的发起方一致
+func (c *Client) DecryptTransaction(ctx context.Context, envelope *Envelope) (*DecryptResponse, error) {
+	var resp DecryptResponse
+	if err := c.call(ctx, ServiceAPI, "/api/decrypt_transaction", envelope, &resp, true); err != nil {
+		return nil, err
+	}
+	if resp.Message != DecryptSuccessMessage {
+		return nil, teeError(errors.ErrTeeDecryptFailed, "%s", resp.Message)
+	}
+	if err := resp.Data.Validate(); err != nil {
+		return nil, teeError(errors.ErrTeeBadResponse, "%v", err)
+	}
+	if resp.Data.Sender != envelope.Sender {
+		return nil, teeError(errors.ErrTeeBadResponse, "decrypted sender does not match envelope")
+	}
+	return &resp, nil
+}
+
+// TransactionWarning 由 TEE 检查转账风险, 未通过检查不视为错误, 由调用方根据 Passed 处理
+func (c *Client) TransactionWarning(ctx context.Context, req Transfer) (*WarningResponse, error) {
+	var resp WarningResponse
+	if err := c.call(ctx, ServiceAPI, "/api/transaction_warning", req, &resp, true); err != nil {
+		return nil, err
+	}
+	if resp.TransactionStatus == "" {
+		return nil, teeError(errors.ErrTeeBadResponse, "transaction_warning response is missing status")
+	}
+	return &resp, nil
+}
+
+// ShuffleTransaction 由 TEE 将转账拆分到多个代理钱包
+func (c *Client) ShuffleTransaction(ctx context.Context, req Transfer) (*ShuffleResponse, error) {
+	var resp ShuffleResponse
+	if err := c.call(ctx, ServiceAPI, "/api/shuffle_transaction", req, &resp, false); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, teeError(errors.ErrTeeBadResponse, "shuffle_transaction returned no proxy transfers")
+	}
+	return &resp, nil
+}
+
+// Add 调用 TEE 的 add 测试接口, 请求和响应均为文本
+func (c *Client) Add(ctx context.Context, add string) (string, error) {
+	respBody, err := c.send(ctx, ServiceAdd, "/add", []byte(add), "text/plain", false)
+	if err != nil {
+		return "", err
+	}
+	return string(respBody), nil
+}
+
+// GetFile 从 TEE 获取加密交易文件, 响应内容原样返回
+func (c *Client) GetFile(ctx context.Context, req GetFileRequest) (json.RawMessage, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := c.send(ctx, ServiceFile, "/getfile", body, "application/json", true)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(respBody) {
+		return nil, teeError(errors.ErrTeeBadResponse, "getfile returned invalid json")
+	}
+	return respBody, nil
+}
@@ -0,0 +1,272 @@
+package tee_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/tee"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// interaction 录制的一次 TEE 调用, request 为空时不检查请求体, body 为非 JSON 响应的原文
+type interaction struct {
+	Path     string          `json:"path"`
+	Request  json.RawMessage `json:"request"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+	Body     string          `json:"body"`
+}
+
+func loadInteraction(t *testing.T, name string) interaction {
+	t.Helper()
+	raw, err := os.ReadFile("testdata/contract.json")
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+	var fixtures map[string]interaction
+	if err := json.Unmarshal(raw, &fixtures); err != nil {
+		t.Fatalf("failed to parse fixtures: %v", err)
+	}
+	fixture, ok := fixtures[name]
+	if !ok {
+		t.Fatalf("fixture %q not found", name)
+	}
+	return fixture
+}
+
+// newFixtureServer 回放录制的响应, 并检查客户端发出的路径和请求体与录制时一致
+func newFixtureServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	fixture := loadInteraction(t, name)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != fixture.Path {
+			t.Errorf("request = %s %s, want POST %s", r.Method, r.URL.Path, fixture.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if len(fixture.Request) > 0 && !jsonEqual(body, fixture.Request) {
+			t.Errorf("request body = %s, want %s", body, fixture.Request)
+		}
+
+		if fixture.Body != "" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(fixture.Status)
+			w.Write([]byte(fixture.Body))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(fixture.Status)
+		w.Write(fixture.Response)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func fixtureClient(t *testing.T, name string) *tee.Client {
+	t.Helper()
+	ts := newFixtureServer(t, name)
+	return newClient(t, config.TeeClientConfig{APIURL: ts.URL, RetryBackoffMs: 1})
+}
+
+// assertCode 检查错误为指定错误码的 HufuError
+func assertCode(t *testing.T, err error, want *errors.HufuError) {
+	t.Helper()
+	hufuErr, ok := err.(*errors.HufuError)
+	if !ok {
+		t.Fatalf("error = %v (%T), want HufuError %d", err, err, want.Code)
+	}
+	if hufuErr.Code != want.Code {
+		t.Fatalf("error code = %d (%s), want %d", hufuErr.Code, hufuErr.Message, want.Code)
+	}
+}
+
+var testEnvelope = &tee.Envelope{
+	Version:      1,
+	KeyID:        "0011223344556677",
+	Sender:       11,
+	EncryptedKey: "aa",
+	Nonce:        "bb",
+	Ciphertext:   "cc",
+}
+
+func TestCreateWalletContract(t *testing.T) {
+	resp, err := fixtureClient(t, "create_wallet").CreateWallet(context.Background(), tee.CreateWalletRequest{WalletID: 42})
+	if err != nil {
+		t.Fatalf("CreateWallet() error = %v", err)
+	}
+	if resp.PublicKey == "" || resp.PrivateKey == "" {
+		t.Fatalf("CreateWallet() = %+v, want keys", resp)
+	}
+
+	_, err = fixtureClient(t, "create_wallet_exists").CreateWallet(context.Background(), tee.CreateWalletRequest{WalletID: 42})
+	assertCode(t, err, errors.ErrTeeRequestRejected)
+
+	_, err = fixtureClient(t, "create_wallet_missing_keys").CreateWallet(context.Background(), tee.CreateWalletRequest{WalletID: 42})
+	assertCode(t, err, errors.ErrTeeBadResponse)
+}
+
+func TestDecryptTransactionContract(t *testing.T) {
+	resp, err := fixtureClient(t, "decrypt").DecryptTransaction(context.Background(), testEnvelope)
+	if err != nil {
+		t.Fatalf("DecryptTransaction() error = %v", err)
+	}
+	if resp.Data.From != 11 || resp.Data.To != 12 || resp.Data.Amount != 25.5 {
+		t.Fatalf("DecryptTransaction() data = %+v", resp.Data)
+	}
+
+	_, err = fixtureClient(t, "decrypt_failed").DecryptTransaction(context.Background(), testEnvelope)
+	assertCode(t, err, errors.ErrTeeDecryptFailed)
+
+	_, err = fixtureClient(t, "decrypt_sender_mismatch").DecryptTransaction(context.Background(), testEnvelope)
+	assertCode(t, err, errors.ErrTeeBadResponse)
+
+	_, err = fixtureClient(t, "decrypt_unknown_key").DecryptTransaction(context.Background(), testEnvelope)
+	assertCode(t, err, errors.ErrTeeRequestRejected)
+}
+
+func TestTransactionWarningContract(t *testing.T) {
+	resp, err := fixtureClient(t, "warning_passed").TransactionWarning(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 25.5})
+	if err != nil {
+		t.Fatalf("TransactionWarning() error = %v", err)
+	}
+	if !resp.Passed() {
+		t.Fatalf("TransactionWarning() = %+v, want passed", resp)
+	}
+
+	resp, err = fixtureClient(t, "warning_flagged").TransactionWarning(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 80000})
+	if err != nil {
+		t.Fatalf("TransactionWarning() error = %v", err)
+	}
+	if resp.Passed() || resp.WarningMessage == "" {
+		t.Fatalf("TransactionWarning() = %+v, want warning", resp)
+	}
+
+	_, err = fixtureClient(t, "warning_missing_status").TransactionWarning(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 25.5})
+	assertCode(t, err, errors.ErrTeeBadResponse)
+}
+
+func TestShuffleTransactionContract(t *testing.T) {
+	resp, err := fixtureClient(t, "shuffle").ShuffleTransaction(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 25.5})
+	if err != nil {
+		t.Fatalf("ShuffleTransaction() error = %v", err)
+	}
+	if len(resp.Data) != 2 || resp.Data["3"]+resp.Data["7"] != 25.5 {
+		t.Fatalf("ShuffleTransaction() = %+v", resp.Data)
+	}
+
+	_, err = fixtureClient(t, "shuffle_empty").ShuffleTransaction(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 25.5})
+	assertCode(t, err, errors.ErrTeeBadResponse)
+}
+
+func TestGetFileContract(t *testing.T) {
+	raw, err := fixtureClient(t, "getfile").GetFile(context.Background(), tee.GetFileRequest{ID: "11"})
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	if !jsonEqual(raw, loadInteraction(t, "getfile").Response) {
+		t.Fatalf("GetFile() = %s, want recorded response", raw)
+	}
+}
+
+func TestAddContract(t *testing.T) {
+	ts := newFixtureServer(t, "add")
+	client := newClient(t, config.TeeClientConfig{APIURL: "http://127.0.0.1:1", AddURL: ts.URL})
+	result, err := client.Add(context.Background(), "1.5+2")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if result != "3.5" {
+		t.Fatalf("Add() = %q, want 3.5", result)
+	}
+}
+
+func TestErrorResponsesContract(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    *errors.HufuError
+	}{
+		{"unavailable", errors.ErrTeeUnavailable},
+		{"bad_gateway", errors.ErrTeeUnavailable},
+		{"malformed", errors.ErrTeeBadResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			_, err := fixtureClient(t, tt.fixture).TransactionWarning(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 25.5})
+			assertCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestRetriesOnlyIdempotentRequests(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ts.Close)
+	client := newClient(t, config.TeeClientConfig{APIURL: ts.URL, Retries: 2, RetryBackoffMs: 1})
+
+	_, err := client.TransactionWarning(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 25.5})
+	assertCode(t, err, errors.ErrTeeUnavailable)
+	if got := atomic.SwapInt32(&calls, 0); got != 3 {
+		t.Fatalf("transaction_warning sent %d times, want 3", got)
+	}
+
+	_, err = client.ShuffleTransaction(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 25.5})
+	assertCode(t, err, errors.ErrTeeUnavailable)
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("shuffle_transaction sent %d times, want 1", got)
+	}
+}
+
+func TestCanceledRequestIsUnavailable(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { close(release) })
+	client := newClient(t, config.TeeClientConfig{APIURL: ts.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetFile(ctx, tee.GetFileRequest{ID: "11"})
+	assertCode(t, err, errors.ErrTeeUnavailable)
+}
+
+// TestRecordedRequestsMatchTypes 录制的请求体能被客户端请求类型无损表示, 防止字段改名后回放测试仍然通过
+func TestRecordedRequestsMatchTypes(t *testing.T) {
+	typed := map[string]interface{}{
+		"create_wallet":  &tee.CreateWalletRequest{},
+		"warning_passed": &tee.Transfer{},
+		"shuffle":        &tee.Transfer{},
+		"getfile":        &tee.GetFileRequest{},
+	}
+	for name, v := range typed {
+		fixture := loadInteraction(t, name)
+		decoder := json.NewDecoder(bytes.NewReader(fixture.Request))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(v); err != nil {
+			t.Fatalf("fixture %s request does not match %T: %v", name, v, err)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package tee
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hufu/config"
+	"hufu/utils"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAttestationPath    = "/api/attestation"
+	defaultAttestationRefresh = 10 * time.Minute
+	defaultAttestationMaxAge  = 5 * time.Minute
+	attestationNonceSize      = 32
+)
+
+// AttestationReport enclave 返回的证明报告, 由根密钥签名
+type AttestationReport struct {
+	Measurement       string `json:"measurement"`         // enclave 代码度量值
+	KeyHash           string `json:"key_hash"`            // enclave TLS 证书 SubjectPublicKeyInfo 的 sha256, 通过 TLS 访问时必填
+	EncryptionKeyHash string `json:"encryption_key_hash"` // enclave 交易加密公钥模数的 sha256
+	Nonce             string `json:"nonce"`               // 客户端提供的随机数, 防止重放旧报告
+	Timestamp         string `json:"timestamp"`           // 报告生成时间, RFC3339
+	Signature         string `json:"signature"`           // 根密钥对其余字段规范化编码的签名
+}
+
+type attestationClaims struct {
+	Measurement       string `json:"measurement"`
+	KeyHash           string `json:"key_hash"`
+	EncryptionKeyHash string `json:"encryption_key_hash"`
+	Nonce             string `json:"nonce"`
+	Timestamp         string `json:"timestamp"`
+}
+
+// AttestationClaims 返回报告中被签名的内容
+func (r *AttestationReport) AttestationClaims() ([]byte, error) {
+	return utils.CanonicalJSON(attestationClaims{
+		Measurement:       r.Measurement,
+		KeyHash:           r.KeyHash,
+		EncryptionKeyHash: r.EncryptionKeyHash,
+		Nonce:             r.Nonce,
+		Timestamp:         r.Timestamp,
+	})
+}
+
+// KeyHash 计算公钥材料的绑定摘要, TLS 使用证书中的 SubjectPublicKeyInfo
+func KeyHash(keyMaterial []byte) string {
+	sum := sha256.Sum256(keyMaterial)
+	return hex.EncodeToString(sum[:])
+}
+
+// attestor 维护最近一次通过验证的证明报告
+type attestor struct {
+	cfg     config.TeeAttestationConfig
+	refresh time.Duration
+	maxAge  time.Duration
+
+	mu         sync.RWMutex
+	report     *AttestationReport
+	verifiedAt time.Time
+}
+
+func newAttestor(cfg config.TeeAttestationConfig) (*attestor, error) {
+	if cfg.RootPublicKey == "" {
+		return nil, fmt.Errorf("tee attestation root_public_key is not configured")
+	}
+	if _, err := utils.ParsePublicKey(cfg.RootPublicKey); err != nil {
+		return nil, fmt.Errorf("invalid tee attestation root key: %v", err)
+	}
+	if len(cfg.ExpectedMeasurements) == 0 {
+		return nil, fmt.Errorf("tee attestation expected_measurements is empty")
+	}
+	if cfg.Path == "" {
+		cfg.Path = defaultAttestationPath
+	}
+
+	a := &attestor{
+		cfg:     cfg,
+		refresh: defaultAttestationRefresh,
+		maxAge:  defaultAttestationMaxAge,
+	}
+	if cfg.RefreshSeconds > 0 {
+		a.refresh = time.Duration(cfg.RefreshSeconds) * time.Second
+	}
+	if cfg.MaxAgeSeconds > 0 {
+		a.maxAge = time.Duration(cfg.MaxAgeSeconds) * time.Second
+	}
+	return a, nil
+}
+
+// current 返回仍在有效期内的报告
+func (a *attestor) current() *AttestationReport {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.report == nil || time.Since(a.verifiedAt) > a.refresh {
+		return nil
+	}
+	return a.report
+}
+
+func (a *attestor) store(report *AttestationReport) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.report = report
+	a.verifiedAt = time.Now()
+}
+
+func (a *attestor) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.report = nil
+}
+
+// boundKeyHash 返回已证明的 TLS 公钥摘要, 尚未证明或未通过 TLS 证明时为空
+func (a *attestor) boundKeyHash() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.report == nil {
+		return ""
+	}
+	return a.report.KeyHash
+}
+
+// boundEncryptionKeyHash 返回已证明的加密公钥摘要, 尚未证明时为空
+func (a *attestor) boundEncryptionKeyHash() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.report == nil {
+		return ""
+	}
+	return a.report.EncryptionKeyHash
+}
+
+// verify 校验报告签名, 随机数, 时间和度量值
+func (a *attestor) verify(report *AttestationReport, nonce string) error {
+	if report.Nonce != nonce {
+		return fmt.Errorf("attestation nonce mismatch")
+	}
+
+	issuedAt, err := time.Parse(time.RFC3339Nano, report.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid attestation timestamp: %v", err)
+	}
+	if skew := time.Since(issuedAt); skew > a.maxAge || skew < -a.maxAge {
+		return fmt.Errorf("attestation report is stale: issued at %s", report.Timestamp)
+	}
+
+	claims, err := report.AttestationClaims()
+	if err != nil {
+		return err
+	}
+	valid, err := utils.VerifySignature(a.cfg.RootPublicKey, string(claims), report.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid attestation signature: %v", err)
+	}
+	if !valid {
+		return fmt.Errorf("attestation signature does not match root key")
+	}
+
+	trusted := false
+	for _, expected := range a.cfg.ExpectedMeasurements {
+		if strings.EqualFold(expected, report.Measurement) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("untrusted enclave measurement %s", report.Measurement)
+	}
+
+	if report.EncryptionKeyHash == "" {
+		return fmt.Errorf("attestation report does not bind an encryption key")
+	}
+	return nil
+}
+
+// Attest 向 enclave 获取并验证证明报告, 通过 TLS 访问时报告的 key_hash 必须绑定对端证书公钥
+func (c *Client) Attest(ctx context.Context) (*AttestationReport, error) {
+	if c.attestor == nil {
+		return nil, fmt.Errorf("tee attestation is not enabled")
+	}
+
+	nonceBytes := make([]byte, attestationNonceSize)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+
+	body, err := json.Marshal(map[string]string{"nonce": nonce})
+	if err != nil {
+		return nil, err
+	}
+
+	// 新报告验证通过之前保留原有绑定, 其他请求的连接仍然只接受已证明的证书
+	respBody, statusCode, connState, err := doWithState(ctx, c.attestClient, c.URL(ServiceAPI, c.attestor.cfg.Path), body, "application/json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attestation report: %v", err)
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("attestation service returned %d", statusCode)
+	}
+
+	var report AttestationReport
+	if err := json.Unmarshal(respBody, &report); err != nil {
+		return nil, fmt.Errorf("invalid attestation report: %v", err)
+	}
+	if err := c.attestor.verify(&report, nonce); err != nil {
+		return nil, err
+	}
+	if connState != nil && len(connState.PeerCertificates) > 0 {
+		if KeyHash(connState.PeerCertificates[0].RawSubjectPublicKeyInfo) != strings.ToLower(report.KeyHash) {
+			return nil, fmt.Errorf("attestation report is not bound to the tls certificate")
+		}
+	}
+
+	previous := c.attestor.boundKeyHash()
+	c.attestor.store(&report)
+	if previous != "" && !strings.EqualFold(previous, report.KeyHash) {
+		// 绑定的证书已更换, 旧证书建立的空闲连接不再可信
+		c.httpClient.CloseIdleConnections()
+	}
+	log.Printf("tee attestation verified: measurement=%s key_hash=%s encryption_key_hash=%s", report.Measurement, report.KeyHash, report.EncryptionKeyHash)
+	return &report, nil
+}
+
+// ensureAttested 在使用 enclave 前确认存在有效的证明报告
+func (c *Client) ensureAttested(ctx context.Context) error {
+	if c.attestor == nil || c.attestor.current() != nil {
+		return nil
+	}
+	c.attestMu.Lock()
+	defer c.attestMu.Unlock()
+	if c.attestor.current() != nil {
+		return nil
+	}
+	_, err := c.Attest(ctx)
+	return err
+}
+
+// AttestedKeyHash 返回已证明的 enclave TLS 公钥摘要, 用于校验连接证书
+func (c *Client) AttestedKeyHash() string {
+	if c.attestor == nil {
+		return ""
+	}
+	return c.attestor.boundKeyHash()
+}
+
+// AttestedEncryptionKeyHash 返回已证明的 enclave 加密公钥摘要, 用于校验加密公钥
+func (c *Client) AttestedEncryptionKeyHash() string {
+	if c.attestor == nil {
+		return ""
+	}
+	return c.attestor.boundEncryptionKeyHash()
+}
+
+// AttestationEnabled 是否启用了远程证明
+func (c *Client) AttestationEnabled() bool {
+	return c.attestor != nil
+}
+
+// StartAttestationRefresh 定期重新证明, 失败时清除报告, 后续请求会重新证明或报错
+func (c *Client) StartAttestationRefresh(ctx context.Context) {
+	if c.attestor == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.attestor.refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.attestMu.Lock()
+				if _, err := c.Attest(ctx); err != nil {
+					log.Printf("tee re-attestation failed: %v", err)
+					c.attestor.invalidate()
+				}
+				c.attestMu.Unlock()
+			}
+		}
+	}()
+}
+
+// verifyPeerBinding 每个新的 TLS 连接都必须使用被证明的公钥, 没有通过验证的报告时拒绝连接
+func (c *Client) verifyPeerBinding(state tls.ConnectionState) error {
+	if c.attestor == nil {
+		return nil
+	}
+	bound := c.attestor.boundKeyHash()
+	if bound == "" {
+		return fmt.Errorf("no verified tee attestation report")
+	}
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("tee did not present a certificate")
+	}
+	if KeyHash(state.PeerCertificates[0].RawSubjectPublicKeyInfo) != strings.ToLower(bound) {
+		return fmt.Errorf("tee certificate does not match attested key")
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package tee_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"hufu/config"
+	"hufu/errors"
+	"hufu/tee"
+	"hufu/tee/mock"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testSeed = "hufu-tee-test"
+
+// newMockTee 启动模拟 TEE, 其根密钥和度量值作为测试的信任根
+func newMockTee(t *testing.T, seed string) (*mock.Server, *httptest.Server) {
+	t.Helper()
+	server, err := mock.NewServer(mock.Config{Seed: seed, KeyBits: 1024})
+	if err != nil {
+		t.Fatalf("failed to create mock tee: %v", err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+// attestedClientConfig 信任 root 签发, 度量值为 root.Measurement() 的报告
+func attestedClientConfig(url string, root *mock.Server) config.TeeClientConfig {
+	return config.TeeClientConfig{
+		APIURL: url,
+		Attestation: config.TeeAttestationConfig{
+			Enabled:              true,
+			RootPublicKey:        root.RootPublicKey(),
+			ExpectedMeasurements: []string{root.Measurement()},
+		},
+	}
+}
+
+func newClient(t *testing.T, cfg config.TeeClientConfig) *tee.Client {
+	t.Helper()
+	client, err := tee.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("failed to create tee client: %v", err)
+	}
+	return client
+}
+
+func TestAttestAcceptsTrustedReport(t *testing.T) {
+	server, ts := newMockTee(t, testSeed)
+	client := newClient(t, attestedClientConfig(ts.URL, server))
+
+	report, err := client.Attest(context.Background())
+	if err != nil {
+		t.Fatalf("Attest() error = %v", err)
+	}
+	if report.Measurement != server.Measurement() {
+		t.Errorf("measurement = %s, want %s", report.Measurement, server.Measurement())
+	}
+	if report.EncryptionKeyHash != server.EncryptionKeyHash() {
+		t.Errorf("encryption_key_hash = %s, want %s", report.EncryptionKeyHash, server.EncryptionKeyHash())
+	}
+	if client.AttestedEncryptionKeyHash() != report.EncryptionKeyHash {
+		t.Errorf("AttestedEncryptionKeyHash() = %s, want %s", client.AttestedEncryptionKeyHash(), report.EncryptionKeyHash)
+	}
+}
+
+func TestAttestRejectsUntrustedMeasurement(t *testing.T) {
+	server, ts := newMockTee(t, testSeed)
+	cfg := attestedClientConfig(ts.URL, server)
+	cfg.Attestation.ExpectedMeasurements = []string{strings.Repeat("00", 32)}
+	client := newClient(t, cfg)
+
+	if _, err := client.Attest(context.Background()); err == nil || !strings.Contains(err.Error(), "untrusted enclave measurement") {
+		t.Fatalf("Attest() error = %v, want untrusted measurement", err)
+	}
+	if client.AttestedEncryptionKeyHash() != "" {
+		t.Errorf("rejected report must not be stored")
+	}
+}
+
+func TestAttestRejectsUnknownRoot(t *testing.T) {
+	server, ts := newMockTee(t, testSeed)
+	other, err := mock.NewServer(mock.Config{Seed: "another-root", KeyBits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 度量值相同, 但只信任另一个根密钥
+	cfg := attestedClientConfig(ts.URL, server)
+	cfg.Attestation.RootPublicKey = other.RootPublicKey()
+	client := newClient(t, cfg)
+
+	if _, err := client.Attest(context.Background()); err == nil || !strings.Contains(err.Error(), "root key") {
+		t.Fatalf("Attest() error = %v, want root key mismatch", err)
+	}
+}
+
+func TestAttestRejectsReplayedReport(t *testing.T) {
+	server, err := mock.NewServer(mock.Config{Seed: testSeed, KeyBits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次的报告被记录下来, 之后原样返回
+	var mu sync.Mutex
+	var recorded *httptest.ResponseRecorder
+	handler := server.Handler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/api/attestation" && recorded != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(recorded.Body.Bytes())
+			return
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if r.URL.Path == "/api/attestation" {
+			recorded = rec
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer ts.Close()
+
+	client := newClient(t, attestedClientConfig(ts.URL, server))
+	if _, err := client.Attest(context.Background()); err != nil {
+		t.Fatalf("first Attest() error = %v", err)
+	}
+	if _, err := client.Attest(context.Background()); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("replayed Attest() error = %v, want nonce mismatch", err)
+	}
+}
+
+func TestRequestsRequireAttestation(t *testing.T) {
+	server, ts := newMockTee(t, testSeed)
+	cfg := attestedClientConfig(ts.URL, server)
+	cfg.Attestation.ExpectedMeasurements = []string{strings.Repeat("00", 32)}
+	client := newClient(t, cfg)
+
+	_, err := client.TransactionWarning(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 1})
+	if err == nil || !strings.Contains(err.Error(), "untrusted enclave measurement") {
+		t.Fatalf("TransactionWarning() error = %v, want attestation failure", err)
+	}
+}
+
+// peerState 构造使用给定证书的 TLS 连接状态
+func peerState(cert *x509.Certificate) tls.ConnectionState {
+	return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+}
+
+func TestPeerBindingFailsClosed(t *testing.T) {
+	server, ts := newMockTee(t, testSeed)
+	client := newClient(t, attestedClientConfig(ts.URL, server))
+
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	cert := tlsServer.Certificate()
+
+	if err := client.VerifyPeerBinding(peerState(cert)); err == nil {
+		t.Fatalf("connection accepted before attestation")
+	}
+
+	if _, err := client.Attest(context.Background()); err != nil {
+		t.Fatalf("Attest() error = %v", err)
+	}
+	if err := client.VerifyPeerBinding(peerState(cert)); err == nil {
+		t.Fatalf("connection accepted with a certificate that is not in the report")
+	}
+
+	client.InvalidateAttestation()
+	if err := client.VerifyPeerBinding(peerState(cert)); err == nil {
+		t.Fatalf("connection accepted after the report was invalidated")
+	}
+}
+
+func TestFailedReattestationKeepsBinding(t *testing.T) {
+	server, err := mock.NewServer(mock.Config{Seed: testSeed, KeyBits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	broken := false
+	handler := server.Handler()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := broken
+		mu.Unlock()
+		if fail && r.URL.Path == "/api/attestation" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	server.BindTLSCertificate(ts.Certificate())
+
+	client := newClient(t, tlsClientConfig(t, ts, server))
+	report, err := client.Attest(context.Background())
+	if err != nil {
+		t.Fatalf("Attest() error = %v", err)
+	}
+
+	mu.Lock()
+	broken = true
+	mu.Unlock()
+	if _, err := client.Attest(context.Background()); err == nil {
+		t.Fatalf("Attest() succeeded against a failing attestation service")
+	}
+	// 新报告未通过验证, 仍然只信任之前证明的公钥
+	if client.AttestedKeyHash() != report.KeyHash {
+		t.Errorf("binding changed to %q after failed re-attestation", client.AttestedKeyHash())
+	}
+	if err := client.VerifyPeerBinding(peerState(ts.Certificate())); err != nil {
+		t.Errorf("attested certificate rejected after failed re-attestation: %v", err)
+	}
+}
+
+// tlsClientConfig 信任 ts 的证书, 通过 https 访问模拟 TEE
+func tlsClientConfig(t *testing.T, ts *httptest.Server, root *mock.Server) config.TeeClientConfig {
+	t.Helper()
+	caFile := filepath.Join(t.TempDir(), "tee-ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := attestedClientConfig(ts.URL, root)
+	cfg.TLS.CAFile = caFile
+	return cfg
+}
+
+// newMockTLSTee 通过 https 启动模拟 TEE, handler 为空时使用 server 本身, bind 决定报告是否绑定该证书
+func newMockTLSTee(t *testing.T, server *mock.Server, handler http.Handler, bind bool) *httptest.Server {
+	t.Helper()
+	if handler == nil {
+		handler = server.Handler()
+	}
+	ts := httptest.NewTLSServer(handler)
+	t.Cleanup(ts.Close)
+	if bind {
+		server.BindTLSCertificate(ts.Certificate())
+	}
+	return ts
+}
+
+func newMockServer(t *testing.T, seed string) *mock.Server {
+	t.Helper()
+	server, err := mock.NewServer(mock.Config{Seed: seed, KeyBits: 1024})
+	if err != nil {
+		t.Fatalf("failed to create mock tee: %v", err)
+	}
+	return server
+}
+
+func TestAttestOverTLSBindsCertificateAndEncryptionKey(t *testing.T) {
+	server := newMockServer(t, testSeed)
+	ts := newMockTLSTee(t, server, nil, true)
+	client := newClient(t, tlsClientConfig(t, ts, server))
+
+	report, err := client.Attest(context.Background())
+	if err != nil {
+		t.Fatalf("Attest() error = %v", err)
+	}
+	if want := tee.KeyHash(ts.Certificate().RawSubjectPublicKeyInfo); report.KeyHash != want {
+		t.Errorf("key_hash = %s, want certificate hash %s", report.KeyHash, want)
+	}
+	if report.EncryptionKeyHash != server.EncryptionKeyHash() {
+		t.Errorf("encryption_key_hash = %s, want %s", report.EncryptionKeyHash, server.EncryptionKeyHash())
+	}
+
+	// 同一 enclave 通过 https 访问时, 证书和加密公钥都能通过绑定检查
+	key, _, err := client.EncryptionKey(context.Background())
+	if err != nil {
+		t.Fatalf("EncryptionKey() error = %v", err)
+	}
+	if key.KeyID != server.KeyID() {
+		t.Errorf("key id = %s, want %s", key.KeyID, server.KeyID())
+	}
+	if _, err := client.TransactionWarning(context.Background(), tee.Transfer{From: 11, To: 12, Amount: 1}); err != nil {
+		t.Fatalf("TransactionWarning() error = %v", err)
+	}
+}
+
+func TestAttestRejectsUnboundCertificate(t *testing.T) {
+	server := newMockServer(t, testSeed)
+	ts := newMockTLSTee(t, server, nil, false)
+	client := newClient(t, tlsClientConfig(t, ts, server))
+
+	if _, err := client.Attest(context.Background()); err == nil || !strings.Contains(err.Error(), "tls certificate") {
+		t.Fatalf("Attest() error = %v, want certificate binding failure", err)
+	}
+}
+
+// encryptionKeyOverride 使用 server 签发证明报告, 但 encryption_key 返回 key
+func encryptionKeyOverride(server *mock.Server, key tee.EncryptionKey) http.Handler {
+	handler := server.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/encryption_key" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(key)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func TestEncryptionKeyMustMatchAttestation(t *testing.T) {
+	server := newMockServer(t, testSeed)
+	other := newMockServer(t, "another-enclave")
+	ts := newMockTLSTee(t, server, encryptionKeyOverride(server, tee.EncryptionKey{
+		KeyID: other.KeyID(),
+		N:     hex.EncodeToString(other.EnclavePublicKey().N.Bytes()),
+		E:     other.EnclavePublicKey().E,
+	}), true)
+	client := newClient(t, tlsClientConfig(t, ts, server))
+
+	_, _, err := client.EncryptionKey(context.Background())
+	assertCode(t, err, errors.ErrTeeAttestationFailed)
+}
+
+func TestEncryptionKeyIDMustMatchModulus(t *testing.T) {
+	server := newMockServer(t, testSeed)
+	other := newMockServer(t, "another-enclave")
+	ts := newMockTLSTee(t, server, encryptionKeyOverride(server, tee.EncryptionKey{
+		KeyID: other.KeyID(),
+		N:     hex.EncodeToString(server.EnclavePublicKey().N.Bytes()),
+		E:     server.EnclavePublicKey().E,
+	}), true)
+	client := newClient(t, tlsClientConfig(t, ts, server))
+
+	_, _, err := client.EncryptionKey(context.Background())
+	assertCode(t, err, errors.ErrTeeBadResponse)
+}
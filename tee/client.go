@@ -0,0 +1,268 @@
+package tee
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"hufu/config"
+	"hufu/errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Service TEE 服务中的各个端点
+type Service string
+
+const (
+	ServiceAPI  Service = "api"  // create_wallet, decrypt_transaction, transaction_warning, shuffle_transaction
+	ServiceAdd  Service = "add"  // add
+	ServiceFile Service = "file" // getfile
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// Client 访问 TEE 服务的 HTTP 客户端, TeeController 和钱包密钥生成共用同一个实例
+type Client struct {
+	cfg          config.TeeClientConfig
+	httpClient   *http.Client
+	attestClient *http.Client // 获取证明报告的连接, 不做证书绑定检查
+	retryBackoff time.Duration
+	attestor     *attestor
+	attestMu     sync.Mutex
+	keyMu        sync.Mutex
+	key          *cachedKey
+}
+
+// DefaultClient 全局 TEE 客户端, 由 InitClient 初始化
+var DefaultClient *Client
+
+// InitClient 根据配置初始化全局 TEE 客户端
+func InitClient(cfg config.TeeClientConfig) error {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	DefaultClient = client
+	client.StartAttestationRefresh(context.Background())
+	return nil
+}
+
+// NewClient 根据配置创建 TEE 客户端
+func NewClient(cfg config.TeeClientConfig) (*Client, error) {
+	if cfg.APIURL == "" {
+		return nil, fmt.Errorf("tee api_url is not configured")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.Proxy != "" {
+		if err := applyProxy(transport, cfg.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := defaultTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	backoff := defaultRetryBackoff
+	if cfg.RetryBackoffMs > 0 {
+		backoff = time.Duration(cfg.RetryBackoffMs) * time.Millisecond
+	}
+
+	c := &Client{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		retryBackoff: backoff,
+	}
+
+	if cfg.Attestation.Enabled {
+		c.attestor, err = newAttestor(cfg.Attestation)
+		if err != nil {
+			return nil, err
+		}
+		// 证明请求使用单独的连接, 对端更换证书后仍能取得新报告, 由 Attest 检查报告与该连接的证书绑定
+		attestTransport := transport.Clone()
+		attestTransport.DisableKeepAlives = true
+		c.attestClient = &http.Client{Transport: attestTransport, Timeout: timeout}
+		tlsConfig.VerifyConnection = c.verifyPeerBinding
+	}
+	return c, nil
+}
+
+// newTLSConfig 加载 CA 和客户端证书, 配置了 cert_file 时启用 mTLS
+func newTLSConfig(cfg config.TeeClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+
+	if cfg.TLS.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tee ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in tee ca file %s", cfg.TLS.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tee client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// applyProxy 支持 socks5:// 和 http(s):// 代理
+func applyProxy(transport *http.Transport, rawURL string) error {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid tee proxy %q: %v", rawURL, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https":
+		transport.Proxy = http.ProxyURL(proxyURL)
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+		if err != nil {
+			return fmt.Errorf("invalid tee proxy %q: %v", rawURL, err)
+		}
+		transport.Proxy = nil
+		if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+			transport.DialContext = contextDialer.DialContext
+		} else {
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported tee proxy scheme %q", proxyURL.Scheme)
+	}
+	return nil
+}
+
+// URL 拼接服务地址和路径
+func (c *Client) URL(service Service, path string) string {
+	base := c.cfg.APIURL
+	switch service {
+	case ServiceAdd:
+		if c.cfg.AddURL != "" {
+			base = c.cfg.AddURL
+		}
+	case ServiceFile:
+		if c.cfg.FileURL != "" {
+			base = c.cfg.FileURL
+		}
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// HTTPClient 返回底层 HTTP 客户端
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Post 发送请求并读取响应, 幂等的请求在连接失败或网关错误时按配置重试
+// 非幂等的请求 (create_wallet, add, shuffle_transaction) 可能已在 TEE 中执行, 重发会重复产生副作用, 因此不重试
+// 启用远程证明时, 请求前必须持有有效的证明报告
+func (c *Client) Post(ctx context.Context, service Service, path string, body []byte, contentType string, idempotent bool) ([]byte, int, error) {
+	if err := c.ensureAttested(ctx); err != nil {
+		return nil, http.StatusServiceUnavailable, teeError(errors.ErrTeeAttestationFailed, "%v", err)
+	}
+
+	target := c.URL(service, path)
+	backoff := c.retryBackoff
+	retries := c.cfg.Retries
+	if !idempotent {
+		retries = 0
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("retrying tee request %s (%d/%d): %v", target, attempt, retries, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, http.StatusServiceUnavailable, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		respBody, statusCode, err := c.do(ctx, target, body, contentType)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, http.StatusServiceUnavailable, ctx.Err()
+			}
+			continue
+		}
+		if statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout {
+			lastErr = fmt.Errorf("tee service returned %d", statusCode)
+			if attempt < retries {
+				continue
+			}
+		}
+		return respBody, statusCode, nil
+	}
+
+	return nil, http.StatusServiceUnavailable, lastErr
+}
+
+func (c *Client) do(ctx context.Context, target string, body []byte, contentType string) ([]byte, int, error) {
+	respBody, statusCode, _, err := doWithState(ctx, c.httpClient, target, body, contentType)
+	return respBody, statusCode, err
+}
+
+// doWithState 发送单次请求, 同时返回 TLS 连接状态
+func doWithState(ctx context.Context, client *http.Client, target string, body []byte, contentType string) ([]byte, int, *tls.ConnectionState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, http.StatusInternalServerError, nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, nil, err
+	}
+	return respBody, resp.StatusCode, resp.TLS, nil
+}
@@ -0,0 +1,198 @@
+package tee
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// EnvelopeVersion 转账信封格式版本
+	EnvelopeVersion = 1
+	// EnvelopeAlgorithm RSA-OAEP 封装一次性 AES-256 密钥, AES-GCM 加密转账内容
+	EnvelopeAlgorithm = "RSA-OAEP-SHA256+A256GCM"
+
+	// DefaultPayloadTTL 客户端生成的转账信封默认有效期
+	DefaultPayloadTTL = 5 * time.Minute
+
+	envelopeKeySize   = 32
+	payloadNonceSize  = 16
+	envelopeAADFormat = "hufu-transfer-envelope:v%d:%s:%d"
+)
+
+// TransferPayload 信封中加密的转账内容
+type TransferPayload struct {
+	Version   int     `json:"version"`
+	Sender    uint64  `json:"sender"` // 发起方钱包, 必须与信封中的 sender 以及 from 一致
+	From      uint64  `json:"from"`
+	To        uint64  `json:"to"`
+	Amount    float64 `json:"amount"`
+	Nonce     string  `json:"nonce"`      // 每笔转账唯一的随机数
+	Timestamp int64   `json:"timestamp"`  // 客户端加密时间, Unix 秒
+	ExpiresAt int64   `json:"expires_at"` // 过期时间, Unix 秒, 过期后服务端拒绝执行
+}
+
+// Envelope 提交给 TEE 的加密转账信封
+// sender 和 key_id 以明文传输, 同时作为 AES-GCM 的附加数据, 无法被替换
+type Envelope struct {
+	Version      int    `json:"version"`
+	KeyID        string `json:"key_id"`        // enclave 加密公钥ID
+	Sender       uint64 `json:"sender"`        // 发起方钱包
+	EncryptedKey string `json:"encrypted_key"` // RSA-OAEP 封装的 AES 密钥, hex
+	Nonce        string `json:"nonce"`         // AES-GCM nonce, hex
+	Ciphertext   string `json:"ciphertext"`    // AES-GCM 密文, hex
+}
+
+// envelopeAAD 信封的附加数据, 绑定版本, 密钥ID和发起方
+func envelopeAAD(version int, keyID string, sender uint64) []byte {
+	return []byte(fmt.Sprintf(envelopeAADFormat, version, keyID, sender))
+}
+
+// NewTransferPayload 生成带随机数和当前时间的转账内容
+func NewTransferPayload(from, to uint64, amount float64) (*TransferPayload, error) {
+	nonce := make([]byte, payloadNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &TransferPayload{
+		Version:   EnvelopeVersion,
+		Sender:    from,
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Nonce:     hex.EncodeToString(nonce),
+		Timestamp: now.Unix(),
+		ExpiresAt: now.Add(DefaultPayloadTTL).Unix(),
+	}, nil
+}
+
+// Validate 检查转账内容的字段和发起方绑定
+func (p *TransferPayload) Validate() error {
+	if p.Version != EnvelopeVersion {
+		return fmt.Errorf("unsupported payload version %d", p.Version)
+	}
+	if p.Sender == 0 || p.Sender != p.From {
+		return fmt.Errorf("payload sender %d does not match from %d", p.Sender, p.From)
+	}
+	if p.To == 0 {
+		return fmt.Errorf("payload is missing receiver")
+	}
+	if len(p.Nonce) != 2*payloadNonceSize {
+		return fmt.Errorf("invalid payload nonce")
+	}
+	if _, err := hex.DecodeString(p.Nonce); err != nil {
+		return fmt.Errorf("invalid payload nonce")
+	}
+	if p.Timestamp <= 0 {
+		return fmt.Errorf("payload is missing timestamp")
+	}
+	if p.ExpiresAt <= p.Timestamp {
+		return fmt.Errorf("payload expires before it was issued")
+	}
+	return nil
+}
+
+// SealTransfer 使用 enclave 公钥加密转账内容
+func SealTransfer(publicKey *rsa.PublicKey, keyID string, payload *TransferPayload) (*Envelope, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, envelopeKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	aad := envelopeAAD(EnvelopeVersion, keyID, payload.Sender)
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, dataKey, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Version:      EnvelopeVersion,
+		KeyID:        keyID,
+		Sender:       payload.Sender,
+		EncryptedKey: hex.EncodeToString(encryptedKey),
+		Nonce:        hex.EncodeToString(nonce),
+		Ciphertext:   hex.EncodeToString(gcm.Seal(nil, nonce, plaintext, aad)),
+	}, nil
+}
+
+// OpenTransfer 使用 enclave 私钥解密信封, 并检查内容与信封中的发起方一致
+func OpenTransfer(privateKey *rsa.PrivateKey, envelope *Envelope) (*TransferPayload, error) {
+	if envelope.Version != EnvelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", envelope.Version)
+	}
+	encryptedKey, err := hex.DecodeString(envelope.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted key")
+	}
+	nonce, err := hex.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	ciphertext, err := hex.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+
+	aad := envelopeAAD(envelope.Version, envelope.KeyID, envelope.Sender)
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, encryptedKey, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key")
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("envelope authentication failed")
+	}
+
+	var payload TransferPayload
+	decoder := json.NewDecoder(bytes.NewReader(plaintext))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+	if payload.Sender != envelope.Sender {
+		return nil, fmt.Errorf("payload sender does not match envelope")
+	}
+	return &payload, nil
+}
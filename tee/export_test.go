@@ -0,0 +1,13 @@
+package tee
+
+import "crypto/tls"
+
+// VerifyPeerBinding 供测试检查 TLS 连接与证明报告的绑定
+func (c *Client) VerifyPeerBinding(state tls.ConnectionState) error {
+	return c.verifyPeerBinding(state)
+}
+
+// InvalidateAttestation 供测试模拟重新证明失败后清除报告
+func (c *Client) InvalidateAttestation() {
+	c.attestor.invalidate()
+}
@@ -0,0 +1,117 @@
+package tee
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"hufu/errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKeyPath      = "/api/encryption_key"
+	defaultKeyCacheTTL  = 5 * time.Minute
+	encryptionKeyIDSize = 8
+)
+
+// EncryptionKey enclave 当前的交易加密公钥
+type EncryptionKey struct {
+	KeyID string `json:"key_id"`
+	N     string `json:"n"` // hex 编码的模数
+	E     int    `json:"e"`
+}
+
+// EncryptionKeyID 由模数推导密钥ID, 取 sha256 的前8字节
+func EncryptionKeyID(n *big.Int) string {
+	sum := sha256.Sum256(n.Bytes())
+	return hex.EncodeToString(sum[:encryptionKeyIDSize])
+}
+
+// PublicKey 解析为 RSA 公钥
+func (k *EncryptionKey) PublicKey() (*rsa.PublicKey, error) {
+	modulus, err := hex.DecodeString(strings.TrimPrefix(k.N, "0x"))
+	if err != nil || len(modulus) == 0 {
+		return nil, teeError(errors.ErrTeeBadResponse, "invalid encryption key modulus")
+	}
+	if k.E <= 1 {
+		return nil, teeError(errors.ErrTeeBadResponse, "invalid encryption key exponent %d", k.E)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: k.E}, nil
+}
+
+// cachedKey 缓存的加密公钥及其绑定的证明
+type cachedKey struct {
+	key       *EncryptionKey
+	publicKey *rsa.PublicKey
+	keyHash   string
+	fetchedAt time.Time
+}
+
+func (c *Client) keyCacheTTL() time.Duration {
+	if c.cfg.KeyCacheSeconds > 0 {
+		return time.Duration(c.cfg.KeyCacheSeconds) * time.Second
+	}
+	return defaultKeyCacheTTL
+}
+
+// FetchEncryptionKey 从 enclave 获取当前加密公钥, 密钥ID必须由模数推导, 启用远程证明时公钥必须与证明报告绑定
+func (c *Client) FetchEncryptionKey(ctx context.Context) (*EncryptionKey, *rsa.PublicKey, error) {
+	path := c.cfg.KeyPath
+	if path == "" {
+		path = defaultKeyPath
+	}
+
+	var key EncryptionKey
+	if err := c.call(ctx, ServiceAPI, path, struct{}{}, &key, true); err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	derivedID := EncryptionKeyID(publicKey.N)
+	if key.KeyID != "" && !strings.EqualFold(key.KeyID, derivedID) {
+		return nil, nil, teeError(errors.ErrTeeBadResponse, "encryption key id %s does not match modulus (%s)", key.KeyID, derivedID)
+	}
+	key.KeyID = derivedID
+
+	if c.AttestationEnabled() {
+		if KeyHash(publicKey.N.Bytes()) != strings.ToLower(c.AttestedEncryptionKeyHash()) {
+			return nil, nil, teeError(errors.ErrTeeAttestationFailed, "encryption key %s is not bound to the attestation report", key.KeyID)
+		}
+	}
+	return &key, publicKey, nil
+}
+
+// EncryptionKey 返回缓存的加密公钥, 缓存过期或重新证明后绑定的公钥变化时重新获取
+func (c *Client) EncryptionKey(ctx context.Context) (*EncryptionKey, *rsa.PublicKey, error) {
+	// 先确认证明有效, 这样才能比较缓存的公钥是否仍与证明绑定
+	if err := c.ensureAttested(ctx); err != nil {
+		return nil, nil, teeError(errors.ErrTeeAttestationFailed, "%v", err)
+	}
+
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+
+	if cached := c.key; cached != nil && time.Since(cached.fetchedAt) < c.keyCacheTTL() {
+		if !c.AttestationEnabled() || cached.keyHash == strings.ToLower(c.AttestedEncryptionKeyHash()) {
+			return cached.key, cached.publicKey, nil
+		}
+	}
+
+	key, publicKey, err := c.FetchEncryptionKey(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.key = &cachedKey{
+		key:       key,
+		publicKey: publicKey,
+		keyHash:   KeyHash(publicKey.N.Bytes()),
+		fetchedAt: time.Now(),
+	}
+	return key, publicKey, nil
+}
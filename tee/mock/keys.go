@@ -0,0 +1,125 @@
+package mock
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	rsaPublicExponent = 65537
+	primeRounds       = 20
+)
+
+// deterministicReader 以 sha256(seed || label || counter) 输出确定性字节流, 仅用于开发和测试
+type deterministicReader struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func newDeterministicReader(seed string, label string) *deterministicReader {
+	return &deterministicReader{seed: []byte(seed + "\x00" + label)}
+}
+
+func (r *deterministicReader) Read(p []byte) (int, error) {
+	for len(r.buf) < len(p) {
+		block := make([]byte, 8)
+		binary.BigEndian.PutUint64(block, r.counter)
+		r.counter++
+		sum := sha256.Sum256(append(append([]byte{}, r.seed...), block...))
+		r.buf = append(r.buf, sum[:]...)
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// generatePrime 从确定性字节流中搜索指定位数的素数
+// rsa.GenerateKey 不保证相同随机源得到相同密钥, 因此自行生成素数
+func generatePrime(r *deterministicReader, bits int) (*big.Int, error) {
+	buf := make([]byte, (bits+7)/8)
+	if _, err := r.Read(buf); err != nil {
+		return nil, err
+	}
+	// 最高两位置1保证 p*q 的位数, 最低位置1保证为奇数
+	buf[0] |= 0xC0
+	buf[len(buf)-1] |= 1
+
+	e := big.NewInt(rsaPublicExponent)
+	one := big.NewInt(1)
+	two := big.NewInt(2)
+	p := new(big.Int).SetBytes(buf)
+	pMinus1 := new(big.Int)
+	for {
+		if p.BitLen() > bits {
+			return nil, fmt.Errorf("prime search overflowed %d bits", bits)
+		}
+		if p.ProbablyPrime(primeRounds) {
+			pMinus1.Sub(p, one)
+			if new(big.Int).GCD(nil, nil, e, pMinus1).Cmp(one) == 0 {
+				return p, nil
+			}
+		}
+		p.Add(p, two)
+	}
+}
+
+// DeterministicRSAKey 根据种子和标签生成固定的 RSA 密钥
+func DeterministicRSAKey(seed, label string, bits int) (*rsa.PrivateKey, error) {
+	r := newDeterministicReader(seed, label)
+	for {
+		p, err := generatePrime(r, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := generatePrime(r, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+
+		n := new(big.Int).Mul(p, q)
+		one := big.NewInt(1)
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(big.NewInt(rsaPublicExponent), phi)
+		if d == nil {
+			continue
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: rsaPublicExponent},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+		key.Precompute()
+		return key, nil
+	}
+}
+
+// DeterministicSigningKey 根据种子生成固定的 secp256k1 私钥, 返回与 config 相同格式的 hex 编码
+func DeterministicSigningKey(seed, label string) (privateKey, publicKey string, err error) {
+	r := newDeterministicReader(seed, label)
+	buf := make([]byte, 32)
+	for i := 0; i < 16; i++ {
+		if _, err := r.Read(buf); err != nil {
+			return "", "", err
+		}
+		key, err := crypto.ToECDSA(buf)
+		if err != nil {
+			continue
+		}
+		return hex.EncodeToString(crypto.FromECDSA(key)), hex.EncodeToString(crypto.FromECDSAPub(&key.PublicKey)[1:]), nil
+	}
+	return "", "", fmt.Errorf("failed to derive signing key")
+}
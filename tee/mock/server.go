@@ -0,0 +1,488 @@
+// Package mock 提供与 TEE 服务线格式一致的模拟实现, 用于本地开发和测试
+// 所有密钥由种子确定性生成, 不提供任何机密性保证, 不得用于生产环境
+package mock
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hufu/tee"
+	"hufu/utils"
+	"io"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSeed       = "hufu-mock-tee"
+	defaultKeyBits    = 2048
+	defaultProxyCount = 3
+	defaultWarnAbove  = 50000
+	defaultFailStatus = http.StatusServiceUnavailable
+	defaultProxyFirst = 1 // InitWalletPool 在空库上创建的代理钱包ID为 1-10
+	defaultProxyLast  = 10
+	warningStatus     = "Warning"
+)
+
+// Faults 故障注入配置
+type Faults struct {
+	FailRate      float64       // 返回 FailStatus 的概率
+	FailStatus    int           // 注入的错误状态码, 默认 503
+	MalformedRate float64       // 返回非法 JSON 的概率
+	FailPaths     []string      // 仅对这些路径注入故障, 为空时对所有路径生效
+	Latency       time.Duration // 每个请求的固定延迟
+}
+
+// Config 模拟 TEE 的配置
+type Config struct {
+	Seed           string  // 决定所有密钥和混洗结果的种子
+	KeyBits        int     // RSA 密钥位数
+	ProxyWalletIDs []int   // 混洗时可用的代理钱包
+	ProxyCount     int     // 每笔交易拆分到的代理钱包数量
+	WarnAbove      float64 // 超过该金额的交易返回 Warning
+	Faults         Faults
+}
+
+// transferRecord 解密成功的交易, 供 getfile 查询
+type transferRecord struct {
+	ID        string    `json:"id"`
+	From      uint64    `json:"from"`
+	To        uint64    `json:"to"`
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Server 模拟 TEE 服务
+type Server struct {
+	cfg            Config
+	enclaveKey     *rsa.PrivateKey
+	rootPrivateKey string
+	rootPublicKey  string
+	measurement    string
+
+	mu         sync.Mutex
+	tlsKeyHash string // BindTLSCertificate 设置的证书公钥摘要, 通过 http 提供服务时为空
+	faultRand  *mrand.Rand
+	walletKeys map[int]*rsa.PrivateKey
+	records    []transferRecord
+}
+
+// NewServer 根据配置创建模拟 TEE, 相同种子得到相同的密钥
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.Seed == "" {
+		cfg.Seed = defaultSeed
+	}
+	if cfg.KeyBits == 0 {
+		cfg.KeyBits = defaultKeyBits
+	}
+	if len(cfg.ProxyWalletIDs) == 0 {
+		for id := defaultProxyFirst; id <= defaultProxyLast; id++ {
+			cfg.ProxyWalletIDs = append(cfg.ProxyWalletIDs, id)
+		}
+	}
+	if cfg.ProxyCount == 0 {
+		cfg.ProxyCount = defaultProxyCount
+	}
+	if cfg.WarnAbove == 0 {
+		cfg.WarnAbove = defaultWarnAbove
+	}
+	if cfg.Faults.FailStatus == 0 {
+		cfg.Faults.FailStatus = defaultFailStatus
+	}
+
+	enclaveKey, err := DeterministicRSAKey(cfg.Seed, "enclave", cfg.KeyBits)
+	if err != nil {
+		return nil, err
+	}
+	rootPrivateKey, rootPublicKey, err := DeterministicSigningKey(cfg.Seed, "attestation-root")
+	if err != nil {
+		return nil, err
+	}
+	measurement := sha256.Sum256([]byte("hufu-mock-tee:" + cfg.Seed))
+	seed := sha256.Sum256([]byte(cfg.Seed))
+
+	return &Server{
+		cfg:            cfg,
+		enclaveKey:     enclaveKey,
+		rootPrivateKey: rootPrivateKey,
+		rootPublicKey:  rootPublicKey,
+		measurement:    hex.EncodeToString(measurement[:]),
+		faultRand:      mrand.New(mrand.NewSource(int64(binary.BigEndian.Uint64(seed[:8])))),
+		walletKeys:     make(map[int]*rsa.PrivateKey),
+	}, nil
+}
+
+// EnclavePublicKey enclave 的交易加密公钥
+func (s *Server) EnclavePublicKey() *rsa.PublicKey {
+	return &s.enclaveKey.PublicKey
+}
+
+// RootPublicKey 证明报告的根公钥, 对应 tee.client.attestation.root_public_key
+func (s *Server) RootPublicKey() string {
+	return s.rootPublicKey
+}
+
+// Measurement 模拟 enclave 的度量值, 对应 tee.client.attestation.expected_measurements
+func (s *Server) Measurement() string {
+	return s.measurement
+}
+
+// KeyID enclave 加密公钥的ID
+func (s *Server) KeyID() string {
+	return tee.EncryptionKeyID(s.enclaveKey.N)
+}
+
+// EncryptionKeyHash 证明报告中绑定的加密公钥摘要, 为 enclave 加密公钥模数的 sha256
+func (s *Server) EncryptionKeyHash() string {
+	return tee.KeyHash(s.enclaveKey.N.Bytes())
+}
+
+// BindTLSCertificate 设置提供服务的 TLS 证书, 之后签发的证明报告在 key_hash 中绑定该证书的公钥
+func (s *Server) BindTLSCertificate(cert *x509.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsKeyHash = tee.KeyHash(cert.RawSubjectPublicKeyInfo)
+}
+
+// Handler 返回包含所有 TEE 接口的 HTTP handler, api/add/file 三个地址可以指向同一个实例
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/create_wallet", s.handleCreateWallet)
+	mux.HandleFunc("/api/decrypt_transaction", s.handleDecrypt)
+	mux.HandleFunc("/api/transaction_warning", s.handleWarning)
+	mux.HandleFunc("/api/shuffle_transaction", s.handleShuffle)
+	mux.HandleFunc("/api/attestation", s.handleAttestation)
+	mux.HandleFunc("/api/encryption_key", s.handleEncryptionKey)
+	mux.HandleFunc("/add", s.handleAdd)
+	mux.HandleFunc("/getfile", s.handleGetFile)
+	return s.withFaults(mux)
+}
+
+// withFaults 按配置注入延迟, 错误状态码和非法响应
+func (s *Server) withFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Faults.Latency > 0 {
+			time.Sleep(s.cfg.Faults.Latency)
+		}
+		if s.faultApplies(r.URL.Path) {
+			s.mu.Lock()
+			roll := s.faultRand.Float64()
+			s.mu.Unlock()
+
+			if roll < s.cfg.Faults.FailRate {
+				writeJSON(w, s.cfg.Faults.FailStatus, map[string]string{"error": "injected fault"})
+				return
+			}
+			if roll < s.cfg.Faults.FailRate+s.cfg.Faults.MalformedRate {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				io.WriteString(w, `{"message": "injected malformed`)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) faultApplies(path string) bool {
+	if len(s.cfg.Faults.FailPaths) == 0 {
+		return true
+	}
+	for _, p := range s.cfg.Faults.FailPaths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeJSON 只接受 POST 和合法的 JSON 请求体
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// walletKey 钱包密钥同样由种子和钱包ID确定
+func (s *Server) walletKey(walletID int) (*rsa.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.walletKeys[walletID]; ok {
+		return key, nil
+	}
+	key, err := DeterministicRSAKey(s.cfg.Seed, fmt.Sprintf("wallet:%d", walletID), s.cfg.KeyBits)
+	if err != nil {
+		return nil, err
+	}
+	s.walletKeys[walletID] = key
+	return key, nil
+}
+
+// handleCreateWallet 返回 hex 编码的私钥指数 D 和模数 N, 与 utils.RSADecryptWithHexKey 的格式一致
+func (s *Server) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
+	var req tee.CreateWalletRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.WalletID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "invalid wallet_id"})
+		return
+	}
+
+	key, err := s.walletKey(req.WalletID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"message": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, tee.CreateWalletResponse{
+		Message:    tee.WalletCreatedMessage,
+		PublicKey:  hex.EncodeToString(key.N.Bytes()),
+		PrivateKey: hex.EncodeToString(key.D.Bytes()),
+	})
+}
+
+// handleDecrypt 使用 enclave 私钥打开转账信封
+func (s *Server) handleDecrypt(w http.ResponseWriter, r *http.Request) {
+	var req tee.Envelope
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.KeyID != s.KeyID() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Unknown key_id " + req.KeyID + "."})
+		return
+	}
+
+	payload, err := tee.OpenTransfer(s.enclaveKey, &req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Transaction decryption failed: " + err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	s.records = append(s.records, transferRecord{
+		ID:        strconv.Itoa(len(s.records) + 1),
+		From:      payload.From,
+		To:        payload.To,
+		Amount:    payload.Amount,
+		CreatedAt: time.Now(),
+	})
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, tee.DecryptResponse{
+		Message: tee.DecryptSuccessMessage,
+		Data:    *payload,
+	})
+}
+
+// handleWarning 金额非正, 超过阈值或收付款相同的交易返回 Warning
+func (s *Server) handleWarning(w http.ResponseWriter, r *http.Request) {
+	var req tee.Transfer
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	resp := tee.WarningResponse{TransactionStatus: tee.TransactionStatusSuccess}
+	switch {
+	case req.Amount <= 0:
+		resp = tee.WarningResponse{TransactionStatus: warningStatus, WarningMessage: "Transaction amount must be positive."}
+	case req.From == req.To:
+		resp = tee.WarningResponse{TransactionStatus: warningStatus, WarningMessage: "Sender and receiver are the same wallet."}
+	case req.Amount > s.cfg.WarnAbove:
+		resp = tee.WarningResponse{TransactionStatus: warningStatus, WarningMessage: fmt.Sprintf("Transaction amount exceeds %.2f.", s.cfg.WarnAbove)}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleShuffle 将金额按分拆分到若干代理钱包, 同样的输入总是得到同样的结果
+func (s *Server) handleShuffle(w http.ResponseWriter, r *http.Request) {
+	var req tee.Transfer
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	cents := int64(math.Round(req.Amount * 100))
+	if cents <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "amount must be positive"})
+		return
+	}
+
+	candidates := make([]int, 0, len(s.cfg.ProxyWalletIDs))
+	for _, id := range s.cfg.ProxyWalletIDs {
+		if uint64(id) != req.From && uint64(id) != req.To {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "no proxy wallets available"})
+		return
+	}
+
+	rng := newDeterministicReader(s.cfg.Seed, fmt.Sprintf("shuffle:%d:%d:%d", req.From, req.To, cents))
+	next := func(n int) int {
+		var b [8]byte
+		rng.Read(b[:])
+		return int(binary.BigEndian.Uint64(b[:]) % uint64(n))
+	}
+	for i := len(candidates) - 1; i > 0; i-- {
+		j := next(i + 1)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+
+	count := s.cfg.ProxyCount
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	if int64(count) > cents {
+		count = int(cents)
+	}
+
+	// 每个代理钱包至少分到1分, 剩余部分随机分配
+	parts := make([]int64, count)
+	remaining := cents - int64(count)
+	for i := range parts {
+		parts[i] = 1
+		if i == count-1 {
+			parts[i] += remaining
+			break
+		}
+		share := int64(0)
+		if remaining > 0 {
+			share = int64(next(int(min(remaining, math.MaxInt32)) + 1))
+		}
+		parts[i] += share
+		remaining -= share
+	}
+
+	data := make(map[string]float64, count)
+	for i, part := range parts {
+		data[strconv.Itoa(candidates[i])] = float64(part) / 100
+	}
+	writeJSON(w, http.StatusOK, tee.ShuffleResponse{Data: data})
+}
+
+// handleAttestation 签发证明报告, 报告绑定 enclave 加密公钥和 TLS 证书公钥
+func (s *Server) handleAttestation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Nonce string `json:"nonce"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	tlsKeyHash := s.tlsKeyHash
+	s.mu.Unlock()
+
+	report := tee.AttestationReport{
+		Measurement:       s.measurement,
+		KeyHash:           tlsKeyHash,
+		EncryptionKeyHash: s.EncryptionKeyHash(),
+		Nonce:             req.Nonce,
+		Timestamp:         time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	claims, err := report.AttestationClaims()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	report.Signature, err = utils.SignData(s.rootPrivateKey, string(claims))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleEncryptionKey 返回 enclave 当前的加密公钥
+func (s *Server) handleEncryptionKey(w http.ResponseWriter, r *http.Request) {
+	var req struct{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	writeJSON(w, http.StatusOK, tee.EncryptionKey{
+		KeyID: s.KeyID(),
+		N:     hex.EncodeToString(s.enclaveKey.N.Bytes()),
+		E:     s.enclaveKey.E,
+	})
+}
+
+// handleAdd 对文本中以空白, 逗号或加号分隔的数字求和
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := strings.FieldsFunc(string(body), func(c rune) bool {
+		return c == ' ' || c == ',' || c == '+' || c == '\n' || c == '\t'
+	})
+	var sum float64
+	for _, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			http.Error(w, "invalid number: "+field, http.StatusBadRequest)
+			return
+		}
+		sum += v
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, strconv.FormatFloat(sum, 'f', -1, 64))
+}
+
+// handleGetFile 返回与钱包相关的已解密交易
+func (s *Server) handleGetFile(w http.ResponseWriter, r *http.Request) {
+	var req tee.GetFileRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	walletID, err := strconv.ParseUint(req.ID, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	s.mu.Lock()
+	records := make([]transferRecord, 0)
+	for _, record := range s.records {
+		if record.From == walletID || record.To == walletID {
+			records = append(records, record)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":           req.ID,
+		"transactions": records,
+	})
+}
+
+// EncryptTransfer 按客户端的方式生成转账信封, 便于在测试中构造 decrypt_transaction 请求
+func (s *Server) EncryptTransfer(transfer tee.Transfer) (*tee.Envelope, error) {
+	payload, err := tee.NewTransferPayload(transfer.From, transfer.To, transfer.Amount)
+	if err != nil {
+		return nil, err
+	}
+	return tee.SealTransfer(&s.enclaveKey.PublicKey, s.KeyID(), payload)
+}
@@ -1,13 +1,21 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"math/big"
 	"strings"
 )
 
+// rsaPublicExponent 钱包 RSA 密钥的公钥指数
+const rsaPublicExponent = 65537
+
 // RSADecryptWithHexKey 使用十六进制私钥进行RSA解密
 func RSADecryptWithHexKey(encryptedData string, hexPrivateKey string, hexPublicKey string) (string, error) {
 	// 解码
@@ -62,13 +70,13 @@ func hexToPublicKey(hexStr string) (*rsa.PublicKey, error) {
 	// 创建公钥
 	pub := &rsa.PublicKey{
 		N: new(big.Int).SetBytes(modBytes),
-		E: 65537, // 通常使用65537作为公钥指数
+		E: rsaPublicExponent,
 	}
 
 	return pub, nil
 }
 
-// hexToPrivateKey 将十六进制字符串转换为RSA私钥
+// hexToPrivateKey 将十六进制字符串转换为RSA私钥, 由 N, E, D 恢复素因子并预计算 CRT 参数
 func hexToPrivateKey(hexPriKey string, hexPubKey string) (*rsa.PrivateKey, error) {
 	hexPriKey = strings.ReplaceAll(hexPriKey, " ", "")
 	hexPubKey = strings.ReplaceAll(hexPubKey, " ", "")
@@ -84,14 +92,164 @@ func hexToPrivateKey(hexPriKey string, hexPubKey string) (*rsa.PrivateKey, error
 		return nil, err
 	}
 
+	n := new(big.Int).SetBytes(pubBytes)
+	d := new(big.Int).SetBytes(privBytes)
+	p, q, err := recoverPrimes(n, big.NewInt(rsaPublicExponent), d)
+	if err != nil {
+		return nil, err
+	}
+
 	// 创建私钥结构
 	priv := &rsa.PrivateKey{
 		PublicKey: rsa.PublicKey{
-			N: new(big.Int).SetBytes(pubBytes),
-			E: 65537,
+			N: n,
+			E: rsaPublicExponent,
 		},
-		D: new(big.Int).SetBytes(privBytes),
+		D:      d,
+		Primes: []*big.Int{p, q},
 	}
+	if err := priv.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rsa private key: %v", err)
+	}
+	priv.Precompute()
 
 	return priv, nil
 }
+
+// recoverPrimes 由模数和公私钥指数分解出两个素因子 (NIST SP 800-56B 附录 C)
+func recoverPrimes(n, e, d *big.Int) (*big.Int, *big.Int, error) {
+	one := big.NewInt(1)
+	nMinus1 := new(big.Int).Sub(n, one)
+
+	// k = d*e - 1 = 2^t * r, r 为奇数
+	k := new(big.Int).Mul(d, e)
+	k.Sub(k, one)
+	if k.Sign() <= 0 || k.Bit(0) != 0 {
+		return nil, nil, fmt.Errorf("invalid rsa private exponent")
+	}
+	t := 0
+	r := new(big.Int).Set(k)
+	for r.Bit(0) == 0 {
+		r.Rsh(r, 1)
+		t++
+	}
+
+	for g := int64(2); g < 100; g++ {
+		y := new(big.Int).Exp(big.NewInt(g), r, n)
+		if y.Cmp(one) == 0 || y.Cmp(nMinus1) == 0 {
+			continue
+		}
+		for i := 1; i <= t; i++ {
+			x := new(big.Int).Exp(y, big.NewInt(2), n)
+			if x.Cmp(one) == 0 {
+				// y 是 1 的非平凡平方根, gcd(y-1, n) 即为一个素因子
+				p := new(big.Int).GCD(nil, nil, new(big.Int).Sub(y, one), n)
+				q := new(big.Int).Div(n, p)
+				if p.Cmp(one) <= 0 || new(big.Int).Mul(p, q).Cmp(n) != 0 {
+					break
+				}
+				return p, q, nil
+			}
+			if x.Cmp(nMinus1) == 0 {
+				break
+			}
+			y = x
+		}
+	}
+	return nil, nil, fmt.Errorf("failed to recover rsa primes")
+}
+
+// RSAWrapKeyWithHexKey 使用十六进制公钥以 RSA-OAEP(SHA-256) 封装数据密钥, label 与密文绑定
+func RSAWrapKeyWithHexKey(dataKey []byte, hexPublicKey string, label []byte) (string, error) {
+	publicKey, err := hexToPublicKey(hexPublicKey)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, dataKey, label)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(wrapped), nil
+}
+
+// RSAUnwrapKeyWithHexKey 解封 RSAWrapKeyWithHexKey 封装的数据密钥
+func RSAUnwrapKeyWithHexKey(wrappedKey string, hexPrivateKey string, hexPublicKey string, label []byte) ([]byte, error) {
+	wrapped, err := hex.DecodeString(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := hexToPrivateKey(hexPrivateKey, hexPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptOAEP(sha256.New(), nil, privateKey, wrapped, label)
+}
+
+// AESGCMSeal 使用 AES-GCM 加密, 返回 hex 编码的 nonce 和密文
+func AESGCMSeal(key, plaintext, aad []byte) (nonceHex string, ciphertextHex string, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(nonce), hex.EncodeToString(gcm.Seal(nil, nonce, plaintext, aad)), nil
+}
+
+// AESGCMOpen 解密 AESGCMSeal 的输出, 附加数据不一致时返回错误
+func AESGCMOpen(key []byte, nonceHex, ciphertextHex string, aad []byte) ([]byte, error) {
+	nonce, err := hex.DecodeString(nonceHex)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(ciphertextHex)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(nonce))
+	}
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+// RSASignPSSWithHexKey 使用钱包私钥对消息做 RSA-PSS(SHA-256) 签名, 返回 hex 编码, 供客户端使用
+func RSASignPSSWithHexKey(message []byte, hexPrivateKey string, hexPublicKey string) (string, error) {
+	privateKey, err := hexToPrivateKey(hexPrivateKey, hexPublicKey)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(message)
+	signature, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, digest[:], nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+// RSAVerifyPSSWithHexKey 使用钱包公钥验证 RSA-PSS(SHA-256) 签名
+func RSAVerifyPSSWithHexKey(message []byte, signatureHex string, hexPublicKey string) error {
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding")
+	}
+	publicKey, err := hexToPublicKey(hexPublicKey)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(message)
+	return rsa.VerifyPSS(publicKey, crypto.SHA256, digest[:], signature, nil)
+}
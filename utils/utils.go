@@ -1,26 +1,22 @@
 package utils
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"math/big"
-	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SSSaaS/sssa-golang"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/ecies"
-	"golang.org/x/net/proxy"
 )
 
 const (
@@ -28,26 +24,14 @@ const (
 	SHARES5 = 5 // 总份额数
 )
 
-const SupervisorPrivateKey = "43878f814c6753e43c1bd91db187e9399551e50876b7d24f7aba2cc467f88458"
-const SupervisorPublicKey = "066583fe9369c70280b2af181e9b6d87eb63848f7af4ac1444dcc774e11805630dfc07918bcd80803a38f77f4b6f415e1d4e2596a79ecacc83f9a0ad95645326"
-
-const ProxyPublicKey = "066583fe9369c70280b2af181e9b6d87eb63848f7af4ac1444dcc774e11805630dfc07918bcd80803a38f77f4b6f415e1d4e2596a79ecacc83f9a0ad95645326"
-const ProxyPrivateKey = "43878f814c6753e43c1bd91db187e9399551e50876b7d24f7aba2cc467f88458"
+// signatureScalarSize r 和 s 在签名中各占的字节数
+const signatureScalarSize = 32
 
 // encryptData encrypts data using ECIES with the provided ECDSA public key.
 func EncryptData(key string, data string) (string, error) {
-	// 将公钥字符串解码为字节数组
-	publicKeyBytes, err := hex.DecodeString(key)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode public key: %v", err)
-	}
-
-	// 直接使用解码后的公钥字节
-	// 加上0x04前缀，表示未压缩的公钥
-	publicKeyBytes = append([]byte{0x04}, publicKeyBytes...)
-	publicKey, err := crypto.UnmarshalPubkey(publicKeyBytes)
+	publicKey, err := ParsePublicKey(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal public key: %v", err)
+		return "", err
 	}
 
 	// Convert to ECIES public key
@@ -101,6 +85,28 @@ func GenerateHash(data string) string {
 	return hex.EncodeToString(hash.Sum(nil))
 }
 
+// GenerateSalt 生成指定字节长度的随机盐值(十六进制)
+func GenerateSalt(size int) (string, error) {
+	salt := make([]byte, size)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// CommitEvidence 计算证据的加盐哈希承诺 sha256(salt || evidence)
+func CommitEvidence(salt string, evidence string) (string, error) {
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode salt: %v", err)
+	}
+
+	hash := sha256.New()
+	hash.Write(saltBytes)
+	hash.Write([]byte(evidence))
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // generateKeys 生成随机密钥对
 func GenerateKeys() (privateKeyString, publicKeyString, address string) {
 	privateKey, err := crypto.GenerateKey()
@@ -123,66 +129,18 @@ func GenerateKeys() (privateKeyString, publicKeyString, address string) {
 	return hexutil.Encode(privateKeyBytes)[2:], hexutil.Encode(publicKeyBytes)[4:], address
 }
 
-func GenerateRSAKey(walletID int) (privateKey, publicKey string) {
-	// 创建 SOCKS5 代理
-	dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:1080", nil, proxy.Direct)
+// PublicKeyFromPrivate derives the 64 byte X||Y hex public key, the same
+// encoding GenerateKeys returns, from a hex encoded secp256k1 private key.
+func PublicKeyFromPrivate(privateKey string) (string, error) {
+	privateKeyBytes, err := hex.DecodeString(strings.TrimPrefix(privateKey, "0x"))
 	if err != nil {
-		log.Println(err)
-		return "", ""
-	}
-
-	// 创建带有代理的 HTTP 客户端
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Dial: dialer.Dial,
-		},
-	}
-
-	// 准备请求
-	jsonBody, _ := json.Marshal(map[string]int{"wallet_id": walletID})
-	req, err := http.NewRequest("POST", "http://10.77.110.184:8082/api/create_wallet", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		log.Println("创建请求失败: ", err)
-		return "", ""
-	}
-
-	// 设置 Content-Type
-	req.Header.Set("Content-Type", "application/json")
-
-	// 发送请求
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		log.Println("发送请求失败: ", err)
-		return "", ""
+		return "", fmt.Errorf("failed to decode private key: %v", err)
 	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	respBody, err := io.ReadAll(resp.Body)
+	ecPrivateKey, err := crypto.ToECDSA(privateKeyBytes)
 	if err != nil {
-		log.Println("读取响应失败: ", err)
-		return "", ""
-	}
-
-	type KeyResponse struct {
-		Message    string `json:"message"`
-		PublicKey  string `json:"public_key"`
-		PrivateKey string `json:"private_key"`
-	}
-
-	var keyResp KeyResponse
-	if err := json.Unmarshal(respBody, &keyResp); err != nil {
-		log.Println("解析响应失败: ", err)
-		return "", ""
-	}
-	log.Println("创建钱包响应: ", keyResp)
-
-	if keyResp.Message != "wallet created successfully" {
-		log.Println("创建钱包失败: ", keyResp.Message)
-		return "", ""
+		return "", fmt.Errorf("failed to parse private key: %v", err)
 	}
-
-	return keyResp.PrivateKey, keyResp.PublicKey
+	return hex.EncodeToString(crypto.FromECDSAPub(&ecPrivateKey.PublicKey)[1:]), nil
 }
 
 // SharePrivateKey Shamir's secret sharing https://en.wikipedia.org/wiki/Shamir%27s_secret_sharing
@@ -215,27 +173,60 @@ func SignData(privateKey string, data string) (string, error) {
 		return "", fmt.Errorf("failed to sign data: %v", err)
 	}
 
-	// Combine r and s into a single byte slice
-	rBytes := r.Bytes()
-	sBytes := s.Bytes()
-	signature := append(rBytes, sBytes...)
+	// Combine r and s into a fixed-width 64 byte signature
+	signature := make([]byte, 2*signatureScalarSize)
+	r.FillBytes(signature[:signatureScalarSize])
+	s.FillBytes(signature[signatureScalarSize:])
 
 	// Encode the signature to hex
 	return hex.EncodeToString(signature), nil
 }
 
-// VerifySignature verifies the ECDSA signature for the given data.
-func VerifySignature(publicKey string, data string, signature string) (bool, error) {
-	// Decode the public key from hex
-	publicKeyBytes, err := hex.DecodeString(publicKey)
+// ParsePublicKey parses a hex encoded secp256k1 public key. It accepts the
+// 64 byte X||Y form produced by GenerateKeys, the 65 byte uncompressed form
+// with a 0x04 prefix and the 33 byte compressed form.
+func ParsePublicKey(publicKey string) (*ecdsa.PublicKey, error) {
+	publicKeyBytes, err := hex.DecodeString(strings.TrimPrefix(publicKey, "0x"))
 	if err != nil {
-		return false, fmt.Errorf("failed to decode public key: %v", err)
+		return nil, fmt.Errorf("failed to decode public key: %v", err)
+	}
+
+	switch len(publicKeyBytes) {
+	case 64:
+		publicKeyBytes = append([]byte{0x04}, publicKeyBytes...)
+	case 33:
+		ecPublicKey, err := crypto.DecompressPubkey(publicKeyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress public key: %v", err)
+		}
+		return ecPublicKey, nil
 	}
 
-	// Create an ECDSA public key from the bytes
 	ecPublicKey, err := crypto.UnmarshalPubkey(publicKeyBytes)
 	if err != nil {
-		return false, fmt.Errorf("failed to unmarshal public key: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal public key: %v", err)
+	}
+	return ecPublicKey, nil
+}
+
+// PublicKeyID returns a short identifier for a public key, derived from the
+// sha256 of its 64 byte X||Y encoding, so that the same key always gets the
+// same ID regardless of how it was encoded.
+func PublicKeyID(publicKey string) (string, error) {
+	ecPublicKey, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(crypto.FromECDSAPub(ecPublicKey)[1:])
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// VerifySignature verifies the ECDSA signature for the given data.
+func VerifySignature(publicKey string, data string, signature string) (bool, error) {
+	// Parse the public key in any of the supported encodings
+	ecPublicKey, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return false, err
 	}
 
 	// Generate the hash of the data
@@ -249,13 +240,31 @@ func VerifySignature(publicKey string, data string, signature string) (bool, err
 		return false, fmt.Errorf("failed to decode signature: %v", err)
 	}
 
-	// Split the signature into r and s
-	r := new(big.Int).SetBytes(sigBytes[:len(sigBytes)/2])
-	s := new(big.Int).SetBytes(sigBytes[len(sigBytes)/2:])
+	if len(sigBytes) == 2*signatureScalarSize {
+		// Split the signature into r and s
+		r := new(big.Int).SetBytes(sigBytes[:signatureScalarSize])
+		s := new(big.Int).SetBytes(sigBytes[signatureScalarSize:])
+
+		// Verify the signature
+		valid := ecdsa.Verify(ecPublicKey, hashedData, r, s)
+		return valid, nil
+	}
 
-	// Verify the signature
-	valid := ecdsa.Verify(ecPublicKey, hashedData, r, s)
-	return valid, nil
+	// Older versions of SignData concatenated r.Bytes() and s.Bytes()
+	// without padding, so a scalar with leading zero bytes produced a
+	// shorter signature. The boundary between r and s is unknown, so try
+	// every split that left-pads both halves to the fixed width.
+	if len(sigBytes) <= signatureScalarSize || len(sigBytes) > 2*signatureScalarSize {
+		return false, fmt.Errorf("invalid signature length: %d", len(sigBytes))
+	}
+	for rLen := len(sigBytes) - signatureScalarSize; rLen <= signatureScalarSize; rLen++ {
+		r := new(big.Int).SetBytes(sigBytes[:rLen])
+		s := new(big.Int).SetBytes(sigBytes[rLen:])
+		if ecdsa.Verify(ecPublicKey, hashedData, r, s) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func GenerateRandomNumber(length int) string {